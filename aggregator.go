@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stringListFlag is a flag.Value that collects repeated flag values
+type stringListFlag []string
+
+// String returns the collected values
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set appends a value each time the flag is given
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// aggregatorMaxResponseBytes bounds the size of an upstream /json response
+const aggregatorMaxResponseBytes = 64 << 20
+
+// Upstream is a remote vnstat-http-server polled in aggregator mode
+type Upstream struct {
+	Name string // Host name used in labels and the fleet view
+	URL  string // Base URL, may carry ?token=
+}
+
+// upstreamState tracks the latest data and health of one upstream
+type upstreamState struct {
+	upstream    Upstream
+	jsonURL     string
+	raw         []byte
+	data        map[string]interface{}
+	lastAttempt time.Time
+	lastSuccess time.Time
+	lastError   string
+}
+
+// Aggregator polls upstream servers and serves a combined fleet view
+type Aggregator struct {
+	mu         sync.RWMutex
+	states     []*upstreamState
+	client     *http.Client
+	interval   time.Duration
+	staleAfter time.Duration
+}
+
+// parseUpstream parses an upstream definition in the form [name=]URL
+func parseUpstream(spec string) (Upstream, error) {
+	spec = strings.TrimSpace(spec)
+	name := ""
+	if i := strings.Index(spec, "="); i > 0 && !strings.Contains(spec[:i], "/") {
+		name, spec = spec[:i], spec[i+1:]
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Upstream{}, fmt.Errorf("invalid upstream URL %q", spec)
+	}
+	if name == "" {
+		name = u.Hostname()
+	}
+
+	return Upstream{Name: name, URL: spec}, nil
+}
+
+// loadUpstreams combines upstreams given on the command line with those listed in a file (one per line)
+func loadUpstreams(specs []string, file string) ([]Upstream, error) {
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open upstreams file: %v", err)
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			specs = append(specs, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read upstreams file: %v", err)
+		}
+	}
+
+	var upstreams []Upstream
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		upstream, err := parseUpstream(spec)
+		if err != nil {
+			return nil, err
+		}
+		if seen[upstream.Name] {
+			return nil, fmt.Errorf("duplicate upstream name %q", upstream.Name)
+		}
+		seen[upstream.Name] = true
+		upstreams = append(upstreams, upstream)
+	}
+
+	return upstreams, nil
+}
+
+// NewAggregator creates a new Aggregator instance
+func NewAggregator(upstreams []Upstream, interval, staleAfter time.Duration) *Aggregator {
+	states := make([]*upstreamState, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		u, _ := url.Parse(upstream.URL)
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/json"
+		states = append(states, &upstreamState{
+			upstream: upstream,
+			jsonURL:  u.String(),
+		})
+	}
+
+	return &Aggregator{
+		states:     states,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		interval:   interval,
+		staleAfter: staleAfter,
+	}
+}
+
+// Start polls all upstreams on the shared periodic scheduler
+func (a *Aggregator) Start(port string) {
+	startPeriodicTask("Aggregator", port, a.interval, a.pollAll)
+}
+
+// pollAll fetches /json from every upstream concurrently
+func (a *Aggregator) pollAll() {
+	var wg sync.WaitGroup
+	for _, state := range a.states {
+		wg.Add(1)
+		go func(state *upstreamState) {
+			defer wg.Done()
+			a.poll(state)
+		}(state)
+	}
+	wg.Wait()
+}
+
+// poll fetches and stores the data of one upstream
+func (a *Aggregator) poll(state *upstreamState) {
+	now := time.Now()
+	raw, data, err := a.fetch(state.jsonURL)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state.lastAttempt = now
+	if err != nil {
+		// Only log transitions to avoid repeating the same failure every interval
+		if state.lastError == "" {
+			slog.Warn("Aggregator: upstream failed", "upstream", state.upstream.Name, "err", err)
+		}
+		state.lastError = err.Error()
+		return
+	}
+
+	if state.lastError != "" {
+		slog.Info("Aggregator: upstream recovered", "upstream", state.upstream.Name)
+	}
+	state.raw = raw
+	state.data = data
+	state.lastSuccess = now
+	state.lastError = ""
+}
+
+// fetch requests an upstream /json URL and validates the response
+func (a *Aggregator) fetch(jsonURL string) ([]byte, map[string]interface{}, error) {
+	resp, err := a.client.Get(jsonURL)
+	if err != nil {
+		// Drop the URL from the error so upstream tokens never reach logs or the fleet view
+		if urlErr, ok := err.(*url.Error); ok {
+			return nil, nil, urlErr.Err
+		}
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the limit to tell a response of exactly the limit from a larger one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, aggregatorMaxResponseBytes+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) > aggregatorMaxResponseBytes {
+		return nil, nil, fmt.Errorf("response larger than %d bytes", aggregatorMaxResponseBytes)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		selfMetrics.parseError("upstream")
+		return nil, nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	return body, data, nil
+}
+
+// upstreamFreshness counts the upstreams with fresh data and names the stale ones
+func (a *Aggregator) upstreamFreshness(now time.Time) (fresh int, stale []string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, state := range a.states {
+		if a.isStale(state, now) {
+			stale = append(stale, state.upstream.Name)
+		} else {
+			fresh++
+		}
+	}
+	return fresh, stale
+}
+
+// isStale reports whether an upstream has not been updated within the staleness threshold
+func (a *Aggregator) isStale(state *upstreamState, now time.Time) bool {
+	return state.lastSuccess.IsZero() || now.Sub(state.lastSuccess) > a.staleAfter
+}
+
+// rxTx is a pair of rx/tx byte counters in the fleet view
+type rxTx struct {
+	Rx float64 `json:"rx"`
+	Tx float64 `json:"tx"`
+}
+
+// add accumulates another counter pair
+func (c *rxTx) add(rx, tx float64) {
+	c.Rx += rx
+	c.Tx += tx
+}
+
+// fleetInterface is one interface of one host in the fleet view
+type fleetInterface struct {
+	Name  string `json:"name"`
+	Total *rxTx  `json:"total,omitempty"`
+	Month *rxTx  `json:"month,omitempty"`
+	Today *rxTx  `json:"today,omitempty"`
+}
+
+// fleetHost is the health and traffic of one upstream in the fleet view
+type fleetHost struct {
+	Name        string           `json:"name"`
+	Healthy     bool             `json:"healthy"`
+	Stale       bool             `json:"stale"`
+	LastAttempt *time.Time       `json:"last_attempt,omitempty"`
+	LastSuccess *time.Time       `json:"last_success,omitempty"`
+	AgeSeconds  *float64         `json:"age_seconds,omitempty"`
+	LastError   string           `json:"last_error,omitempty"`
+	Interfaces  []fleetInterface `json:"interfaces"`
+}
+
+// fleetTotals sums traffic over all hosts with data
+type fleetTotals struct {
+	Hosts        int  `json:"hosts"`
+	HealthyHosts int  `json:"healthy_hosts"`
+	StaleHosts   int  `json:"stale_hosts"`
+	Total        rxTx `json:"total"`
+	Month        rxTx `json:"month"`
+	Today        rxTx `json:"today"`
+}
+
+// fleetView is the combined response of the /fleet endpoint
+type fleetView struct {
+	GeneratedAt time.Time   `json:"generated_at"`
+	Hosts       []fleetHost `json:"hosts"`
+	Totals      fleetTotals `json:"totals"`
+}
+
+// Fleet builds the combined view of all upstreams
+func (a *Aggregator) Fleet() fleetView {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	now := time.Now()
+	view := fleetView{GeneratedAt: now, Hosts: make([]fleetHost, 0, len(a.states))}
+	view.Totals.Hosts = len(a.states)
+
+	for _, state := range a.states {
+		host := fleetHost{
+			Name:       state.upstream.Name,
+			Healthy:    state.lastError == "" && !state.lastSuccess.IsZero(),
+			Stale:      a.isStale(state, now),
+			LastError:  state.lastError,
+			Interfaces: []fleetInterface{},
+		}
+		if !state.lastAttempt.IsZero() {
+			lastAttempt := state.lastAttempt
+			host.LastAttempt = &lastAttempt
+		}
+		if !state.lastSuccess.IsZero() {
+			lastSuccess := state.lastSuccess
+			age := now.Sub(lastSuccess).Seconds()
+			host.LastSuccess = &lastSuccess
+			host.AgeSeconds = &age
+		}
+		if host.Healthy {
+			view.Totals.HealthyHosts++
+		}
+		if host.Stale {
+			view.Totals.StaleHosts++
+		}
+
+		if state.data != nil {
+			interfaces, _ := extractInterfaceTraffic(state.data)
+			for _, iface := range interfaces {
+				entry := fleetInterface{Name: iface.Name}
+				if iface.HasTotal {
+					entry.Total = &rxTx{iface.TotalRx, iface.TotalTx}
+					view.Totals.Total.add(iface.TotalRx, iface.TotalTx)
+				}
+				if iface.HasMonth {
+					entry.Month = &rxTx{iface.MonthRx, iface.MonthTx}
+					view.Totals.Month.add(iface.MonthRx, iface.MonthTx)
+				}
+				if iface.HasToday {
+					entry.Today = &rxTx{iface.TodayRx, iface.TodayTx}
+					view.Totals.Today.add(iface.TodayRx, iface.TodayTx)
+				}
+				host.Interfaces = append(host.Interfaces, entry)
+			}
+		}
+
+		view.Hosts = append(view.Hosts, host)
+	}
+
+	sort.Slice(view.Hosts, func(i, j int) bool { return view.Hosts[i].Name < view.Hosts[j].Name })
+	return view
+}
+
+// RawJSON returns the last /json response of every upstream keyed by host name
+func (a *Aggregator) RawJSON() map[string]json.RawMessage {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	result := make(map[string]json.RawMessage, len(a.states))
+	for _, state := range a.states {
+		if state.raw != nil {
+			result[state.upstream.Name] = json.RawMessage(state.raw)
+		}
+	}
+	return result
+}
+
+// generatePrometheusMetrics renders fleet traffic with hostname labels plus per-upstream health
+func (a *Aggregator) generatePrometheusMetrics() string {
+	view := a.Fleet()
+	var metrics strings.Builder
+
+	metrics.WriteString("# HELP vnstat_traffic_total_bytes Total traffic in bytes\n")
+	metrics.WriteString("# TYPE vnstat_traffic_total_bytes counter\n")
+	metrics.WriteString("# HELP vnstat_traffic_month_bytes Monthly traffic in bytes\n")
+	metrics.WriteString("# TYPE vnstat_traffic_month_bytes counter\n")
+	metrics.WriteString("# HELP vnstat_traffic_today_bytes Today's traffic in bytes\n")
+	metrics.WriteString("# TYPE vnstat_traffic_today_bytes counter\n")
+
+	for _, host := range view.Hosts {
+		hostname := escapeLabelValue(host.Name)
+		for _, iface := range host.Interfaces {
+			interfaceName := escapeLabelValue(iface.Name)
+			for _, series := range []struct {
+				name   string
+				values *rxTx
+			}{
+				{"vnstat_traffic_total_bytes", iface.Total},
+				{"vnstat_traffic_month_bytes", iface.Month},
+				{"vnstat_traffic_today_bytes", iface.Today},
+			} {
+				if series.values == nil {
+					continue
+				}
+				metrics.WriteString(fmt.Sprintf("%s{hostname=\"%s\",interface=\"%s\",direction=\"rx\"} %.0f\n", series.name, hostname, interfaceName, series.values.Rx))
+				metrics.WriteString(fmt.Sprintf("%s{hostname=\"%s\",interface=\"%s\",direction=\"tx\"} %.0f\n", series.name, hostname, interfaceName, series.values.Tx))
+			}
+		}
+	}
+
+	metrics.WriteString("# HELP vnstat_upstream_up Whether the last poll of the upstream succeeded\n")
+	metrics.WriteString("# TYPE vnstat_upstream_up gauge\n")
+	for _, host := range view.Hosts {
+		metrics.WriteString(fmt.Sprintf("vnstat_upstream_up{hostname=\"%s\"} %d\n", escapeLabelValue(host.Name), boolToInt(host.Healthy)))
+	}
+
+	metrics.WriteString("# HELP vnstat_upstream_stale Whether the upstream data is older than the staleness threshold\n")
+	metrics.WriteString("# TYPE vnstat_upstream_stale gauge\n")
+	for _, host := range view.Hosts {
+		metrics.WriteString(fmt.Sprintf("vnstat_upstream_stale{hostname=\"%s\"} %d\n", escapeLabelValue(host.Name), boolToInt(host.Stale)))
+	}
+
+	metrics.WriteString("# HELP vnstat_upstream_last_success_timestamp_seconds Unix time of the last successful poll\n")
+	metrics.WriteString("# TYPE vnstat_upstream_last_success_timestamp_seconds gauge\n")
+	for _, host := range view.Hosts {
+		if host.LastSuccess != nil {
+			metrics.WriteString(fmt.Sprintf("vnstat_upstream_last_success_timestamp_seconds{hostname=\"%s\"} %d\n", escapeLabelValue(host.Name), host.LastSuccess.Unix()))
+		}
+	}
+
+	return metrics.String()
+}
+
+// handleFleet handles /fleet endpoint, returns per-host traffic, fleet totals and upstream health
+func (s *Server) handleFleet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s.aggregator.Fleet())
+}
+
+// handleFleetJSON handles /fleet/json endpoint, returns the raw vnstat JSON of every upstream (or one with ?host=)
+func (s *Server) handleFleetJSON(w http.ResponseWriter, r *http.Request) {
+	raw := s.aggregator.RawJSON()
+	w.Header().Set("Content-Type", "application/json")
+
+	if host := r.URL.Query().Get("host"); host != "" {
+		data, ok := raw[host]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("no data for host %q", host),
+			})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"hosts": raw,
+	})
+}
+
+// escapeLabelValue escapes a Prometheus label value
+func escapeLabelValue(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return strings.ReplaceAll(s, "\n", "\\n")
+}
+
+// boolToInt converts a bool to 0 or 1 for gauge values
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseUpstream(t *testing.T) {
+	tests := []struct {
+		spec string
+		name string
+		url  string
+	}{
+		{"web1=https://web1.example.com:8080?token=T1", "web1", "https://web1.example.com:8080?token=T1"},
+		{"  http://10.0.0.2:8080  ", "10.0.0.2", "http://10.0.0.2:8080"},
+		{"https://web2.example.com/vnstat/?token=a=b", "web2.example.com", "https://web2.example.com/vnstat/?token=a=b"},
+		{"db=http://[2001:db8::1]:8080", "db", "http://[2001:db8::1]:8080"},
+	}
+	for _, tt := range tests {
+		upstream, err := parseUpstream(tt.spec)
+		if err != nil {
+			t.Errorf("parseUpstream(%q): %v", tt.spec, err)
+			continue
+		}
+		if upstream.Name != tt.name || upstream.URL != tt.url {
+			t.Errorf("parseUpstream(%q) = %+v, want name %q and URL %q", tt.spec, upstream, tt.name, tt.url)
+		}
+	}
+
+	for _, spec := range []string{"ftp://web1.example.com", "web1=web1.example.com:8080", "web1=", "https://", "://x"} {
+		if _, err := parseUpstream(spec); err == nil {
+			t.Errorf("parseUpstream(%q) accepted", spec)
+		}
+	}
+}
+
+func TestLoadUpstreams(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "upstreams.txt")
+	content := "# fleet\n\nweb1=https://web1.example.com?token=T1\n   \n  # indented comment\n  http://web2.example.com:8080  \n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	upstreams, err := loadUpstreams([]string{"local=http://localhost:8080"}, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, upstream := range upstreams {
+		names = append(names, upstream.Name)
+	}
+	if want := []string{"local", "web1", "web2.example.com"}; !slices.Equal(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	if _, err := loadUpstreams([]string{"web1=http://a.example.com"}, file); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("duplicate name: error = %v", err)
+	}
+	if _, err := loadUpstreams(nil, filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestAggregatorFleetMetrics(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/vnstat/json" || r.URL.Query().Get("token") != "T1" {
+			http.Error(w, "unexpected request "+r.URL.String(), http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(testVnstatJSON))
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	upstreams, err := loadUpstreams([]string{"web1=" + healthy.URL + "/vnstat/?token=T1", "web2=" + failing.URL}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aggregator := NewAggregator(upstreams, time.Minute, 3*time.Minute)
+	aggregator.pollAll()
+
+	metrics := aggregator.generatePrometheusMetrics()
+	for _, line := range []string{
+		`vnstat_traffic_total_bytes{hostname="web1",interface="eth0",direction="rx"} 8000000000`,
+		`vnstat_traffic_total_bytes{hostname="web1",interface="eth0",direction="tx"} 2000000000`,
+		`vnstat_traffic_month_bytes{hostname="web1",interface="eth0",direction="rx"} 50000000`,
+		`vnstat_traffic_today_bytes{hostname="web1",interface="eth0",direction="tx"} 900000`,
+		`vnstat_upstream_up{hostname="web1"} 1`,
+		`vnstat_upstream_up{hostname="web2"} 0`,
+		`vnstat_upstream_stale{hostname="web1"} 0`,
+		`vnstat_upstream_stale{hostname="web2"} 1`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("missing %s", line)
+		}
+	}
+	if strings.Contains(metrics, `hostname="web2",interface`) {
+		t.Error("traffic series for the failing upstream")
+	}
+	if !strings.Contains(metrics, `vnstat_upstream_last_success_timestamp_seconds{hostname="web1"}`) ||
+		strings.Contains(metrics, `vnstat_upstream_last_success_timestamp_seconds{hostname="web2"}`) {
+		t.Error("last success timestamp must be reported for web1 only")
+	}
+
+	if fresh, stale := aggregator.upstreamFreshness(time.Now()); fresh != 1 || !slices.Equal(stale, []string{"web2"}) {
+		t.Errorf("freshness = %d fresh, stale %v; want 1 fresh, stale [web2]", fresh, stale)
+	}
+	// Data older than the threshold is stale even after a successful poll
+	if fresh, stale := aggregator.upstreamFreshness(time.Now().Add(4 * time.Minute)); fresh != 0 || len(stale) != 2 {
+		t.Errorf("freshness later = %d fresh, stale %v; want all stale", fresh, stale)
+	}
+
+	fleet := aggregator.Fleet()
+	if fleet.Totals.Hosts != 2 || fleet.Totals.HealthyHosts != 1 || fleet.Totals.StaleHosts != 1 || fleet.Hosts[1].LastError != "status 500" {
+		t.Errorf("fleet totals = %+v, web2 error %q", fleet.Totals, fleet.Hosts[1].LastError)
+	}
+}
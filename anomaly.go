@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// anomalyMinDeviation is the smallest distance from the baseline median (in bytes) that can be flagged,
+// so near-idle interfaces do not report noise as anomalies
+const anomalyMinDeviation = 1 << 20
+
+// anomalyBaseline is the rolling window of preceding periods a period is compared against
+type anomalyBaseline struct {
+	Window     time.Duration // How far back the baseline reaches
+	MinSamples int           // Periods needed in the window before scoring
+}
+
+// anomalyGranularities lists the granularities checked for anomalies
+var anomalyGranularities = []string{"hour", "day"}
+
+// anomalyBaselines holds the baseline window of each checked granularity
+var anomalyBaselines = map[string]anomalyBaseline{
+	"hour": {Window: 48 * time.Hour, MinSamples: 24},
+	"day":  {Window: 28 * 24 * time.Hour, MinSamples: 7},
+}
+
+// anomalyScore is the robust z-score of one direction of one period against its baseline
+type anomalyScore struct {
+	Start     time.Time
+	End       time.Time
+	Direction string // rx or tx
+	Value     float64
+	Median    float64 // Median of the baseline
+	MAD       float64 // Median absolute deviation of the baseline
+	Score     float64 // Positive above the baseline, negative below
+	Partial   bool    // The period is still in progress
+}
+
+// flagged reports whether the score is an anomaly at the given threshold
+// In-progress periods can only be flagged high, their traffic is still growing
+func (a anomalyScore) flagged(threshold float64) bool {
+	if math.Abs(a.Score) < threshold || math.Abs(a.Value-a.Median) < anomalyMinDeviation {
+		return false
+	}
+	return !a.Partial || a.Score > 0
+}
+
+// robustScore returns the modified z-score of value against baseline using the median absolute deviation
+// Falls back to the mean absolute deviation when more than half of the baseline is identical
+func robustScore(value float64, baseline []float64) (score, median, mad float64, ok bool) {
+	median = medianOf(baseline)
+	deviations := make([]float64, len(baseline))
+	for i, v := range baseline {
+		deviations[i] = math.Abs(v - median)
+	}
+	mad = medianOf(deviations)
+
+	switch {
+	case mad > 0:
+		score = 0.6745 * (value - median) / mad
+	case average(deviations) > 0:
+		score = (value - median) / (1.253314 * average(deviations))
+	default:
+		// A constant baseline has no spread to compare against
+		return 0, median, mad, false
+	}
+	return score, median, mad, true
+}
+
+// medianOf returns the median of values without modifying them
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// scoreTraffic scores every period of the granularity that has enough preceding periods in its baseline window
+// Periods missing from the data are left out of the baseline rather than counted as zero
+func scoreTraffic(traffic TrafficData, granularity string, now time.Time) []anomalyScore {
+	baseline, ok := anomalyBaselines[granularity]
+	if !ok {
+		return nil
+	}
+	entries, _ := traffic.Entries(granularity)
+	entries = append([]TrafficEntry(nil), entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Start().Before(entries[j].Start()) })
+
+	var scores []anomalyScore
+	for i, entry := range entries {
+		start := entry.Start()
+		windowStart := start.Add(-baseline.Window)
+
+		var rx, tx []float64
+		for j := i - 1; j >= 0 && !entries[j].Start().Before(windowStart); j-- {
+			rx = append(rx, float64(entries[j].Rx))
+			tx = append(tx, float64(entries[j].Tx))
+		}
+		if len(rx) < baseline.MinSamples {
+			continue
+		}
+
+		end := periodEnd(start, granularity)
+		directions := []struct {
+			name     string
+			value    float64
+			baseline []float64
+		}{{"rx", float64(entry.Rx), rx}, {"tx", float64(entry.Tx), tx}}
+		for _, d := range directions {
+			score, median, mad, ok := robustScore(d.value, d.baseline)
+			if !ok {
+				continue
+			}
+			scores = append(scores, anomalyScore{
+				Start:     start,
+				End:       end,
+				Direction: d.name,
+				Value:     d.value,
+				Median:    median,
+				MAD:       mad,
+				Score:     score,
+				Partial:   end.After(now),
+			})
+		}
+	}
+	return scores
+}
+
+// anomalySummary is one flagged period in the /anomalies response
+type anomalySummary struct {
+	Interface       string  `json:"interface"`
+	Granularity     string  `json:"granularity"`
+	PeriodStart     string  `json:"period_start"`
+	PeriodEnd       string  `json:"period_end"`
+	Direction       string  `json:"direction"`
+	Kind            string  `json:"kind"` // high or low
+	Partial         bool    `json:"partial"`
+	Bytes           uint64  `json:"bytes"`
+	BytesFormatted  string  `json:"bytes_formatted"`
+	Median          uint64  `json:"median"`
+	MedianFormatted string  `json:"median_formatted"`
+	MAD             uint64  `json:"mad"`
+	Score           float64 `json:"score"`
+}
+
+// anomalyReport is the /anomalies response
+type anomalyReport struct {
+	Threshold float64          `json:"threshold"`
+	Generated int64            `json:"generated"`
+	Anomalies []anomalySummary `json:"anomalies"`
+}
+
+// buildAnomalyReport lists the flagged periods of the selected interfaces and granularities, newest first
+func buildAnomalyReport(data *VnstatData, interfaces, granularities []string, threshold float64, units unitOptions, now time.Time) anomalyReport {
+	report := anomalyReport{
+		Threshold: threshold,
+		Generated: now.Unix(),
+		Anomalies: []anomalySummary{},
+	}
+
+	for _, iface := range data.Interfaces {
+		if len(interfaces) > 0 && !containsString(interfaces, iface.Name) {
+			continue
+		}
+		for _, granularity := range granularities {
+			for _, score := range scoreTraffic(iface.Traffic, granularity, now) {
+				if !score.flagged(threshold) {
+					continue
+				}
+				kind := "high"
+				if score.Score < 0 {
+					kind = "low"
+				}
+				report.Anomalies = append(report.Anomalies, anomalySummary{
+					Interface:       iface.Name,
+					Granularity:     granularity,
+					PeriodStart:     score.Start.Format(time.RFC3339),
+					PeriodEnd:       score.End.Format(time.RFC3339),
+					Direction:       score.Direction,
+					Kind:            kind,
+					Partial:         score.Partial,
+					Bytes:           uint64(score.Value),
+					BytesFormatted:  units.Volume(score.Value),
+					Median:          uint64(score.Median),
+					MedianFormatted: units.Volume(score.Median),
+					MAD:             uint64(score.MAD),
+					Score:           roundTo(score.Score, 2),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(report.Anomalies, func(i, j int) bool {
+		a, b := report.Anomalies[i], report.Anomalies[j]
+		if a.PeriodStart != b.PeriodStart {
+			return a.PeriodStart > b.PeriodStart
+		}
+		return a.Interface < b.Interface
+	})
+	return report
+}
+
+// handleAnomalies handles /anomalies endpoint, returns hours and days whose traffic deviates from the rolling baseline
+// Query options: interface (comma-separated filter), granularity (hour|day, default both), threshold (score, default -anomaly-threshold),
+// units (iec|si|bytes)
+func (s *Server) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	units, err := parseUnitOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	granularities := anomalyGranularities
+	if granularity := query.Get("granularity"); granularity != "" {
+		if _, ok := anomalyBaselines[granularity]; !ok {
+			http.Error(w, fmt.Sprintf("Invalid granularity: expected one of %s", strings.Join(anomalyGranularities, ", ")), http.StatusBadRequest)
+			return
+		}
+		granularities = []string{granularity}
+	}
+
+	threshold := s.anomalyThreshold
+	if value := query.Get("threshold"); value != "" {
+		threshold, err = strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 || math.IsInf(threshold, 0) {
+			http.Error(w, "Invalid threshold: expected a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var interfaces []string
+	if filter := query.Get("interface"); filter != "" {
+		for _, name := range strings.Split(filter, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				interfaces = append(interfaces, name)
+			}
+		}
+	}
+
+	jsonData, err := s.service.GetJSON()
+	if err != nil {
+		slog.Error("Failed to get JSON data for anomalies", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	data, err := parseVnstatData(jsonData)
+	if err != nil {
+		slog.Error("Failed to parse JSON data", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(buildAnomalyReport(data, interfaces, granularities, threshold, units, time.Now()))
+}
+
+// generateAnomalyMetrics renders anomaly gauges in Prometheus format
+// The score is that of the latest complete period, active also considers the period in progress
+func generateAnomalyMetrics(data *VnstatData, threshold float64, labels *labelConfig, now time.Time) string {
+	var metrics strings.Builder
+
+	type seriesState struct {
+		labels string
+		score  float64
+		active bool
+	}
+	var series []seriesState
+	for _, iface := range data.Interfaces {
+		for _, granularity := range anomalyGranularities {
+			latest := make(map[string]*seriesState)
+			for _, score := range scoreTraffic(iface.Traffic, granularity, now) {
+				state := latest[score.Direction]
+				if state == nil {
+					state = &seriesState{labels: fmt.Sprintf("%s,granularity=\"%s\",direction=\"%s\"", labels.interfaceLabels(iface.Name), granularity, score.Direction)}
+					latest[score.Direction] = state
+				}
+				// Scores are in chronological order, so the last complete one wins
+				if score.Partial {
+					state.active = state.active || score.flagged(threshold)
+				} else {
+					state.score = score.Score
+					state.active = score.flagged(threshold)
+				}
+			}
+			for _, direction := range []string{"rx", "tx"} {
+				if state := latest[direction]; state != nil {
+					series = append(series, *state)
+				}
+			}
+		}
+	}
+	sort.SliceStable(series, func(i, j int) bool { return series[i].labels < series[j].labels })
+
+	metrics.WriteString("# HELP vnstat_anomaly_threshold Score above which a period is flagged as anomalous\n")
+	metrics.WriteString("# TYPE vnstat_anomaly_threshold gauge\n")
+	metrics.WriteString(fmt.Sprintf("vnstat_anomaly_threshold%s %g\n", labels.externalLabels(), threshold))
+
+	metrics.WriteString("# HELP vnstat_anomaly_score Robust z-score of the latest complete period against its rolling baseline\n")
+	metrics.WriteString("# TYPE vnstat_anomaly_score gauge\n")
+	for _, state := range series {
+		metrics.WriteString(fmt.Sprintf("vnstat_anomaly_score{%s} %.2f\n", state.labels, state.score))
+	}
+
+	metrics.WriteString("# HELP vnstat_anomaly_active Whether the latest complete or the current period is anomalous (1) or not (0)\n")
+	metrics.WriteString("# TYPE vnstat_anomaly_active gauge\n")
+	for _, state := range series {
+		active := 0
+		if state.active {
+			active = 1
+		}
+		metrics.WriteString(fmt.Sprintf("vnstat_anomaly_active{%s} %d\n", state.labels, active))
+	}
+
+	return metrics.String()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRobustScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    float64
+		baseline []float64
+		score    float64
+		median   float64
+		mad      float64
+		ok       bool
+	}{
+		// Median 14, deviations 4 2 0 2 4
+		{"median absolute deviation", 24, []float64{18, 10, 14, 12, 16}, 0.6745 * 10 / 2, 14, 2, true},
+		{"below the baseline", 10, []float64{18, 10, 14, 12, 16}, 0.6745 * -4 / 2, 14, 2, true},
+		{"even baseline length", 4.5, []float64{1, 2, 3, 4}, 0.6745 * 2 / 1, 2.5, 1, true},
+		// Most of the baseline is identical: MAD is 0, the mean absolute deviation (4/5) is not
+		{"mean absolute deviation fallback", 9, []float64{5, 5, 9, 5, 5}, 4 / (1.253314 * 0.8), 5, 0, true},
+		{"constant baseline", 100, []float64{7, 7, 7, 7}, 0, 7, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, median, mad, ok := robustScore(tt.value, tt.baseline)
+			if ok != tt.ok || math.Abs(score-tt.score) > 1e-9 || median != tt.median || mad != tt.mad {
+				t.Errorf("robustScore = %v, %v, %v, %v; want %v, %v, %v, %v", score, median, mad, ok, tt.score, tt.median, tt.mad, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAnomalyFlagged(t *testing.T) {
+	const threshold = 3.5
+	tests := []struct {
+		name  string
+		score anomalyScore
+		want  bool
+	}{
+		{"at the threshold", anomalyScore{Score: 3.5, Value: 10 << 20}, true},
+		{"just below the threshold", anomalyScore{Score: math.Nextafter(3.5, 0), Value: 10 << 20}, false},
+		{"low at the threshold", anomalyScore{Score: -3.5, Value: 0, Median: 10 << 20}, true},
+		{"deviation of exactly 1 MiB", anomalyScore{Score: 50, Value: 2 << 20, Median: 1 << 20}, true},
+		{"deviation under 1 MiB", anomalyScore{Score: 50, Value: 2<<20 - 1, Median: 1 << 20}, false},
+		{"partial high", anomalyScore{Score: 4, Value: 10 << 20, Partial: true}, true},
+		{"partial low", anomalyScore{Score: -4, Value: 0, Median: 10 << 20, Partial: true}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.score.flagged(threshold); got != tt.want {
+			t.Errorf("%s: flagged = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// anomalyTestTraffic has daily rx of 100, 110 and 120 MB in turn from October 1 to 17 and constant tx,
+// a 400 MB spike on the 18th and a nearly idle 19th, which is in progress at anomalyTestNow
+func anomalyTestTraffic() TrafficData {
+	var traffic TrafficData
+	for day := 1; day <= 19; day++ {
+		rx := uint64(100e6 + (day%3)*10e6)
+		switch day {
+		case 18:
+			rx = 400e6
+		case 19:
+			rx = 1e6
+		}
+		traffic.Day = append(traffic.Day, TrafficEntry{Date: EntryDate{Year: 2026, Month: 10, Day: day}, Rx: rx, Tx: 5e6})
+	}
+	return traffic
+}
+
+// anomalyTestNow is noon on October 19
+var anomalyTestNow = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestScoreTraffic(t *testing.T) {
+	localUTC(t)
+	traffic := anomalyTestTraffic()
+	scores := scoreTraffic(traffic, "day", anomalyTestNow)
+
+	// Days with fewer than 7 earlier days are skipped, and the constant tx baseline is never scored
+	if len(scores) != 12 {
+		t.Fatalf("got %d scores, want 12 (rx of October 8-19)", len(scores))
+	}
+	for i, score := range scores {
+		if score.Direction != "rx" || score.Start.Day() != 8+i {
+			t.Errorf("score %d is %s of %v", i, score.Direction, score.Start)
+		}
+		if score.Partial != (score.Start.Day() == 19) {
+			t.Errorf("%v: partial = %v", score.Start, score.Partial)
+		}
+	}
+
+	// October 1-17: 5 days of 100 MB, 6 of 110 MB and 6 of 120 MB, so the median is 110 MB and the MAD 10 MB
+	spike := scores[10]
+	if spike.Median != 110e6 || spike.MAD != 10e6 || math.Abs(spike.Score-0.6745*29) > 1e-9 || !spike.flagged(3.5) {
+		t.Errorf("spike = %+v, want median 110e6, MAD 10e6 and score %v", spike, 0.6745*29)
+	}
+	// The idle day in progress scores far below, but a partial period is only flagged high
+	current := scores[11]
+	if current.Score > -3.5 || current.flagged(3.5) {
+		t.Errorf("current day = %+v, want a low score that is not flagged", current)
+	}
+
+	// A missing day is left out of the baseline instead of counting as zero
+	gap := TrafficData{Day: append(append([]TrafficEntry(nil), traffic.Day[:5]...), traffic.Day[6:8]...)}
+	if scores := scoreTraffic(gap, "day", anomalyTestNow); len(scores) != 0 {
+		t.Errorf("6 earlier days with a gap: got %d scores, want none", len(scores))
+	}
+	if scores := scoreTraffic(traffic, "month", anomalyTestNow); scores != nil {
+		t.Errorf("month granularity scored: %+v", scores)
+	}
+}
+
+func TestGenerateAnomalyMetrics(t *testing.T) {
+	localUTC(t)
+	data := &VnstatData{Interfaces: []InterfaceData{{Name: "eth0", Traffic: anomalyTestTraffic()}}}
+
+	// The score is that of the last complete day, the spike; the idle day in progress is not part of it
+	metrics := generateAnomalyMetrics(data, 3.5, nil, anomalyTestNow)
+	for _, line := range []string{
+		"vnstat_anomaly_threshold 3.5",
+		`vnstat_anomaly_score{interface="eth0",granularity="day",direction="rx"} 19.56`,
+		`vnstat_anomaly_active{interface="eth0",granularity="day",direction="rx"} 1`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, metrics)
+		}
+	}
+	if strings.Contains(metrics, `direction="tx"`) || strings.Contains(metrics, `granularity="hour"`) {
+		t.Errorf("series without scores:\n%s", metrics)
+	}
+
+	// With a normal day in progress the complete spike day stays active
+	data.Interfaces[0].Traffic.Day = append(data.Interfaces[0].Traffic.Day[:18], TrafficEntry{Date: EntryDate{Year: 2026, Month: 10, Day: 19}, Rx: 110e6, Tx: 5e6})
+	metrics = generateAnomalyMetrics(data, 3.5, nil, anomalyTestNow)
+	if !strings.Contains(metrics, `vnstat_anomaly_active{interface="eth0",granularity="day",direction="rx"} 1`+"\n") {
+		t.Errorf("the complete spike day is no longer active:\n%s", metrics)
+	}
+	// Once the normal day is complete it is the latest score, the spike only widens its baseline
+	metrics = generateAnomalyMetrics(data, 3.5, nil, anomalyTestNow.AddDate(0, 0, 1))
+	if !strings.Contains(metrics, `vnstat_anomaly_active{interface="eth0",granularity="day",direction="rx"} 0`+"\n") {
+		t.Errorf("a normal complete day is active:\n%s", metrics)
+	}
+}
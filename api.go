@@ -0,0 +1,317 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// openAPIDocument describes the /api/v1 routes, embedded so it is always served with the matching binary
+//
+//go:embed api/openapi.json
+var openAPIDocument []byte
+
+// Error codes of the /api/v1 error envelope
+const (
+	apiCodeInvalidParameter = "invalid_parameter"
+	apiCodeUnauthorized     = "unauthorized"
+	apiCodeNotFound         = "not_found"
+	apiCodeMethodNotAllowed = "method_not_allowed"
+	apiCodeRateLimited      = "rate_limited"
+	apiCodeBackendError     = "backend_error"
+)
+
+// apiErrorEnvelope is the body of every /api/v1 error response
+type apiErrorEnvelope struct {
+	Error apiError `json:"error"`
+}
+
+// apiError describes what went wrong: the HTTP status, a stable machine-readable code and a message
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeAPIJSON writes v as a JSON response
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes the JSON error envelope
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeAPIJSON(w, status, apiErrorEnvelope{Error: apiError{Status: status, Code: code, Message: message}})
+}
+
+// apiRoute is one /api/v1 route; the pattern uses ServeMux syntax, which is also the OpenAPI path syntax
+type apiRoute struct {
+	Pattern string
+	Handler http.HandlerFunc
+}
+
+// apiRoutes lists the /api/v1 routes, each must be described in the OpenAPI document
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{"/api/v1/openapi.json", s.handleOpenAPI},
+		{"/api/v1/interfaces", s.handleAPIInterfaces},
+		{"/api/v1/interfaces/{name}", s.handleAPIInterface},
+		{"/api/v1/interfaces/{name}/traffic/{granularity}", s.handleAPITraffic},
+		{"/api/v1/compare", s.handleCompare},
+	}
+}
+
+// registerAPIRoutes checks the routes against the OpenAPI document and registers them on mux
+func (s *Server) registerAPIRoutes(mux *http.ServeMux) error {
+	routes := s.apiRoutes()
+	if err := validateOpenAPIRoutes(openAPIDocument, routes); err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		mux.Handle(route.Pattern, s.endpointHandler(endpoint{Pattern: route.Pattern, Handler: route.Handler, Errors: apiErrors}))
+	}
+	// Unknown paths under the namespace get the JSON envelope instead of the plain 404
+	mux.Handle("/api/v1/", s.endpointHandler(endpoint{Pattern: "/api/v1/", Handler: func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, apiCodeNotFound, fmt.Sprintf("No API route for %s", r.URL.Path))
+	}, Errors: apiErrors}))
+	return nil
+}
+
+// apiErrors writes middleware errors of /api/v1 routes as the error envelope
+func apiErrors(w http.ResponseWriter, status int, message string) {
+	code := apiCodeBackendError
+	switch status {
+	case http.StatusBadRequest:
+		code = apiCodeInvalidParameter
+	case http.StatusUnauthorized:
+		code = apiCodeUnauthorized
+	case http.StatusNotFound:
+		code = apiCodeNotFound
+	case http.StatusMethodNotAllowed:
+		code = apiCodeMethodNotAllowed
+	case http.StatusTooManyRequests:
+		code = apiCodeRateLimited
+	}
+	writeAPIError(w, status, code, message)
+}
+
+// openAPISpec is the part of the OpenAPI document checked against the registered routes
+type openAPISpec struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Parameters map[string]openAPIParameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// openAPIOperation is one operation of a path
+type openAPIOperation struct {
+	OperationID string             `json:"operationId"`
+	Parameters  []openAPIParameter `json:"parameters"`
+}
+
+// openAPIParameter is a parameter or a reference to one in components
+type openAPIParameter struct {
+	Ref  string `json:"$ref"`
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+// pathParameterPattern matches {name} segments of a route pattern
+var pathParameterPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// validateOpenAPIRoutes checks that the document describes exactly the registered routes,
+// each with a GET operation declaring the path parameters of its pattern
+func validateOpenAPIRoutes(document []byte, routes []apiRoute) error {
+	var spec openAPISpec
+	if err := json.Unmarshal(document, &spec); err != nil {
+		return fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		return fmt.Errorf("OpenAPI document has version %q, expected 3.x", spec.OpenAPI)
+	}
+
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		registered[route.Pattern] = true
+
+		operations, ok := spec.Paths[route.Pattern]
+		if !ok {
+			return fmt.Errorf("route %s is not described in the OpenAPI document", route.Pattern)
+		}
+		operation, ok := operations["get"]
+		if !ok {
+			return fmt.Errorf("OpenAPI path %s has no get operation", route.Pattern)
+		}
+
+		var declared []string
+		for _, parameter := range operation.Parameters {
+			if parameter.Ref != "" {
+				resolved, ok := spec.Components.Parameters[strings.TrimPrefix(parameter.Ref, "#/components/parameters/")]
+				if !ok {
+					return fmt.Errorf("OpenAPI path %s references unknown parameter %s", route.Pattern, parameter.Ref)
+				}
+				parameter = resolved
+			}
+			if parameter.In == "path" {
+				declared = append(declared, parameter.Name)
+			}
+		}
+		var expected []string
+		for _, match := range pathParameterPattern.FindAllStringSubmatch(route.Pattern, -1) {
+			expected = append(expected, match[1])
+		}
+		sort.Strings(declared)
+		sort.Strings(expected)
+		if strings.Join(declared, ",") != strings.Join(expected, ",") {
+			return fmt.Errorf("OpenAPI path %s declares path parameters [%s], route has [%s]", route.Pattern, strings.Join(declared, ", "), strings.Join(expected, ", "))
+		}
+	}
+
+	for path := range spec.Paths {
+		if !registered[path] {
+			return fmt.Errorf("OpenAPI path %s has no registered route", path)
+		}
+	}
+	return nil
+}
+
+// handleOpenAPI handles /api/v1/openapi.json endpoint, returns the embedded OpenAPI document
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPIDocument)
+}
+
+// apiData fetches and parses the traffic data, writing the error envelope on failure
+func (s *Server) apiData(w http.ResponseWriter) (*VnstatData, bool) {
+	jsonData, err := s.service.GetJSON()
+	if err != nil {
+		slog.Error("Failed to get JSON data for API", "err", err)
+		writeAPIError(w, http.StatusInternalServerError, apiCodeBackendError, err.Error())
+		return nil, false
+	}
+	data, err := parseVnstatData(jsonData)
+	if err != nil {
+		slog.Error("Failed to parse JSON data", "err", err)
+		writeAPIError(w, http.StatusInternalServerError, apiCodeBackendError, err.Error())
+		return nil, false
+	}
+	return data, true
+}
+
+// handleAPIInterfaces handles /api/v1/interfaces endpoint, lists interfaces with totals, current month, today and forecast
+// Query options: units (iec|si|bytes), rate (bits|bytes)
+func (s *Server) handleAPIInterfaces(w http.ResponseWriter, r *http.Request) {
+	units, err := parseUnitOptions(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiCodeInvalidParameter, err.Error())
+		return
+	}
+
+	data, ok := s.apiData(w)
+	if !ok {
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, buildTrafficSummary(data, units, *s.forecastConfig(), s.service.labels, time.Now()))
+}
+
+// handleAPIInterface handles /api/v1/interfaces/{name} endpoint, returns one interface of the list
+// Query options: units (iec|si|bytes), rate (bits|bytes)
+func (s *Server) handleAPIInterface(w http.ResponseWriter, r *http.Request) {
+	units, err := parseUnitOptions(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiCodeInvalidParameter, err.Error())
+		return
+	}
+
+	data, ok := s.apiData(w)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	summary := buildTrafficSummary(data, units, *s.forecastConfig(), s.service.labels, time.Now())
+	for _, iface := range summary.Interfaces {
+		if iface.Name == name {
+			writeAPIJSON(w, http.StatusOK, iface)
+			return
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, apiCodeNotFound, fmt.Sprintf("Interface %q not found", name))
+}
+
+// apiTrafficResponse is the /api/v1/interfaces/{name}/traffic/{granularity} response
+type apiTrafficResponse struct {
+	Interface   string          `json:"interface"`
+	Granularity string          `json:"granularity"`
+	Units       string          `json:"units"`
+	Entries     []trafficPeriod `json:"entries"`
+}
+
+// handleAPITraffic handles /api/v1/interfaces/{name}/traffic/{granularity} endpoint, returns the entries of one granularity
+// Query options: from and to (YYYY-MM-DD or RFC 3339, inclusive), units (iec|si|bytes)
+func (s *Server) handleAPITraffic(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	units, err := parseUnitOptions(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiCodeInvalidParameter, err.Error())
+		return
+	}
+
+	granularity := r.PathValue("granularity")
+	if _, ok := (TrafficData{}).Entries(granularity); !ok {
+		writeAPIError(w, http.StatusNotFound, apiCodeNotFound, fmt.Sprintf("Unknown granularity %q: expected one of %s", granularity, strings.Join(trafficGranularities, ", ")))
+		return
+	}
+
+	var dateRange exportRange
+	if from := query.Get("from"); from != "" {
+		if dateRange.From, err = parseExportTime(from, false); err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiCodeInvalidParameter, "Invalid from: "+err.Error())
+			return
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if dateRange.To, err = parseExportTime(to, true); err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiCodeInvalidParameter, "Invalid to: "+err.Error())
+			return
+		}
+	}
+
+	data, ok := s.apiData(w)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	iface := data.Interface(name)
+	if iface == nil {
+		writeAPIError(w, http.StatusNotFound, apiCodeNotFound, fmt.Sprintf("Interface %q not found", name))
+		return
+	}
+
+	now := time.Now()
+	response := apiTrafficResponse{
+		Interface:   iface.Name,
+		Granularity: granularity,
+		Units:       units.Units,
+		Entries:     []trafficPeriod{},
+	}
+	entries, _ := iface.Traffic.Entries(granularity)
+	for _, entry := range entries {
+		start := entry.Start()
+		if dateRange.contains(start) {
+			response.Entries = append(response.Entries, newTrafficPeriod(start, periodEnd(start, granularity), entry.Rx, entry.Tx, units, now))
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testVnstatJSON is the output of the fake vnstat used by the handler tests
+const testVnstatJSON = `{
+  "vnstatversion": "2.12",
+  "jsonversion": "2",
+  "interfaces": [{
+    "name": "eth0",
+    "alias": "",
+    "created": {"date": {"year": 2025, "month": 1, "day": 3}, "timestamp": 1735862400},
+    "updated": {"date": {"year": 2026, "month": 10, "day": 19}, "time": {"hour": 14, "minute": 35}, "timestamp": 1792420500},
+    "traffic": {
+      "total": {"rx": 8000000000, "tx": 2000000000},
+      "fiveminute": [{"id": 1, "date": {"year": 2026, "month": 10, "day": 19}, "time": {"hour": 14, "minute": 30}, "timestamp": 1792420200, "rx": 1000, "tx": 500}],
+      "hour": [{"id": 1, "date": {"year": 2026, "month": 10, "day": 19}, "time": {"hour": 14, "minute": 0}, "timestamp": 1792418400, "rx": 100000, "tx": 50000}],
+      "day": [
+        {"id": 1, "date": {"year": 2026, "month": 10, "day": 18}, "timestamp": 1792281600, "rx": 3000000, "tx": 1000000},
+        {"id": 2, "date": {"year": 2026, "month": 10, "day": 19}, "timestamp": 1792368000, "rx": 2000000, "tx": 900000}
+      ],
+      "month": [
+        {"id": 1, "date": {"year": 2026, "month": 9}, "timestamp": 1788220800, "rx": 90000000, "tx": 30000000},
+        {"id": 2, "date": {"year": 2026, "month": 10}, "timestamp": 1790812800, "rx": 50000000, "tx": 20000000}
+      ],
+      "year": [{"id": 1, "date": {"year": 2026}, "timestamp": 1767225600, "rx": 140000000, "tx": 50000000}],
+      "top": []
+    }
+  }]
+}`
+
+// fakeVnstat puts a vnstat script printing output first on PATH for the rest of the test
+func fakeVnstat(t *testing.T, output string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "vnstat.json"), []byte(output), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\ncat '" + filepath.Join(dir, "vnstat.json") + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "vnstat"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// newTestServer returns a server with token "secret" whose vnstat is a script printing testVnstatJSON
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	fakeVnstat(t, testVnstatJSON)
+	return NewServer("secret", NewVnstatService(""))
+}
+
+// documentedResponses returns the response status codes the OpenAPI document lists per GET path
+func documentedResponses(t *testing.T) map[string]map[string]bool {
+	t.Helper()
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Responses map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPIDocument, &spec); err != nil {
+		t.Fatalf("parse OpenAPI document: %v", err)
+	}
+	responses := make(map[string]map[string]bool)
+	for path, operations := range spec.Paths {
+		responses[path] = make(map[string]bool)
+		for status := range operations["get"].Responses {
+			responses[path][status] = true
+		}
+	}
+	return responses
+}
+
+// examplePath fills the path parameters of a route pattern with values present in testVnstatJSON
+func examplePath(pattern string) string {
+	return strings.NewReplacer("{name}", "eth0", "{granularity}", "day").Replace(pattern)
+}
+
+// serve sends a request through the server's full handler
+func serve(t *testing.T, handler http.Handler, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+// checkAPIError asserts the status of a response and that its body is the error envelope with the given code
+func checkAPIError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, status, rec.Body)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	decoder := json.NewDecoder(rec.Body)
+	decoder.DisallowUnknownFields()
+	var envelope apiErrorEnvelope
+	if err := decoder.Decode(&envelope); err != nil {
+		t.Fatalf("body is not the error envelope: %v", err)
+	}
+	if envelope.Error.Status != status || envelope.Error.Code != code || envelope.Error.Message == "" {
+		t.Errorf("envelope = %+v, want status %d and code %q with a message", envelope.Error, status, code)
+	}
+}
+
+func TestOpenAPIDocumentMatchesRoutes(t *testing.T) {
+	s := NewServer("", NewVnstatService(""))
+	if err := validateOpenAPIRoutes(openAPIDocument, s.apiRoutes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A route missing from the document and a document path without a route are both rejected
+	extra := append(s.apiRoutes(), apiRoute{Pattern: "/api/v1/undocumented"})
+	if err := validateOpenAPIRoutes(openAPIDocument, extra); err == nil {
+		t.Error("undocumented route accepted")
+	}
+	if err := validateOpenAPIRoutes(openAPIDocument, s.apiRoutes()[1:]); err == nil {
+		t.Error("document path without route accepted")
+	}
+}
+
+func TestAPIRoutes(t *testing.T) {
+	s := newTestServer(t)
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := documentedResponses(t)
+
+	for _, route := range s.apiRoutes() {
+		documented := responses[route.Pattern]
+		path := examplePath(route.Pattern)
+
+		t.Run(route.Pattern, func(t *testing.T) {
+			if !documented["200"] {
+				t.Errorf("200 is not documented")
+			}
+			rec := serve(t, handler, "GET", path+"?token=secret")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s: status = %d, want 200 (body %s)", path, rec.Code, rec.Body)
+			}
+			if !json.Valid(rec.Body.Bytes()) {
+				t.Errorf("GET %s: body is not JSON", path)
+			}
+
+			if !documented["401"] {
+				t.Errorf("401 is not documented")
+			}
+			checkAPIError(t, serve(t, handler, "GET", path), http.StatusUnauthorized, apiCodeUnauthorized)
+			checkAPIError(t, serve(t, handler, "GET", path+"?token=wrong"), http.StatusUnauthorized, apiCodeUnauthorized)
+
+			checkAPIError(t, serve(t, handler, "POST", path+"?token=secret"), http.StatusMethodNotAllowed, apiCodeMethodNotAllowed)
+
+			if documented["400"] {
+				checkAPIError(t, serve(t, handler, "GET", path+"?token=secret&units=bogus"), http.StatusBadRequest, apiCodeInvalidParameter)
+			}
+		})
+	}
+}
+
+func TestAPINotFound(t *testing.T) {
+	s := newTestServer(t)
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := documentedResponses(t)
+
+	tests := []struct {
+		name    string
+		pattern string // Documented route the 404 belongs to, "" for paths outside every route
+		target  string
+	}{
+		{"unknown interface", "/api/v1/interfaces/{name}", "/api/v1/interfaces/missing"},
+		{"unknown interface traffic", "/api/v1/interfaces/{name}/traffic/{granularity}", "/api/v1/interfaces/missing/traffic/day"},
+		{"unknown granularity", "/api/v1/interfaces/{name}/traffic/{granularity}", "/api/v1/interfaces/eth0/traffic/minute"},
+		{"unknown route", "", "/api/v1/nothing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.pattern != "" && !responses[tt.pattern]["404"] {
+				t.Errorf("404 is not documented for %s", tt.pattern)
+			}
+			checkAPIError(t, serve(t, handler, "GET", tt.target+"?token=secret"), http.StatusNotFound, apiCodeNotFound)
+		})
+	}
+}
+
+func TestAPIInvalidParameters(t *testing.T) {
+	s := newTestServer(t)
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{
+		"/api/v1/interfaces?rate=nibbles",
+		"/api/v1/interfaces/eth0/traffic/day?from=yesterday",
+		"/api/v1/interfaces/eth0/traffic/day?to=2026-13-01",
+		"/api/v1/compare?period=decade",
+		"/api/v1/compare?offset=0",
+	} {
+		t.Run(target, func(t *testing.T) {
+			checkAPIError(t, serve(t, handler, "GET", target+"&token=secret"), http.StatusBadRequest, apiCodeInvalidParameter)
+		})
+	}
+}
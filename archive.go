@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveFileName is the JSON lines file inside the archive directory
+const archiveFileName = "archive.jsonl"
+
+// archiveRecord is one line of the archive: the traffic of one interface for one period
+// Later lines for the same key replace earlier ones (the current period grows between snapshots)
+type archiveRecord struct {
+	Interface   string     `json:"interface"`
+	Granularity string     `json:"granularity"`
+	Timestamp   int64      `json:"timestamp"` // Period start (unix seconds)
+	Date        EntryDate  `json:"date"`
+	Time        *EntryTime `json:"time,omitempty"`
+	Rx          uint64     `json:"rx"`
+	Tx          uint64     `json:"tx"`
+}
+
+// archiveKey identifies a period of an interface
+type archiveKey struct {
+	Interface   string
+	Granularity string
+	Timestamp   int64
+}
+
+// key returns the identity of the record
+func (r archiveRecord) key() archiveKey {
+	return archiveKey{Interface: r.Interface, Granularity: r.Granularity, Timestamp: r.Timestamp}
+}
+
+// Archive keeps an append-only history of vnstat entries so data pruned by vnstat is not lost
+type Archive struct {
+	path      string
+	retention map[string]time.Duration // Per granularity, 0 keeps forever
+
+	mu         sync.Mutex
+	records    map[archiveKey]archiveRecord
+	superseded int             // Lines in the file that were replaced by later lines
+	history    *archiveHistory // Merge view of records, rebuilt when records change
+	rebuilt    bool            // history was rebuilt since the last Merge
+}
+
+// archiveHistory is the archive grouped for merging; it is never modified after it is built
+type archiveHistory struct {
+	entries map[string]map[string][]TrafficEntry // Interface -> granularity -> entries, oldest first
+	topDays map[string][]TrafficEntry            // Interface -> archived days, highest traffic first
+}
+
+// parseArchiveRetention parses "granularity=age,..." where age is a Go duration, a number of days ("30d") or 0 to keep forever
+// Granularities not listed are kept forever
+func parseArchiveRetention(spec string) (map[string]time.Duration, error) {
+	retention := make(map[string]time.Duration)
+	if strings.TrimSpace(spec) == "" {
+		return retention, nil
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid retention %q (expected granularity=age)", item)
+		}
+		if _, known := (TrafficData{}).Entries(name); !known {
+			return nil, fmt.Errorf("invalid retention granularity %q (must be one of %s)", name, strings.Join(trafficGranularities, ", "))
+		}
+
+		var age time.Duration
+		if days, isDays := strings.CutSuffix(value, "d"); isDays {
+			n, err := strconv.Atoi(days)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid retention age %q", value)
+			}
+			age = time.Duration(n) * 24 * time.Hour
+		} else if value != "0" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid retention age %q", value)
+			}
+			age = d
+		}
+		retention[name] = age
+	}
+	return retention, nil
+}
+
+// NewArchive opens the archive in dir, loading existing records
+func NewArchive(dir string, retention map[string]time.Duration) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %v", err)
+	}
+
+	a := &Archive{
+		path:      filepath.Join(dir, archiveFileName),
+		retention: retention,
+		records:   make(map[archiveKey]archiveRecord),
+	}
+
+	f, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		a.rebuildHistory()
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record archiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A partial last line can be left behind by a crash during append
+			slog.Warn("Archive: skipping invalid line", "line", line, "err", err)
+			continue
+		}
+		if _, exists := a.records[record.key()]; exists {
+			a.superseded++
+		}
+		a.records[record.key()] = record
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %v", err)
+	}
+
+	a.rebuildHistory()
+	return a, nil
+}
+
+// Start snapshots the data returned by fetch immediately and then on every interval
+func (a *Archive) Start(interval time.Duration, fetch func() ([]byte, error)) {
+	snapshot := func() {
+		jsonData, err := fetch()
+		if err != nil {
+			slog.Error("Archive: failed to fetch data", "err", err)
+			return
+		}
+		data, err := parseVnstatData(jsonData)
+		if err != nil {
+			slog.Error("Archive: failed to parse data", "err", err)
+			return
+		}
+		if err := a.Snapshot(data, time.Now()); err != nil {
+			slog.Error("Archive: snapshot failed", "err", err)
+		}
+	}
+
+	snapshot()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		snapshot()
+	}
+}
+
+// Snapshot appends new and changed entries, prunes expired ones and compacts the file when worthwhile
+func (a *Archive) Snapshot(data *VnstatData, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var changed []archiveRecord
+	for _, iface := range data.Interfaces {
+		for _, granularity := range trafficGranularities {
+			entries, _ := iface.Traffic.Entries(granularity)
+			for _, entry := range entries {
+				record := archiveRecord{
+					Interface:   iface.Name,
+					Granularity: granularity,
+					Timestamp:   entry.Start().Unix(),
+					Date:        entry.Date,
+					Time:        entry.Time,
+					Rx:          entry.Rx,
+					Tx:          entry.Tx,
+				}
+				if a.expired(record, now) {
+					continue
+				}
+				previous, exists := a.records[record.key()]
+				if exists && previous.Rx == record.Rx && previous.Tx == record.Tx {
+					continue
+				}
+				if exists {
+					a.superseded++
+				}
+				a.records[record.key()] = record
+				changed = append(changed, record)
+			}
+		}
+	}
+
+	pruned := 0
+	for key, record := range a.records {
+		if a.expired(record, now) {
+			delete(a.records, key)
+			pruned++
+		}
+	}
+	if len(changed) > 0 || pruned > 0 {
+		a.rebuildHistory()
+	}
+
+	// Rewrite the file when pruning or when most lines are stale, otherwise append
+	if pruned > 0 || a.superseded > len(a.records) {
+		return a.compact()
+	}
+	return a.appendRecords(changed)
+}
+
+// expired reports whether the record is older than the retention of its granularity
+func (a *Archive) expired(record archiveRecord, now time.Time) bool {
+	age := a.retention[record.Granularity]
+	return age > 0 && time.Unix(record.Timestamp, 0).Before(now.Add(-age))
+}
+
+// appendRecords appends records as JSON lines
+func (a *Archive) appendRecords(records []archiveRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %v", err)
+	}
+
+	writer := bufio.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write archive: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	return f.Close()
+}
+
+// compact rewrites the archive with only the current records (temporary file + rename)
+func (a *Archive) compact() error {
+	records := make([]archiveRecord, 0, len(a.records))
+	for _, record := range a.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Interface != records[j].Interface {
+			return records[i].Interface < records[j].Interface
+		}
+		if records[i].Granularity != records[j].Granularity {
+			return records[i].Granularity < records[j].Granularity
+		}
+		return records[i].Timestamp < records[j].Timestamp
+	})
+
+	tmpPath := a.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to compact archive: %v", err)
+	}
+	writer := bufio.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to compact archive: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to compact archive: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to compact archive: %v", err)
+	}
+	if err := os.Rename(tmpPath, a.path); err != nil {
+		return fmt.Errorf("failed to compact archive: %v", err)
+	}
+
+	a.superseded = 0
+	return nil
+}
+
+// rebuildHistory regroups the records for Merge; the caller holds a.mu
+func (a *Archive) rebuildHistory() {
+	history := &archiveHistory{
+		entries: make(map[string]map[string][]TrafficEntry),
+		topDays: make(map[string][]TrafficEntry),
+	}
+	for _, record := range a.records {
+		entry := TrafficEntry{
+			Date:      record.Date,
+			Time:      record.Time,
+			Timestamp: record.Timestamp,
+			Rx:        record.Rx,
+			Tx:        record.Tx,
+		}
+		if history.entries[record.Interface] == nil {
+			history.entries[record.Interface] = make(map[string][]TrafficEntry)
+		}
+		history.entries[record.Interface][record.Granularity] = append(history.entries[record.Interface][record.Granularity], entry)
+		if record.Granularity == "day" {
+			history.topDays[record.Interface] = append(history.topDays[record.Interface], entry)
+		}
+	}
+	for _, granularities := range history.entries {
+		for _, entries := range granularities {
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Timestamp < entries[j].Timestamp })
+		}
+	}
+	for _, days := range history.topDays {
+		sort.SliceStable(days, func(i, j int) bool { return days[i].Total() > days[j].Total() })
+	}
+	a.history = history
+	a.rebuilt = true
+}
+
+// Merge adds archived entries that are missing from data (vnstat's own values win for periods it still has)
+// and recomputes the top days over the merged history
+func (a *Archive) Merge(data *VnstatData) {
+	a.mu.Lock()
+	history := a.history
+	selfMetrics.cacheLookup("archive", !a.rebuilt) // The first merge after a rebuild counts as a miss
+	a.rebuilt = false
+	a.mu.Unlock()
+
+	for i := range data.Interfaces {
+		iface := &data.Interfaces[i]
+		days := iface.Traffic.Day
+		for granularity, archived := range history.entries[iface.Name] {
+			entries, _ := iface.Traffic.Entries(granularity)
+			iface.Traffic.setEntries(granularity, mergeArchived(entries, archived))
+		}
+		iface.Traffic.Top = mergeTopDays(iface.Traffic.Top, days, history.topDays[iface.Name])
+	}
+}
+
+// Entries returns the archived entries of one interface and granularity, oldest first; the slice must not be modified
+func (a *Archive) Entries(interfaceName, granularity string) []TrafficEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.history.entries[interfaceName][granularity]
+}
+
+// mergeArchived adds archived entries for periods missing from entries (vnstat's own values win), sorted by start
+func mergeArchived(entries, archived []TrafficEntry) []TrafficEntry {
+	if len(archived) == 0 {
+		return entries
+	}
+	present := make(map[int64]bool, len(entries))
+	for _, entry := range entries {
+		present[entry.Start().Unix()] = true
+	}
+	merged := append([]TrafficEntry(nil), entries...)
+	for _, entry := range archived {
+		if !present[entry.Timestamp] {
+			merged = append(merged, entry)
+		}
+	}
+	sort.SliceStable(merged, func(x, y int) bool { return merged[x].Start().Before(merged[y].Start()) })
+	return merged
+}
+
+// mergeTopDays returns the highest-traffic days of vnstat's top list, vnstat's days and the archived days
+// (sorted by traffic), keeping as many entries as vnstat's top list or collectorTopDays when it is empty
+func mergeTopDays(top, days, archived []TrafficEntry) []TrafficEntry {
+	if len(archived) == 0 {
+		return top
+	}
+	size := len(top)
+	if size == 0 {
+		size = collectorTopDays
+	}
+
+	// vnstat's values win; only the first size archived days not known to vnstat can make the list
+	present := make(map[int64]bool, len(top)+len(days))
+	merged := make([]TrafficEntry, 0, len(top)+len(days)+size)
+	for _, entry := range append(append([]TrafficEntry(nil), top...), days...) {
+		if start := entry.Start().Unix(); !present[start] {
+			present[start] = true
+			merged = append(merged, entry)
+		}
+	}
+	added := 0
+	for _, entry := range archived {
+		if added == size {
+			break
+		}
+		if !present[entry.Timestamp] {
+			merged = append(merged, entry)
+			added++
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Total() > merged[j].Total() })
+	if len(merged) > size {
+		merged = merged[:size]
+	}
+	return merged
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// testDay returns a day entry of 2026-10-<day>
+func testDay(day int, rx uint64) TrafficEntry {
+	start := time.Date(2026, 10, day, 0, 0, 0, 0, time.Local)
+	return TrafficEntry{Date: EntryDate{Year: 2026, Month: 10, Day: day}, Timestamp: start.Unix(), Rx: rx}
+}
+
+func TestArchiveMerge(t *testing.T) {
+	dir := t.TempDir()
+	archive, err := NewArchive(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	old := &VnstatData{Interfaces: []InterfaceData{{Name: "eth0", Traffic: TrafficData{
+		Day: []TrafficEntry{testDay(1, 500), testDay(2, 100), testDay(3, 300)},
+	}}}}
+	if err := archive.Snapshot(old, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// vnstat pruned the first days; its value for day 3 wins over the archived one
+	current := &VnstatData{Interfaces: []InterfaceData{{Name: "eth0", Traffic: TrafficData{
+		Day: []TrafficEntry{testDay(3, 400), testDay(4, 200)},
+		Top: []TrafficEntry{testDay(3, 400), testDay(4, 200)},
+	}}}}
+	archive.Merge(current)
+
+	traffic := current.Interfaces[0].Traffic
+	var days, top []uint64
+	for _, entry := range traffic.Day {
+		days = append(days, entry.Rx)
+	}
+	for _, entry := range traffic.Top {
+		top = append(top, entry.Rx)
+	}
+	if want := []uint64{500, 100, 400, 200}; !slices.Equal(days, want) {
+		t.Errorf("days = %v, want %v", days, want)
+	}
+	if want := []uint64{500, 400}; !slices.Equal(top, want) {
+		t.Errorf("top = %v, want %v", top, want)
+	}
+
+	// A reopened archive merges the same history
+	reopened, err := NewArchive(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := &VnstatData{Interfaces: []InterfaceData{{Name: "eth0"}}}
+	reopened.Merge(again)
+	if n := len(again.Interfaces[0].Traffic.Day); n != 3 {
+		t.Errorf("reopened archive merged %d days, want 3", n)
+	}
+	if n := len(again.Interfaces[0].Traffic.Top); n != 3 {
+		t.Errorf("reopened archive merged %d top days, want 3", n)
+	}
+}
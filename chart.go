@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// chartKind describes one chart endpoint and the vnstat traffic array it plots
+type chartKind struct {
+	title         string
+	trafficKey    string // Key in the vnstat traffic object
+	defaultWindow int    // Number of most recent entries shown by default
+	maxWindow     int
+}
+
+// chartKinds maps /chart/<name>.<format> names to their definitions
+var chartKinds = map[string]chartKind{
+	"hourly":  {"Hourly", "hour", 24, 168},
+	"daily":   {"Daily", "day", 30, 366},
+	"monthly": {"Monthly", "month", 12, 120},
+}
+
+// chartTheme holds the colors used to draw a chart
+type chartTheme struct {
+	Background string
+	Grid       string
+	Text       string
+	Rx         string
+	Tx         string
+}
+
+// chartThemes lists the available ?theme= values
+var chartThemes = map[string]chartTheme{
+	"light": {Background: "#ffffff", Grid: "#dde2ea", Text: "#4a5568", Rx: "#3b82f6", Tx: "#f59e0b"},
+	"dark":  {Background: "#181b22", Grid: "#2a2f3a", Text: "#a0aec0", Rx: "#4f9dff", Tx: "#ff9f43"},
+}
+
+// chartBar is one period (hour, day or month) of a chart
+type chartBar struct {
+	Label string
+	Rx    float64
+	Tx    float64
+}
+
+// chartRect is a filled rectangle in chart coordinates
+type chartRect struct {
+	X, Y, W, H float64
+	Color      string
+	Title      string // Tooltip, only used by SVG
+}
+
+// chartText is a text label; Y is the baseline and Anchor is start, middle or end
+type chartText struct {
+	X, Y   float64
+	Text   string
+	Anchor string
+	Color  string
+	Size   float64
+}
+
+// chartLayout is the renderer-independent result of laying out a chart
+type chartLayout struct {
+	Width, Height int
+	Background    string
+	Rects         []chartRect
+	Texts         []chartText
+}
+
+// buildChartLayout computes bars, grid lines and labels for a grouped rx/tx bar chart
+func buildChartLayout(title string, bars []chartBar, width, height int, theme chartTheme, units unitOptions) chartLayout {
+	layout := chartLayout{Width: width, Height: height, Background: theme.Background}
+	w, h := float64(width), float64(height)
+
+	const left, right, top, bottom = 70.0, 12.0, 30.0, 24.0
+	plotW, plotH := w-left-right, h-top-bottom
+
+	// Title and legend
+	layout.Texts = append(layout.Texts, chartText{X: 10, Y: 19, Text: title, Anchor: "start", Color: theme.Text, Size: 13})
+	layout.Rects = append(layout.Rects,
+		chartRect{X: w - 86, Y: 10, W: 10, H: 10, Color: theme.Rx},
+		chartRect{X: w - 44, Y: 10, W: 10, H: 10, Color: theme.Tx},
+	)
+	layout.Texts = append(layout.Texts,
+		chartText{X: w - 72, Y: 19, Text: "rx", Anchor: "start", Color: theme.Text, Size: 11},
+		chartText{X: w - 30, Y: 19, Text: "tx", Anchor: "start", Color: theme.Text, Size: 11},
+	)
+
+	if len(bars) == 0 {
+		layout.Texts = append(layout.Texts, chartText{X: w / 2, Y: h / 2, Text: "No data", Anchor: "middle", Color: theme.Text, Size: 11})
+		return layout
+	}
+
+	maxValue := 0.0
+	for _, bar := range bars {
+		maxValue = math.Max(maxValue, math.Max(bar.Rx, bar.Tx))
+	}
+	if maxValue == 0 {
+		maxValue = 1
+	}
+
+	// Horizontal grid lines with value labels
+	for i := 0; i <= 4; i++ {
+		y := math.Round(top + plotH - plotH*float64(i)/4)
+		layout.Rects = append(layout.Rects, chartRect{X: left, Y: y, W: plotW, H: 1, Color: theme.Grid})
+		layout.Texts = append(layout.Texts, chartText{X: left - 6, Y: y + 4, Text: units.Volume(maxValue * float64(i) / 4), Anchor: "end", Color: theme.Text, Size: 11})
+	}
+
+	// Bars, with a label on every n-th period so labels do not overlap
+	slot := plotW / float64(len(bars))
+	barW := math.Max(1, math.Floor(slot*0.4))
+	labelEvery := int(math.Ceil(float64(len(bars)) / math.Max(1, math.Floor(plotW/56))))
+	for i, bar := range bars {
+		x := math.Round(left + float64(i)*slot + slot*0.1)
+		rxH := math.Round(plotH * bar.Rx / maxValue)
+		txH := math.Round(plotH * bar.Tx / maxValue)
+		tooltip := fmt.Sprintf("%s rx %s tx %s", bar.Label, units.Volume(bar.Rx), units.Volume(bar.Tx))
+
+		layout.Rects = append(layout.Rects,
+			chartRect{X: x, Y: top + plotH - rxH, W: barW, H: rxH, Color: theme.Rx, Title: tooltip},
+			chartRect{X: x + barW, Y: top + plotH - txH, W: barW, H: txH, Color: theme.Tx, Title: tooltip},
+		)
+		if i%labelEvery == 0 {
+			layout.Texts = append(layout.Texts, chartText{X: x + barW, Y: h - 8, Text: bar.Label, Anchor: "middle", Color: theme.Text, Size: 11})
+		}
+	}
+
+	return layout
+}
+
+// renderChartSVG renders a chart layout as an SVG document
+func renderChartSVG(layout chartLayout) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		layout.Width, layout.Height, layout.Width, layout.Height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", layout.Background)
+
+	for _, rect := range layout.Rects {
+		if rect.Title != "" {
+			fmt.Fprintf(&b, `<rect x="%g" y="%g" width="%g" height="%g" fill="%s"><title>%s</title></rect>`+"\n",
+				rect.X, rect.Y, rect.W, rect.H, rect.Color, escapeXML(rect.Title))
+		} else {
+			fmt.Fprintf(&b, `<rect x="%g" y="%g" width="%g" height="%g" fill="%s"/>`+"\n",
+				rect.X, rect.Y, rect.W, rect.H, rect.Color)
+		}
+	}
+
+	for _, text := range layout.Texts {
+		fmt.Fprintf(&b, `<text x="%g" y="%g" text-anchor="%s" fill="%s" font-size="%g" font-family="sans-serif">%s</text>`+"\n",
+			text.X, text.Y, text.Anchor, text.Color, text.Size, escapeXML(text.Text))
+	}
+
+	b.WriteString("</svg>\n")
+	return []byte(b.String())
+}
+
+// escapeXML escapes text for use in SVG content and attributes
+func escapeXML(s string) string {
+	replacer := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;", "'", "&#39;")
+	return replacer.Replace(s)
+}
+
+// extractChartBars reads the most recent window entries of a traffic array for one interface
+// If interfaceName is empty, the first interface is used
+func extractChartBars(data map[string]interface{}, interfaceName, trafficKey string, window int) (string, []chartBar, error) {
+	interfaces, ok := data["interfaces"].([]interface{})
+	if !ok || len(interfaces) == 0 {
+		return "", nil, fmt.Errorf("no interface data available")
+	}
+
+	for _, iface := range interfaces {
+		ifaceMap, ok := iface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name := fmt.Sprintf("%v", ifaceMap["name"])
+		if interfaceName != "" && name != interfaceName {
+			continue
+		}
+
+		traffic, _ := ifaceMap["traffic"].(map[string]interface{})
+		entries, _ := traffic[trafficKey].([]interface{})
+		if len(entries) > window {
+			entries = entries[len(entries)-window:]
+		}
+
+		bars := make([]chartBar, 0, len(entries))
+		for _, entry := range entries {
+			entryMap, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			rx, tx, _ := extractRxTx(entryMap)
+			bars = append(bars, chartBar{Label: chartBarLabel(entryMap, trafficKey), Rx: rx, Tx: tx})
+		}
+
+		return name, bars, nil
+	}
+
+	return "", nil, fmt.Errorf("interface %q not found", interfaceName)
+}
+
+// chartBarLabel formats the period of a traffic entry as an axis label
+func chartBarLabel(entry map[string]interface{}, trafficKey string) string {
+	date, _ := entry["date"].(map[string]interface{})
+	year, _ := date["year"].(float64)
+	month, _ := date["month"].(float64)
+	day, _ := date["day"].(float64)
+
+	switch trafficKey {
+	case "hour":
+		timeData, _ := entry["time"].(map[string]interface{})
+		hour, _ := timeData["hour"].(float64)
+		return fmt.Sprintf("%02.0fh", hour)
+	case "day":
+		return fmt.Sprintf("%02.0f-%02.0f", month, day)
+	default:
+		return fmt.Sprintf("%.0f-%02.0f", year, month)
+	}
+}
+
+// handleChart handles /chart/<hourly|daily|monthly>.<svg|png> endpoints, returns a rendered traffic chart
+// Query options: interface, width, height, theme (light|dark), window (number of periods), units (iec|si|bytes)
+func (s *Server) handleChart(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/chart/")
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	format := name[dot+1:]
+	kind, ok := chartKinds[name[:dot]]
+	if !ok || (format != "svg" && format != "png") {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	width, err := queryInt(query.Get("width"), 800, 200, 2000)
+	if err != nil {
+		http.Error(w, "Invalid width: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	height, err := queryInt(query.Get("height"), 300, 120, 1000)
+	if err != nil {
+		http.Error(w, "Invalid height: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	window, err := queryInt(query.Get("window"), kind.defaultWindow, 1, kind.maxWindow)
+	if err != nil {
+		http.Error(w, "Invalid window: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	themeName := query.Get("theme")
+	if themeName == "" {
+		themeName = "light"
+	}
+	theme, ok := chartThemes[themeName]
+	if !ok {
+		http.Error(w, "Invalid theme: expected light or dark", http.StatusBadRequest)
+		return
+	}
+
+	units, err := parseUnitOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jsonData, err := s.service.GetJSON()
+	if err != nil {
+		slog.Error("Failed to get JSON data for chart", "err", err)
+		http.Error(w, "Failed to fetch data", http.StatusInternalServerError)
+		return
+	}
+
+	var vnstatData map[string]interface{}
+	if err := json.Unmarshal(jsonData, &vnstatData); err != nil {
+		slog.Error("Failed to parse JSON data", "err", err)
+		http.Error(w, "Failed to parse data", http.StatusInternalServerError)
+		return
+	}
+
+	interfaceName, bars, err := extractChartBars(vnstatData, query.Get("interface"), kind.trafficKey, window)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	layout := buildChartLayout(fmt.Sprintf("%s - %s", interfaceName, kind.title), bars, width, height, theme, units)
+
+	if format == "png" {
+		pngData, err := renderChartPNG(layout)
+		if err != nil {
+			slog.Error("Failed to render PNG chart", "err", err)
+			http.Error(w, "Failed to render chart", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+		w.Write(pngData)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(renderChartSVG(layout))
+}
+
+// queryInt parses an optional integer query parameter within [min, max]
+func queryInt(value string, defaultValue, min, max int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("must be between %d and %d", min, max)
+	}
+	return n, nil
+}
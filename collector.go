@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// collectorStoreVersion is bumped when the on-disk format changes incompatibly
+const collectorStoreVersion = 1
+
+// collectorMaxBytesPerSecond discards deltas above 100 Gbit/s, which only happen on bogus counter jumps
+const collectorMaxBytesPerSecond = 100e9 / 8
+
+// collectorRetention is how many buckets of each granularity are kept (matching vnstat defaults)
+var collectorRetention = map[string]int{
+	"fiveminute": 48 * 12, // 48 hours
+	"hour":       4 * 24,  // 4 days
+	"day":        62,
+	"month":      25,
+	"year":       -1, // Unlimited
+}
+
+// collectorTopDays is the number of entries kept in the top days list
+const collectorTopDays = 10
+
+// collectorBucket is the traffic of one period starting at Start (unix seconds, local period boundary)
+type collectorBucket struct {
+	Start int64  `json:"t"`
+	Rx    uint64 `json:"rx"`
+	Tx    uint64 `json:"tx"`
+}
+
+// collectorInterface is the persisted state of one interface
+type collectorInterface struct {
+	Created    int64             `json:"created"`
+	Updated    int64             `json:"updated"`
+	LastRx     uint64            `json:"last_rx"` // Last raw kernel counter values
+	LastTx     uint64            `json:"last_tx"`
+	TotalRx    uint64            `json:"total_rx"`
+	TotalTx    uint64            `json:"total_tx"`
+	FiveMinute []collectorBucket `json:"fiveminute"`
+	Hour       []collectorBucket `json:"hour"`
+	Day        []collectorBucket `json:"day"`
+	Month      []collectorBucket `json:"month"`
+	Year       []collectorBucket `json:"year"`
+	Top        []collectorBucket `json:"top"`
+}
+
+// collectorStore is the persisted collector database
+type collectorStore struct {
+	Version    int                            `json:"version"`
+	BootID     string                         `json:"boot_id"`
+	Interfaces map[string]*collectorInterface `json:"interfaces"`
+}
+
+// Collector samples kernel interface counters and keeps vnstat-style aggregates without vnstat
+type Collector struct {
+	procRoot   string
+	dbPath     string
+	exclude    []string // Glob patterns of interfaces not collected
+	mu         sync.Mutex
+	store      *collectorStore
+	lastSample time.Time
+}
+
+// NewCollector creates a new Collector, loading existing data from dbPath if present
+func NewCollector(procRoot, dbPath string, exclude []string) (*Collector, error) {
+	c := &Collector{
+		procRoot: procRoot,
+		dbPath:   dbPath,
+		exclude:  exclude,
+		store: &collectorStore{
+			Version:    collectorStoreVersion,
+			Interfaces: make(map[string]*collectorInterface),
+		},
+	}
+
+	data, err := os.ReadFile(dbPath)
+	switch {
+	case os.IsNotExist(err):
+		slog.Info("Collector: creating new database", "path", dbPath)
+	case err != nil:
+		return nil, fmt.Errorf("failed to read collector database: %v", err)
+	default:
+		var store collectorStore
+		if err := json.Unmarshal(data, &store); err != nil {
+			return nil, fmt.Errorf("failed to parse collector database %s: %v", dbPath, err)
+		}
+		if store.Version != collectorStoreVersion {
+			return nil, fmt.Errorf("unsupported collector database version %d", store.Version)
+		}
+		if store.Interfaces == nil {
+			store.Interfaces = make(map[string]*collectorInterface)
+		}
+		c.store = &store
+	}
+
+	// Take the first reading immediately so the first interval already produces traffic
+	if err := c.Sample(time.Now()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Start samples every interval and saves the database every saveInterval
+func (c *Collector) Start(interval, saveInterval time.Duration) {
+	sampleTicker := time.NewTicker(interval)
+	defer sampleTicker.Stop()
+	saveTicker := time.NewTicker(saveInterval)
+	defer saveTicker.Stop()
+
+	for {
+		select {
+		case now := <-sampleTicker.C:
+			if err := c.Sample(now); err != nil {
+				slog.Error("Collector: sampling failed", "err", err)
+			}
+		case <-saveTicker.C:
+			if err := c.Save(); err != nil {
+				slog.Error("Collector: failed to save database", "err", err)
+			}
+		}
+	}
+}
+
+// Sample reads /proc/net/dev and adds the traffic since the previous reading to the aggregates
+func (c *Collector) Sample(now time.Time) error {
+	f, err := os.Open(filepath.Join(c.procRoot, "net", "dev"))
+	if err != nil {
+		return fmt.Errorf("failed to read interface counters: %v", err)
+	}
+	counters, err := parseNetDev(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse interface counters: %v", err)
+	}
+
+	bootID := readBootID(c.procRoot)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Counters restart from zero after a reboot, so the current value is all new traffic
+	rebooted := c.store.BootID != "" && bootID != "" && bootID != c.store.BootID
+	if rebooted {
+		slog.Info("Collector: reboot detected, counters restarted")
+	}
+
+	elapsed := now.Sub(c.lastSample).Seconds()
+	if c.lastSample.IsZero() {
+		elapsed = math.Inf(1) // Unknown gap since the last run (e.g. server restart)
+	}
+
+	for name, cur := range counters {
+		if name == "lo" || matchesAny(c.exclude, name) {
+			continue
+		}
+
+		iface, ok := c.store.Interfaces[name]
+		if !ok {
+			// New interface: start counting from the current kernel values
+			c.store.Interfaces[name] = &collectorInterface{
+				Created: now.Unix(),
+				Updated: now.Unix(),
+				LastRx:  cur.RxBytes,
+				LastTx:  cur.TxBytes,
+			}
+			continue
+		}
+
+		rx := collectorDelta(name, "rx", iface.LastRx, cur.RxBytes, rebooted, elapsed)
+		tx := collectorDelta(name, "tx", iface.LastTx, cur.TxBytes, rebooted, elapsed)
+		iface.LastRx, iface.LastTx = cur.RxBytes, cur.TxBytes
+		iface.add(now, rx, tx)
+	}
+
+	if bootID != "" {
+		c.store.BootID = bootID
+	}
+	c.lastSample = now
+	return nil
+}
+
+// collectorDelta computes the traffic between two raw counter readings
+// A decrease is either a 32-bit counter wrap, a reboot or an interface reset
+func collectorDelta(name, direction string, previous, current uint64, rebooted bool, elapsed float64) uint64 {
+	// A counter can only have wrapped if it was close enough to the 32-bit limit to reach it in the interval,
+	// and never more than half the range away: a decrease further down is an interface reset
+	wrapWindow := min(collectorMaxBytesPerSecond*elapsed, math.MaxUint32/2)
+
+	var delta uint64
+	switch {
+	case rebooted:
+		delta = current
+	case current >= previous:
+		delta = current - previous
+	case previous <= math.MaxUint32 && float64(math.MaxUint32-previous) < wrapWindow:
+		// 32-bit counter wrapped around
+		delta = math.MaxUint32 - previous + current + 1
+	default:
+		// 64-bit counters do not wrap in practice: the interface was reset or recreated
+		delta = current
+	}
+
+	if float64(delta) > collectorMaxBytesPerSecond*elapsed {
+		slog.Warn("Collector: ignoring implausible delta", "interface", name, "direction", direction, "bytes", delta, "seconds", math.Round(elapsed))
+		return 0
+	}
+	return delta
+}
+
+// readBootID returns the kernel boot ID, or "" if unavailable
+func readBootID(procRoot string) string {
+	data, err := os.ReadFile(filepath.Join(procRoot, "sys", "kernel", "random", "boot_id"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// add accounts rx/tx bytes observed at now into every granularity
+func (iface *collectorInterface) add(now time.Time, rx, tx uint64) {
+	iface.Updated = now.Unix()
+	iface.TotalRx += rx
+	iface.TotalTx += tx
+
+	iface.FiveMinute = addToBucket(iface.FiveMinute, periodStart(now, "fiveminute"), rx, tx, collectorRetention["fiveminute"])
+	iface.Hour = addToBucket(iface.Hour, periodStart(now, "hour"), rx, tx, collectorRetention["hour"])
+	iface.Day = addToBucket(iface.Day, periodStart(now, "day"), rx, tx, collectorRetention["day"])
+	iface.Month = addToBucket(iface.Month, periodStart(now, "month"), rx, tx, collectorRetention["month"])
+	iface.Year = addToBucket(iface.Year, periodStart(now, "year"), rx, tx, collectorRetention["year"])
+
+	// Keep the current day in the top list if it ranks
+	today := iface.Day[len(iface.Day)-1]
+	iface.Top = updateTopDays(iface.Top, today)
+}
+
+// addToBucket adds traffic to the bucket starting at start, appending a new bucket and pruning old ones as needed
+func addToBucket(buckets []collectorBucket, start int64, rx, tx uint64, retention int) []collectorBucket {
+	if n := len(buckets); n > 0 && buckets[n-1].Start == start {
+		buckets[n-1].Rx += rx
+		buckets[n-1].Tx += tx
+		return buckets
+	}
+
+	buckets = append(buckets, collectorBucket{Start: start, Rx: rx, Tx: tx})
+	if retention > 0 && len(buckets) > retention {
+		buckets = append([]collectorBucket(nil), buckets[len(buckets)-retention:]...)
+	}
+	return buckets
+}
+
+// updateTopDays keeps the highest-traffic days, sorted by rx+tx descending
+func updateTopDays(top []collectorBucket, day collectorBucket) []collectorBucket {
+	found := false
+	for i := range top {
+		if top[i].Start == day.Start {
+			top[i] = day
+			found = true
+			break
+		}
+	}
+	if !found {
+		top = append(top, day)
+	}
+
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].Rx+top[i].Tx > top[j].Rx+top[j].Tx
+	})
+	if len(top) > collectorTopDays {
+		top = top[:collectorTopDays]
+	}
+	return top
+}
+
+// periodStart returns the unix start of the local period containing t
+func periodStart(t time.Time, granularity string) int64 {
+	t = t.Local()
+	switch granularity {
+	case "fiveminute":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()/5*5, 0, 0, time.Local).Unix()
+	case "hour":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.Local).Unix()
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local).Unix()
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local).Unix()
+	default:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.Local).Unix()
+	}
+}
+
+// Save writes the database atomically (temporary file + rename)
+func (c *Collector) Save() error {
+	c.mu.Lock()
+	data, err := json.Marshal(c.store)
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode collector database: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.dbPath), 0755); err != nil {
+		return fmt.Errorf("failed to create database directory: %v", err)
+	}
+
+	tmpPath := c.dbPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write collector database: %v", err)
+	}
+	if err := os.Rename(tmpPath, c.dbPath); err != nil {
+		return fmt.Errorf("failed to replace collector database: %v", err)
+	}
+	return nil
+}
+
+// InterfaceNames returns the sorted names of the collected interfaces, optionally limited to one interface
+func (c *Collector) InterfaceNames(interfaceName string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.store.Interfaces))
+	for name := range c.store.Interfaces {
+		if interfaceName == "" || name == interfaceName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Data returns the collected traffic in the vnstat JSON model, optionally limited to one interface
+func (c *Collector) Data(interfaceName string) *VnstatData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := &VnstatData{
+		VnstatVersion: "vnstat-http-server collector",
+		JSONVersion:   "2",
+		Interfaces:    []InterfaceData{},
+	}
+
+	names := make([]string, 0, len(c.store.Interfaces))
+	for name := range c.store.Interfaces {
+		if interfaceName == "" || name == interfaceName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		iface := c.store.Interfaces[name]
+		created := time.Unix(iface.Created, 0)
+		updated := time.Unix(iface.Updated, 0)
+
+		data.Interfaces = append(data.Interfaces, InterfaceData{
+			Name: name,
+			Created: EntryStamp{
+				Date:      newEntryDate(created, "day"),
+				Timestamp: iface.Created,
+			},
+			Updated: EntryStamp{
+				Date:      newEntryDate(updated, "day"),
+				Time:      &EntryTime{Hour: updated.Hour(), Minute: updated.Minute()},
+				Timestamp: iface.Updated,
+			},
+			Traffic: TrafficData{
+				Total:      TrafficTotal{Rx: iface.TotalRx, Tx: iface.TotalTx},
+				FiveMinute: bucketsToEntries(iface.FiveMinute, "fiveminute"),
+				Hour:       bucketsToEntries(iface.Hour, "hour"),
+				Day:        bucketsToEntries(iface.Day, "day"),
+				Month:      bucketsToEntries(iface.Month, "month"),
+				Year:       bucketsToEntries(iface.Year, "year"),
+				Top:        bucketsToEntries(iface.Top, "day"),
+			},
+		})
+	}
+
+	return data
+}
+
+// JSON returns the collected traffic encoded like vnstat --json
+func (c *Collector) JSON(interfaceName string) ([]byte, error) {
+	return json.Marshal(c.Data(interfaceName))
+}
+
+// bucketsToEntries converts stored buckets to vnstat JSON entries
+func bucketsToEntries(buckets []collectorBucket, granularity string) []TrafficEntry {
+	entries := make([]TrafficEntry, 0, len(buckets))
+	for i, bucket := range buckets {
+		start := time.Unix(bucket.Start, 0)
+		entry := TrafficEntry{
+			ID:        int64(i + 1),
+			Timestamp: bucket.Start,
+			Rx:        bucket.Rx,
+			Tx:        bucket.Tx,
+		}
+
+		switch granularity {
+		case "fiveminute", "hour":
+			entry.Date = newEntryDate(start, "day")
+			entry.Time = &EntryTime{Hour: start.Hour(), Minute: start.Minute()}
+		case "day":
+			entry.Date = newEntryDate(start, "day")
+		case "month":
+			entry.Date = newEntryDate(start, "month")
+		default:
+			entry.Date = newEntryDate(start, "year")
+		}
+
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// saveCollectorOnExit saves the database when the process receives SIGINT or SIGTERM
+func saveCollectorOnExit(c *Collector) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		slog.Info("Collector: saving database before exit", "signal", sig.String())
+		if err := c.Save(); err != nil {
+			slog.Error("Collector: failed to save database", "err", err)
+		}
+		os.Exit(0)
+	}()
+}
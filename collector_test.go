@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollectorDelta(t *testing.T) {
+	const gib = 1 << 30
+	tests := []struct {
+		name              string
+		previous, current uint64
+		rebooted          bool
+		want              uint64
+	}{
+		{"increase", 1000, 5000, false, 4000},
+		{"reboot", 9 * gib, 2000, true, 2000},
+		{"32-bit wrap", math.MaxUint32 - 999, 500, false, 1500},
+		{"reset in the lower half", gib, 2000, false, 2000},
+		{"64-bit reset", 100 * gib, 2000, false, 2000},
+		{"implausible jump", 0, 1 << 50, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collectorDelta("eth0", "rx", tt.previous, tt.current, tt.rebooted, 30); got != tt.want {
+				t.Errorf("collectorDelta(%d, %d) = %d, want %d", tt.previous, tt.current, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeCollectorProc writes net/dev with eth0 and lo, and the boot ID, below a -proc-root fixture directory
+func writeCollectorProc(t *testing.T, procRoot string, rx, tx uint64, bootID string) {
+	t.Helper()
+	writeNetDev(t, procRoot, fmt.Sprintf("    lo: 7 1 0 0 0 0 0 0 7 1 0 0 0 0 0 0\n  eth0: %d 1 0 0 0 0 0 0 %d 1 0 0 0 0 0 0\n", rx, tx))
+	dir := filepath.Join(procRoot, "sys", "kernel", "random")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "boot_id"), []byte(bootID+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorReboot(t *testing.T) {
+	procRoot := t.TempDir()
+	dbPath := filepath.Join(t.TempDir(), "collector.json")
+
+	// Just below the 32-bit limit, so without the boot ID change a decrease would be a wrap
+	writeCollectorProc(t, procRoot, math.MaxUint32-100, 1000, "boot-1")
+	collector, err := NewCollector(procRoot, dbPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := collector.store.Interfaces["lo"]; ok {
+		t.Error("lo is collected")
+	}
+	now := time.Now()
+
+	writeCollectorProc(t, procRoot, 5000, 3000, "boot-1")
+	if err := collector.Sample(now.Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	eth0 := collector.store.Interfaces["eth0"]
+	if eth0.TotalRx != 5101 || eth0.TotalTx != 2000 {
+		t.Fatalf("after a wrap: totals = %d/%d, want 5101/2000", eth0.TotalRx, eth0.TotalTx)
+	}
+
+	// After a reboot the counters restarted from zero: the current values are all new traffic
+	writeCollectorProc(t, procRoot, 4000, 100, "boot-2")
+	if err := collector.Sample(now.Add(60 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if eth0.TotalRx != 9101 || eth0.TotalTx != 2100 {
+		t.Errorf("after a reboot: totals = %d/%d, want 9101/2100", eth0.TotalRx, eth0.TotalTx)
+	}
+	if collector.store.BootID != "boot-2" {
+		t.Errorf("boot ID = %q, want boot-2", collector.store.BootID)
+	}
+
+	// The saved boot ID is kept across restarts, so the same boot is not a reboot
+	if err := collector.Save(); err != nil {
+		t.Fatal(err)
+	}
+	writeCollectorProc(t, procRoot, 4500, 150, "boot-2")
+	reloaded, err := NewCollector(procRoot, dbPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eth0 := reloaded.store.Interfaces["eth0"]; eth0.TotalRx != 9601 || eth0.TotalTx != 2150 {
+		t.Errorf("after restart: totals = %d/%d, want 9601/2150", eth0.TotalRx, eth0.TotalTx)
+	}
+}
+
+func TestCollectorBuckets(t *testing.T) {
+	at := func(year int, month time.Month, day, hour, minute, second int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, time.Local)
+	}
+	iface := &collectorInterface{}
+	for _, sample := range []struct {
+		t      time.Time
+		rx, tx uint64
+	}{
+		{at(2026, 10, 19, 14, 32, 10), 100, 10},
+		{at(2026, 10, 19, 14, 34, 59), 50, 5}, // Same five minutes
+		{at(2026, 10, 19, 14, 35, 0), 1, 1},   // Next five minutes, same hour
+		{at(2026, 10, 19, 15, 1, 0), 2, 2},    // Next hour
+		{at(2026, 10, 20, 0, 0, 0), 1000, 0},  // Next day
+		{at(2026, 11, 1, 9, 0, 0), 4, 4},      // Next month
+		{at(2027, 1, 1, 0, 0, 0), 8, 8},       // Next year
+	} {
+		iface.add(sample.t, sample.rx, sample.tx)
+	}
+
+	type bucket struct {
+		start  time.Time
+		rx, tx uint64
+	}
+	check := func(granularity string, buckets []collectorBucket, want []bucket) {
+		t.Helper()
+		if len(buckets) != len(want) {
+			t.Fatalf("%s: %d buckets, want %d: %+v", granularity, len(buckets), len(want), buckets)
+		}
+		for i, w := range want {
+			if buckets[i] != (collectorBucket{Start: w.start.Unix(), Rx: w.rx, Tx: w.tx}) {
+				t.Errorf("%s bucket %d = %+v, want %v %d/%d", granularity, i, buckets[i], w.start, w.rx, w.tx)
+			}
+		}
+	}
+	check("fiveminute", iface.FiveMinute, []bucket{
+		{at(2026, 10, 19, 14, 30, 0), 150, 15},
+		{at(2026, 10, 19, 14, 35, 0), 1, 1},
+		{at(2026, 10, 19, 15, 0, 0), 2, 2},
+		{at(2026, 10, 20, 0, 0, 0), 1000, 0},
+		{at(2026, 11, 1, 9, 0, 0), 4, 4},
+		{at(2027, 1, 1, 0, 0, 0), 8, 8},
+	})
+	check("hour", iface.Hour, []bucket{
+		{at(2026, 10, 19, 14, 0, 0), 151, 16},
+		{at(2026, 10, 19, 15, 0, 0), 2, 2},
+		{at(2026, 10, 20, 0, 0, 0), 1000, 0},
+		{at(2026, 11, 1, 9, 0, 0), 4, 4},
+		{at(2027, 1, 1, 0, 0, 0), 8, 8},
+	})
+	check("day", iface.Day, []bucket{
+		{at(2026, 10, 19, 0, 0, 0), 153, 18},
+		{at(2026, 10, 20, 0, 0, 0), 1000, 0},
+		{at(2026, 11, 1, 0, 0, 0), 4, 4},
+		{at(2027, 1, 1, 0, 0, 0), 8, 8},
+	})
+	check("month", iface.Month, []bucket{
+		{at(2026, 10, 1, 0, 0, 0), 1153, 18},
+		{at(2026, 11, 1, 0, 0, 0), 4, 4},
+		{at(2027, 1, 1, 0, 0, 0), 8, 8},
+	})
+	check("year", iface.Year, []bucket{
+		{at(2026, 1, 1, 0, 0, 0), 1157, 22},
+		{at(2027, 1, 1, 0, 0, 0), 8, 8},
+	})
+	check("top", iface.Top, []bucket{
+		{at(2026, 10, 20, 0, 0, 0), 1000, 0},
+		{at(2026, 10, 19, 0, 0, 0), 153, 18},
+		{at(2027, 1, 1, 0, 0, 0), 8, 8},
+		{at(2026, 11, 1, 0, 0, 0), 4, 4},
+	})
+	if iface.TotalRx != 1165 || iface.TotalTx != 30 {
+		t.Errorf("totals = %d/%d, want 1165/30", iface.TotalRx, iface.TotalTx)
+	}
+
+	// Old five-minute buckets are pruned beyond the retention
+	start := at(2026, 10, 19, 0, 0, 0)
+	pruned := &collectorInterface{}
+	for i := 0; i < collectorRetention["fiveminute"]+5; i++ {
+		pruned.add(start.Add(time.Duration(i)*5*time.Minute), 1, 1)
+	}
+	if n := len(pruned.FiveMinute); n != collectorRetention["fiveminute"] {
+		t.Errorf("%d five-minute buckets kept, want %d", n, collectorRetention["fiveminute"])
+	}
+	if first := pruned.FiveMinute[0].Start; first != start.Add(5*5*time.Minute).Unix() {
+		t.Errorf("oldest bucket starts at %v, want the sixth period", time.Unix(first, 0))
+	}
+
+	// Only the busiest days are kept in the top list, busiest first
+	top := &collectorInterface{}
+	for i := 0; i < collectorTopDays+5; i++ {
+		top.add(start.AddDate(0, 0, i), uint64(i), 0)
+	}
+	if n := len(top.Top); n != collectorTopDays {
+		t.Fatalf("%d top days kept, want %d", n, collectorTopDays)
+	}
+	if top.Top[0].Rx != collectorTopDays+4 || top.Top[collectorTopDays-1].Rx != 5 {
+		t.Errorf("top days range from %d to %d bytes, want %d to 5", top.Top[0].Rx, top.Top[collectorTopDays-1].Rx, collectorTopDays+4)
+	}
+}
+
+// jsonShape replaces the values of decoded JSON by their type and arrays by the shape of their first element
+func jsonShape(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		shape := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			shape[key] = jsonShape(value)
+		}
+		return shape
+	case []interface{}:
+		if len(v) == 0 {
+			return "empty array"
+		}
+		return []interface{}{jsonShape(v[0])}
+	case float64:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func TestCollectorJSON(t *testing.T) {
+	procRoot := t.TempDir()
+	writeCollectorProc(t, procRoot, 1000, 1000, "boot-1")
+	collector, err := NewCollector(procRoot, filepath.Join(t.TempDir(), "collector.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCollectorProc(t, procRoot, 6000, 2000, "boot-1")
+	if err := collector.Sample(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := collector.JSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseVnstatData(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, collector.Data("")) {
+		t.Errorf("parsed JSON differs from the collector data:\n%s", encoded)
+	}
+	if len(parsed.Interfaces) != 1 || parsed.Interfaces[0].Traffic.Total != (TrafficTotal{Rx: 5000, Tx: 1000}) {
+		t.Errorf("interfaces = %+v", parsed.Interfaces)
+	}
+
+	// Same keys and nesting as vnstat --json, with the top list shaped like days
+	var collected, vnstat map[string]interface{}
+	if err := json.Unmarshal(encoded, &collected); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(testVnstatJSON), &vnstat); err != nil {
+		t.Fatal(err)
+	}
+	want := jsonShape(vnstat).(map[string]interface{})
+	wantTraffic := want["interfaces"].([]interface{})[0].(map[string]interface{})["traffic"].(map[string]interface{})
+	wantTraffic["top"] = wantTraffic["day"]
+	if got := jsonShape(collected); !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON shape =\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// comparePeriods maps each comparable period to the granularity whose entries are summed for it
+var comparePeriods = map[string]string{
+	"day":   "day",
+	"week":  "day",
+	"month": "month",
+	"year":  "year",
+}
+
+// comparePeriodStart returns the start of the period containing t (weeks start on Monday)
+func comparePeriodStart(t time.Time, period string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch period {
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case "year":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return day
+	}
+}
+
+// shiftPeriod moves a period start by n periods (negative moves back)
+func shiftPeriod(start time.Time, period string, n int) time.Time {
+	switch period {
+	case "week":
+		return start.AddDate(0, 0, 7*n)
+	case "month":
+		return start.AddDate(0, n, 0)
+	case "year":
+		return start.AddDate(n, 0, 0)
+	default:
+		return start.AddDate(0, 0, n)
+	}
+}
+
+// trafficPeriod is the traffic of one period in /api/v1 responses
+type trafficPeriod struct {
+	Start          string `json:"start"`
+	End            string `json:"end"`
+	Complete       bool   `json:"complete"` // False for the period in progress
+	Rx             uint64 `json:"rx"`
+	Tx             uint64 `json:"tx"`
+	Total          uint64 `json:"total"`
+	RxFormatted    string `json:"rx_formatted"`
+	TxFormatted    string `json:"tx_formatted"`
+	TotalFormatted string `json:"total_formatted"`
+}
+
+// newTrafficPeriod formats the traffic of the period [start, end)
+func newTrafficPeriod(start, end time.Time, rx, tx uint64, units unitOptions, now time.Time) trafficPeriod {
+	return trafficPeriod{
+		Start:          start.Format(time.RFC3339),
+		End:            end.Format(time.RFC3339),
+		Complete:       !end.After(now),
+		Rx:             rx,
+		Tx:             tx,
+		Total:          rx + tx,
+		RxFormatted:    units.Volume(float64(rx)),
+		TxFormatted:    units.Volume(float64(tx)),
+		TotalFormatted: units.Volume(float64(rx + tx)),
+	}
+}
+
+// compareDelta is the change from the previous to the current period
+// Percentages are nil when the previous period had no traffic in that direction
+type compareDelta struct {
+	Rx           int64    `json:"rx"`
+	Tx           int64    `json:"tx"`
+	Total        int64    `json:"total"`
+	RxPercent    *float64 `json:"rx_percent"`
+	TxPercent    *float64 `json:"tx_percent"`
+	TotalPercent *float64 `json:"total_percent"`
+}
+
+// interfaceComparison compares two periods of one interface
+type interfaceComparison struct {
+	Name     string        `json:"name"`
+	Alias    string        `json:"alias,omitempty"`
+	Current  trafficPeriod `json:"current"`
+	Previous trafficPeriod `json:"previous"`
+	Delta    compareDelta  `json:"delta"`
+}
+
+// periodComparison is the /api/v1/compare response
+type periodComparison struct {
+	Period     string                `json:"period"`
+	Offset     int                   `json:"offset"`
+	Units      string                `json:"units"`
+	Generated  int64                 `json:"generated"`
+	Interfaces []interfaceComparison `json:"interfaces"`
+}
+
+// sumPeriod adds up the entries of the granularity that start within [start, end)
+func sumPeriod(traffic TrafficData, granularity string, start, end time.Time) (uint64, uint64) {
+	var rx, tx uint64
+	entries, _ := traffic.Entries(granularity)
+	for _, entry := range entries {
+		entryStart := entry.Start()
+		if !entryStart.Before(start) && entryStart.Before(end) {
+			rx += entry.Rx
+			tx += entry.Tx
+		}
+	}
+	return rx, tx
+}
+
+// percentChange returns the relative change from previous to current in percent, nil if previous is zero
+func percentChange(current, previous uint64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := roundTo((float64(current)-float64(previous))/float64(previous)*100, 2)
+	return &change
+}
+
+// buildPeriodComparison compares the period containing now with the period offset periods before it
+func buildPeriodComparison(data *VnstatData, period string, offset int, units unitOptions, now time.Time) periodComparison {
+	granularity := comparePeriods[period]
+	currentStart := comparePeriodStart(now, period)
+	previousStart := shiftPeriod(currentStart, period, -offset)
+
+	comparison := periodComparison{
+		Period:     period,
+		Offset:     offset,
+		Units:      units.Units,
+		Generated:  now.Unix(),
+		Interfaces: []interfaceComparison{},
+	}
+
+	summarize := func(traffic TrafficData, start time.Time) trafficPeriod {
+		end := shiftPeriod(start, period, 1)
+		rx, tx := sumPeriod(traffic, granularity, start, end)
+		return newTrafficPeriod(start, end, rx, tx, units, now)
+	}
+
+	for _, iface := range data.Interfaces {
+		current := summarize(iface.Traffic, currentStart)
+		previous := summarize(iface.Traffic, previousStart)
+		comparison.Interfaces = append(comparison.Interfaces, interfaceComparison{
+			Name:     iface.Name,
+			Alias:    iface.Alias,
+			Current:  current,
+			Previous: previous,
+			Delta: compareDelta{
+				Rx:           int64(current.Rx) - int64(previous.Rx),
+				Tx:           int64(current.Tx) - int64(previous.Tx),
+				Total:        int64(current.Total) - int64(previous.Total),
+				RxPercent:    percentChange(current.Rx, previous.Rx),
+				TxPercent:    percentChange(current.Tx, previous.Tx),
+				TotalPercent: percentChange(current.Total, previous.Total),
+			},
+		})
+	}
+
+	return comparison
+}
+
+// handleCompare handles /api/v1/compare endpoint, compares the current period with an earlier one per interface
+// Query options: period (day|week|month|year, default month), offset (periods back, default 1), units (iec|si|bytes)
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	units, err := parseUnitOptions(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiCodeInvalidParameter, err.Error())
+		return
+	}
+
+	period := query.Get("period")
+	if period == "" {
+		period = "month"
+	}
+	if _, ok := comparePeriods[period]; !ok {
+		writeAPIError(w, http.StatusBadRequest, apiCodeInvalidParameter, "Invalid period: expected one of day, week, month, year")
+		return
+	}
+
+	offset, err := queryInt(query.Get("offset"), 1, 1, 1000)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiCodeInvalidParameter, "Invalid offset: "+err.Error())
+		return
+	}
+
+	data, ok := s.apiData(w)
+	if !ok {
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, buildPeriodComparison(data, period, offset, units, time.Now()))
+}
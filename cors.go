@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy decides which browser origins may read responses cross-origin
+// A nil policy disables CORS: no Access-Control-* headers are sent
+type corsPolicy struct {
+	anyOrigin   bool              // "*" allows every origin
+	origins     map[string]bool   // Exact origins, e.g. https://example.com
+	wildcards   []corsOriginMatch // Subdomain patterns, e.g. https://*.example.com
+	headers     []string          // Request headers allowed in preflights
+	credentials bool              // Send Access-Control-Allow-Credentials
+	maxAge      time.Duration     // How long browsers may cache a preflight, 0 to leave it to the browser
+}
+
+// corsOriginMatch is a parsed https://*.example.com pattern
+type corsOriginMatch struct {
+	scheme string // Including "://"
+	suffix string // Host suffix including the leading dot and the port, e.g. ".example.com:8443"
+}
+
+// newCORSPolicy parses the -cors-* flags; an empty origin list disables CORS and returns nil
+// Credentials are only allowed for listed origins, never for *
+func newCORSPolicy(originsSpec, headersSpec string, credentials bool, maxAge time.Duration) (*corsPolicy, error) {
+	if strings.TrimSpace(originsSpec) == "" {
+		return nil, nil
+	}
+	if maxAge < 0 {
+		return nil, fmt.Errorf("max age must not be negative")
+	}
+
+	p := &corsPolicy{origins: make(map[string]bool), credentials: credentials, maxAge: maxAge}
+	for _, origin := range strings.Split(originsSpec, ",") {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "":
+			continue
+		case origin == "*":
+			p.anyOrigin = true
+		case origin == "null":
+			p.origins[origin] = true // Sandboxed frames and file:// pages
+		default:
+			scheme, host, ok := strings.Cut(strings.ToLower(origin), "://")
+			if !ok || (scheme != "http" && scheme != "https") || host == "" {
+				return nil, fmt.Errorf("invalid origin %q (expected http(s)://host[:port], https://*.host or *)", origin)
+			}
+			if strings.ContainsAny(host, "/?#@ ") {
+				return nil, fmt.Errorf("invalid origin %q (an origin has no path, query or credentials)", origin)
+			}
+			if strings.HasPrefix(host, "*.") {
+				p.wildcards = append(p.wildcards, corsOriginMatch{scheme: scheme + "://", suffix: host[1:]})
+			} else if strings.Contains(host, "*") {
+				return nil, fmt.Errorf("invalid origin %q (only a leading *. subdomain wildcard is supported)", origin)
+			} else {
+				p.origins[scheme+"://"+host] = true
+			}
+		}
+	}
+
+	if p.anyOrigin && p.credentials {
+		return nil, fmt.Errorf("credentials cannot be allowed for any origin (*), list the trusted origins instead")
+	}
+
+	for _, header := range strings.Split(headersSpec, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			p.headers = append(p.headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	return p, nil
+}
+
+// allowed reports whether the origin may read responses
+func (p *corsPolicy) allowed(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, wildcard := range p.wildcards {
+		host := strings.TrimPrefix(origin, wildcard.scheme)
+		if host != origin && strings.HasSuffix(host, wildcard.suffix) {
+			// At least one subdomain label, the pattern does not match the apex domain
+			if label := strings.TrimSuffix(host, wildcard.suffix); label != "" && !strings.ContainsAny(label, "/:@") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// apply adds the CORS headers for a request to an endpoint accepting the given methods
+// Preflights (OPTIONS) also get the allowed methods, headers and max age
+func (p *corsPolicy) apply(w http.ResponseWriter, r *http.Request, methods []string) {
+	if p == nil {
+		return
+	}
+
+	// Any origin (never combined with credentials) is answered with a literal * that caches can share,
+	// every other policy depends on the Origin header
+	if p.anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !p.allowed(origin) {
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if p.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", ")+", OPTIONS")
+		if len(p.headers) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(p.headers, ", "))
+		}
+		if p.maxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+		}
+	}
+}
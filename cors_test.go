@@ -0,0 +1,167 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewCORSPolicy(t *testing.T) {
+	if policy, err := newCORSPolicy("  ", "", false, 0); policy != nil || err != nil {
+		t.Errorf("empty origins = %+v, %v; want CORS disabled", policy, err)
+	}
+
+	policy, err := newCORSPolicy("HTTPS://Dash.Example.com:8443, null, https://*.example.org", " content-type ,x-api-key", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.origins["https://dash.example.com:8443"] || !policy.origins["null"] || len(policy.wildcards) != 1 || policy.anyOrigin {
+		t.Errorf("policy = %+v", policy)
+	}
+	if len(policy.headers) != 2 || policy.headers[0] != "Content-Type" || policy.headers[1] != "X-Api-Key" {
+		t.Errorf("headers = %v, want canonical names", policy.headers)
+	}
+
+	for _, spec := range []struct {
+		origins     string
+		credentials bool
+		maxAge      time.Duration
+	}{
+		{"*", true, 0},
+		{"https://dash.example.com,*", true, 0},
+		{"dash.example.com", false, 0},
+		{"ftp://dash.example.com", false, 0},
+		{"https://", false, 0},
+		{"https://dash.example.com/path", false, 0},
+		{"https://user@dash.example.com", false, 0},
+		{"https://dash.*.example.com", false, 0},
+		{"https://dash.example.com", false, -time.Second},
+	} {
+		if _, err := newCORSPolicy(spec.origins, "", spec.credentials, spec.maxAge); err == nil {
+			t.Errorf("newCORSPolicy(%q, credentials %v, max age %v) accepted", spec.origins, spec.credentials, spec.maxAge)
+		}
+	}
+}
+
+func TestCORSAllowed(t *testing.T) {
+	policy, err := newCORSPolicy("https://*.example.com,https://dash.example.net", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"https://dash.example.com":      true,
+		"https://a.b.example.com":       true, // Nested subdomains match too
+		"HTTPS://Dash.Example.COM":      true,
+		"https://example.com":           false, // The apex is not a subdomain
+		"http://dash.example.com":       false, // Other scheme
+		"https://dash.example.com:8443": false, // The pattern has no port
+		"https://evil-example.com":      false,
+		"https://example.com.evil.com":  false,
+		"https://.example.com":          false,
+		"https://dash.example.net":      true,
+		"https://a.dash.example.net":    false, // Exact origins have no subdomains
+		"null":                          false,
+	}
+	for origin, want := range tests {
+		if got := policy.allowed(origin); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+
+	ported, err := newCORSPolicy("https://*.example.com:8443", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ported.allowed("https://dash.example.com:8443") || ported.allowed("https://dash.example.com") {
+		t.Error("a pattern with a port must match only that port")
+	}
+}
+
+func TestCORSApply(t *testing.T) {
+	apply := func(policy *corsPolicy, method, origin string) http.Header {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/json", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		policy.apply(rec, r, []string{"GET"})
+		return rec.Header()
+	}
+
+	// Any origin is a literal * that does not vary by origin
+	anyOrigin, err := newCORSPolicy("*", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, origin := range []string{"", "https://evil.example"} {
+		header := apply(anyOrigin, "GET", origin)
+		if header.Get("Access-Control-Allow-Origin") != "*" || header.Get("Vary") != "" || header.Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("origin %q with *: headers %v", origin, header)
+		}
+	}
+
+	// Listed origins are echoed, and every response varies by origin
+	listed, err := newCORSPolicy("https://dash.example.com", "", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := apply(listed, "GET", "https://dash.example.com")
+	if header.Get("Access-Control-Allow-Origin") != "https://dash.example.com" || header.Get("Access-Control-Allow-Credentials") != "true" || header.Get("Vary") != "Origin" {
+		t.Errorf("allowed origin: headers %v", header)
+	}
+	for _, origin := range []string{"", "https://evil.example"} {
+		header := apply(listed, "GET", origin)
+		if header.Get("Vary") != "Origin" || header.Get("Access-Control-Allow-Origin") != "" || header.Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("origin %q: headers %v, want only Vary", origin, header)
+		}
+	}
+
+	if header := apply(nil, "GET", "https://dash.example.com"); len(header) != 0 {
+		t.Errorf("disabled CORS: headers %v", header)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	s := newTestServer(t)
+	policy, err := newCORSPolicy("https://dash.example.com", "Content-Type,Authorization", false, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cors = policy
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Preflights are answered without a token
+	r := httptest.NewRequest("OPTIONS", "/json", nil)
+	r.Header.Set("Origin", "https://dash.example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://dash.example.com",
+		"Access-Control-Allow-Methods": "GET, OPTIONS",
+		"Access-Control-Allow-Headers": "Content-Type, Authorization",
+		"Access-Control-Max-Age":       "600",
+		"Vary":                         "Origin",
+	}
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	// Other requests get no preflight headers
+	r = httptest.NewRequest("GET", "/json", nil)
+	r.Header.Set("Origin", "https://dash.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" || rec.Header().Get("Access-Control-Allow-Methods") != "" || rec.Header().Get("Access-Control-Max-Age") != "" {
+		t.Errorf("GET headers %v", rec.Header())
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushRows is how many rows are written between flushes to the client
+const exportFlushRows = 500
+
+// exportRange is an optional [From, To) filter on period start times
+type exportRange struct {
+	From time.Time // Zero means unbounded
+	To   time.Time // Exclusive, zero means unbounded
+}
+
+// contains reports whether t falls inside the range
+func (r exportRange) contains(t time.Time) bool {
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && !t.Before(r.To) {
+		return false
+	}
+	return true
+}
+
+// parseExportTime parses a date (YYYY-MM-DD, local time) or an RFC 3339 timestamp
+// A date used as upper bound includes the whole day
+func parseExportTime(value string, upper bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (YYYY-MM-DD) or RFC 3339 timestamp", value)
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// handleExport handles /export.csv and /export.tsv endpoints, streams traffic history as one row per interface per period
+// Query options: granularity (fiveminute|hour|day|month|year, default day), interface (comma-separated filter),
+// from and to (YYYY-MM-DD or RFC 3339, inclusive)
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimPrefix(path.Ext(r.URL.Path), ".")
+	separator := ','
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case "csv":
+	case "tsv":
+		separator = '\t'
+		contentType = "text/tab-separated-values; charset=utf-8"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = "day"
+	}
+	if _, ok := (TrafficData{}).Entries(granularity); !ok {
+		http.Error(w, fmt.Sprintf("Invalid granularity: expected one of %s", strings.Join(trafficGranularities, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	var dateRange exportRange
+	if from := query.Get("from"); from != "" {
+		t, err := parseExportTime(from, false)
+		if err != nil {
+			http.Error(w, "Invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		dateRange.From = t
+	}
+	if to := query.Get("to"); to != "" {
+		t, err := parseExportTime(to, true)
+		if err != nil {
+			http.Error(w, "Invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		dateRange.To = t
+	}
+
+	var interfaces []string
+	if filter := query.Get("interface"); filter != "" {
+		for _, name := range strings.Split(filter, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				interfaces = append(interfaces, name)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"vnstat-%s.%s\"", granularity, format))
+
+	response := &exportResponse{ResponseWriter: w}
+	source := func(each func(name string, entries []TrafficEntry) error) error {
+		return s.service.StreamEntries(granularity, each)
+	}
+	if err := writeExport(response, separator, source, granularity, interfaces, dateRange); err != nil {
+		if !response.started {
+			slog.Error("Failed to export traffic history", "err", err)
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Failed to fetch data", http.StatusInternalServerError)
+			return
+		}
+		// Rows were already sent, so the client sees a truncated file
+		slog.Warn("Export aborted", "err", err)
+	}
+}
+
+// exportResponse records whether any part of the export was sent, after which errors can no longer change the status
+type exportResponse struct {
+	http.ResponseWriter
+	started bool
+}
+
+// Write sends p to the client
+func (r *exportResponse) Write(p []byte) (int, error) {
+	r.started = true
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush sends buffered data to the client
+func (r *exportResponse) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// exportSource calls each with the entries of the exported granularity of every interface, one interface at a time
+type exportSource func(each func(name string, entries []TrafficEntry) error) error
+
+// writeExport writes the header and the rows of each interface as the source produces them, flushing to the client periodically
+func writeExport(w io.Writer, separator rune, source exportSource, granularity string, interfaces []string, dateRange exportRange) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = separator
+	flusher, _ := w.(http.Flusher)
+
+	if err := writer.Write([]string{"interface", "period_start", "period_end", "rx_bytes", "tx_bytes", "total_bytes"}); err != nil {
+		return err
+	}
+
+	rows := 0
+	err := source(func(name string, entries []TrafficEntry) error {
+		if len(interfaces) > 0 && !containsString(interfaces, name) {
+			return nil
+		}
+
+		for _, entry := range entries {
+			start := entry.Start()
+			if !dateRange.contains(start) {
+				continue
+			}
+
+			record := []string{
+				name,
+				start.Format(time.RFC3339),
+				periodEnd(start, granularity).Format(time.RFC3339),
+				strconv.FormatUint(entry.Rx, 10),
+				strconv.FormatUint(entry.Tx, 10),
+				strconv.FormatUint(entry.Total(), 10),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+
+			rows++
+			if rows%exportFlushRows == 0 {
+				writer.Flush()
+				if err := writer.Error(); err != nil {
+					return err
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
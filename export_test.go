@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dataSource is an export source over parsed data
+func dataSource(data *VnstatData, granularity string) exportSource {
+	return func(each func(name string, entries []TrafficEntry) error) error {
+		for _, iface := range data.Interfaces {
+			entries, _ := iface.Traffic.Entries(granularity)
+			if err := each(iface.Name, entries); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// exportDay is the period_start and period_end columns of 2026-10-<day>
+func exportDay(day int) string {
+	start := time.Date(2026, 10, day, 0, 0, 0, 0, time.Local)
+	return start.Format(time.RFC3339) + "," + start.AddDate(0, 0, 1).Format(time.RFC3339)
+}
+
+func TestWriteExport(t *testing.T) {
+	data := &VnstatData{Interfaces: []InterfaceData{
+		{Name: "eth0", Traffic: TrafficData{Day: []TrafficEntry{testDay(17, 100), testDay(18, 200), testDay(19, 300)}}},
+		{Name: "wg0", Traffic: TrafficData{Day: []TrafficEntry{testDay(18, 5)}}},
+	}}
+	from, err := parseExportTime("2026-10-18", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := parseExportTime("2026-10-18", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := "interface,period_start,period_end,rx_bytes,tx_bytes,total_bytes\n"
+
+	tests := []struct {
+		name       string
+		interfaces []string
+		dateRange  exportRange
+		want       string
+	}{
+		{"everything", nil, exportRange{}, header +
+			"eth0," + exportDay(17) + ",100,0,100\n" +
+			"eth0," + exportDay(18) + ",200,0,200\n" +
+			"eth0," + exportDay(19) + ",300,0,300\n" +
+			"wg0," + exportDay(18) + ",5,0,5\n"},
+		{"interface filter", []string{"wg0", "eth9"}, exportRange{}, header +
+			"wg0," + exportDay(18) + ",5,0,5\n"},
+		{"inclusive day range", nil, exportRange{From: from, To: to}, header +
+			"eth0," + exportDay(18) + ",200,0,200\n" +
+			"wg0," + exportDay(18) + ",5,0,5\n"},
+		{"open range", []string{"eth0"}, exportRange{From: from}, header +
+			"eth0," + exportDay(18) + ",200,0,200\n" +
+			"eth0," + exportDay(19) + ",300,0,300\n"},
+		{"nothing matches", []string{"eth0"}, exportRange{To: from.AddDate(0, 0, -1)}, header},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if err := writeExport(rec, ',', dataSource(data, "day"), "day", tt.interfaces, tt.dateRange); err != nil {
+				t.Fatal(err)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("tsv", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		if err := writeExport(rec, '\t', dataSource(data, "day"), "day", []string{"wg0"}, exportRange{}); err != nil {
+			t.Fatal(err)
+		}
+		want := strings.ReplaceAll(header+"wg0,"+exportDay(18)+",5,0,5\n", ",", "\t")
+		if got := rec.Body.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestWriteExportFlushes(t *testing.T) {
+	days := make([]TrafficEntry, exportFlushRows+1)
+	for i := range days {
+		days[i] = testDay(1, uint64(i))
+	}
+	data := &VnstatData{Interfaces: []InterfaceData{{Name: "eth0", Traffic: TrafficData{Day: days}}}}
+
+	// The first batch reaches the client before the source is done
+	rec := httptest.NewRecorder()
+	source := func(each func(name string, entries []TrafficEntry) error) error {
+		if err := dataSource(data, "day")(each); err != nil {
+			return err
+		}
+		if !rec.Flushed || strings.Count(rec.Body.String(), "\n") != exportFlushRows+1 {
+			t.Errorf("after %d rows: flushed %v, %d lines sent", len(days), rec.Flushed, strings.Count(rec.Body.String(), "\n"))
+		}
+		return nil
+	}
+	if err := writeExport(rec, ',', source, "day", nil, exportRange{}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != len(days)+1 {
+		t.Errorf("%d lines, want %d", lines, len(days)+1)
+	}
+}
+
+func TestStreamEntries(t *testing.T) {
+	// The fake vnstat records its arguments and prints eth0, eth1 and docker0
+	dir := t.TempDir()
+	output := strings.Replace(testVnstatJSON, `"interfaces": [{`, `"interfaces": [
+    {"name": "eth1", "alias": "", "created": {"date": {"year": 2026}, "timestamp": 0}, "updated": {"date": {"year": 2026}, "timestamp": 0},
+     "traffic": {"total": {"rx": 0, "tx": 0}, "day": [{"id": 1, "date": {"year": 2026, "month": 10, "day": 19}, "timestamp": 1792368000, "rx": 7, "tx": 3}]}},
+    {"name": "docker0", "alias": "", "created": {"date": {"year": 2026}, "timestamp": 0}, "updated": {"date": {"year": 2026}, "timestamp": 0},
+     "traffic": {"total": {"rx": 0, "tx": 0}, "day": [{"id": 1, "date": {"year": 2026, "month": 10, "day": 19}, "timestamp": 1792368000, "rx": 1, "tx": 1}]}},
+    {`, 1)
+	if err := os.WriteFile(filepath.Join(dir, "vnstat.json"), []byte(output), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\necho \"$@\" > '" + filepath.Join(dir, "args") + "'\ncat '" + filepath.Join(dir, "vnstat.json") + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "vnstat"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// eth0 has an older day in the archive
+	archive, err := NewArchive(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := TrafficEntry{Date: EntryDate{Year: 2026, Month: 10, Day: 1}, Timestamp: 1790812800, Rx: 11, Tx: 22}
+	if err := archive.Snapshot(&VnstatData{Interfaces: []InterfaceData{{Name: "eth0", Traffic: TrafficData{Day: []TrafficEntry{archived}}}}}, time.Unix(1790812800, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewVnstatService("")
+	service.archive = archive
+	service.SetInterfaceGrouping(NewInterfaceGrouping([]string{"docker*"}, []InterfaceGroup{{Name: "wan", Include: []string{"eth*"}}}))
+
+	var names []string
+	days := make(map[string][]uint64)
+	err = service.StreamEntries("day", func(name string, entries []TrafficEntry) error {
+		names = append(names, name)
+		for _, entry := range entries {
+			days[name] = append(days[name], entry.Total())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args, _ := os.ReadFile(filepath.Join(dir, "args")); string(args) != "--json d 0\n" {
+		t.Errorf("vnstat arguments = %q, want only the day granularity", args)
+	}
+	if want := []string{"eth1", "eth0", "wan"}; !slices.Equal(names, want) {
+		t.Errorf("interfaces = %v, want %v (docker0 excluded, group last)", names, want)
+	}
+	want := map[string][]uint64{
+		"eth1": {10},
+		"eth0": {33, 4000000, 2900000}, // The archived day first
+		"wan":  {33, 4000000, 2900010},
+	}
+	for name, totals := range want {
+		if !slices.Equal(days[name], totals) {
+			t.Errorf("%s day totals = %v, want %v", name, days[name], totals)
+		}
+	}
+}
+
+func TestExportVnstatFailure(t *testing.T) {
+	for name, script := range map[string]string{
+		"exit status":  "#!/bin/sh\necho 'Error: database not found' >&2\nexit 1\n",
+		"invalid JSON": "#!/bin/sh\necho '{\"interfaces\": [{'\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "vnstat"), []byte(script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+			handler, err := NewServer("secret", NewVnstatService("")).routes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := serve(t, handler, "GET", "/export.csv?token=secret")
+			if rec.Code != http.StatusInternalServerError || rec.Header().Get("Content-Disposition") != "" {
+				t.Errorf("status = %d, Content-Disposition %q; want 500 without an attachment", rec.Code, rec.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
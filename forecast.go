@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// forecastHistoryDays is how many complete days before today feed the forecast
+const forecastHistoryDays = 28
+
+// forecastMinWeekdaySamples is the minimum number of same-weekday days needed to use a weekday average
+const forecastMinWeekdaySamples = 2
+
+// forecastConfig holds the quota and billing cycle used by forecasts
+type forecastConfig struct {
+	Quota      float64 // Traffic quota per cycle (rx+tx) in bytes, 0 if not configured
+	BillingDay int     // Day of month the billing cycle starts (1 = calendar month)
+}
+
+// billingCycle returns the start and end of the billing cycle containing now
+// In months shorter than the billing day the cycle starts on the last day of the month
+func (c forecastConfig) billingCycle(now time.Time) (time.Time, time.Time) {
+	start := c.cycleStart(now.Year(), now.Month(), now.Location())
+	if start.After(now) {
+		start = c.cycleStart(now.Year(), now.Month()-1, now.Location())
+	}
+	return start, c.cycleStart(start.Year(), start.Month()+1, now.Location())
+}
+
+// cycleStart returns the midnight the billing cycle starts in the given month (months out of range wrap into adjacent years)
+func (c forecastConfig) cycleStart(year int, month time.Month, loc *time.Location) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := min(max(c.BillingDay, 1), lastDay)
+	return first.AddDate(0, 0, day-1)
+}
+
+// projection is the forecast of one direction (rx, tx or total) for the billing cycle
+type projection struct {
+	Used     float64 `json:"used"`     // Traffic so far in the cycle
+	Linear   float64 `json:"linear"`   // Run-rate of the cycle so far extended to the full cycle
+	Weekday  float64 `json:"weekday"`  // Used plus day-of-week averages for the remaining days
+	Estimate float64 `json:"estimate"` // Mean of the linear and weekday estimates
+	Low      float64 `json:"low"`      // Lower bound of the 95% confidence range
+	High     float64 `json:"high"`     // Upper bound of the 95% confidence range
+}
+
+// trafficForecast is the cycle forecast of one interface
+type trafficForecast struct {
+	CycleStart    time.Time
+	CycleEnd      time.Time
+	DaysElapsed   float64
+	DaysRemaining float64
+	HistoryDays   int // Complete days used as history
+	Rx            projection
+	Tx            projection
+	Total         projection
+
+	Quota          float64  // Quota in bytes, 0 if not configured
+	QuotaUsed      float64  // Fraction of the quota used so far
+	DaysUntilQuota *float64 // Days until the projected usage reaches the quota, nil if it is not expected to
+}
+
+// forecastTraffic projects the billing cycle traffic of an interface from its daily history
+// Returns nil if the interface has no daily data
+func forecastTraffic(traffic TrafficData, cfg forecastConfig, now time.Time) *trafficForecast {
+	if len(traffic.Day) == 0 {
+		return nil
+	}
+
+	cycleStart, cycleEnd := cfg.billingCycle(now)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	historyStart := today.AddDate(0, 0, -forecastHistoryDays)
+
+	f := &trafficForecast{
+		CycleStart:    cycleStart,
+		CycleEnd:      cycleEnd,
+		DaysElapsed:   now.Sub(cycleStart).Hours() / 24,
+		DaysRemaining: cycleEnd.Sub(now).Hours() / 24,
+		Quota:         cfg.Quota,
+	}
+
+	// Split daily entries into cycle usage and complete history days
+	var history []TrafficEntry
+	var usedRx, usedTx float64
+	for _, entry := range traffic.Day {
+		start := entry.Start()
+		if !start.Before(cycleStart) && start.Before(cycleEnd) {
+			usedRx += float64(entry.Rx)
+			usedTx += float64(entry.Tx)
+		}
+		if !start.Before(historyStart) && start.Before(today) {
+			history = append(history, entry)
+		}
+	}
+	f.HistoryDays = len(history)
+
+	// Remaining time as (weekday, fraction of day) slots: the rest of today, then whole days
+	type slot struct {
+		weekday  time.Weekday
+		fraction float64
+	}
+	var slots []slot
+	for day := today; day.Before(cycleEnd); day = day.AddDate(0, 0, 1) {
+		fraction := 1.0
+		if day.Equal(today) {
+			fraction = 1 - now.Sub(today).Hours()/24
+		}
+		slots = append(slots, slot{day.Weekday(), fraction})
+	}
+
+	project := func(used float64, value func(TrafficEntry) float64) projection {
+		p := projection{Used: used}
+		if f.DaysElapsed > 0 {
+			p.Linear = used / f.DaysElapsed * (f.DaysElapsed + f.DaysRemaining)
+		}
+
+		// Without history, fall back to the run-rate only
+		if len(history) == 0 {
+			p.Weekday, p.Estimate, p.Low, p.High = p.Linear, p.Linear, p.Linear, p.Linear
+			return p
+		}
+
+		var sum float64
+		byWeekday := make(map[time.Weekday][]float64)
+		for _, entry := range history {
+			v := value(entry)
+			sum += v
+			byWeekday[entry.Start().Weekday()] = append(byWeekday[entry.Start().Weekday()], v)
+		}
+		mean := sum / float64(len(history))
+
+		var variance float64
+		for _, entry := range history {
+			variance += math.Pow(value(entry)-mean, 2)
+		}
+		stddev := math.Sqrt(variance / float64(len(history)))
+
+		p.Weekday = used
+		remaining := 0.0
+		for _, s := range slots {
+			expected := mean
+			if samples := byWeekday[s.weekday]; len(samples) >= forecastMinWeekdaySamples {
+				expected = average(samples)
+			}
+			p.Weekday += expected * s.fraction
+			remaining += s.fraction
+		}
+
+		p.Estimate = p.Weekday
+		if f.DaysElapsed >= 1 {
+			// The run-rate is too noisy during the first day of the cycle
+			p.Estimate = (p.Linear + p.Weekday) / 2
+		}
+
+		// Daily totals are treated as independent, so the spread grows with the square root of the remaining days
+		margin := 1.96 * stddev * math.Sqrt(remaining)
+		p.Low = math.Max(used, p.Estimate-margin)
+		p.High = p.Estimate + margin
+		return p
+	}
+
+	f.Rx = project(usedRx, func(e TrafficEntry) float64 { return float64(e.Rx) })
+	f.Tx = project(usedTx, func(e TrafficEntry) float64 { return float64(e.Tx) })
+	f.Total = project(usedRx+usedTx, func(e TrafficEntry) float64 { return float64(e.Total()) })
+
+	if cfg.Quota > 0 {
+		f.QuotaUsed = f.Total.Used / cfg.Quota
+		if f.Total.Used >= cfg.Quota {
+			zero := 0.0
+			f.DaysUntilQuota = &zero
+		} else if f.DaysRemaining > 0 {
+			dailyRate := (f.Total.Estimate - f.Total.Used) / f.DaysRemaining
+			// Usage resets with the next cycle, so only exhaustion within this cycle counts
+			if days := (cfg.Quota - f.Total.Used) / dailyRate; dailyRate > 0 && days <= f.DaysRemaining {
+				f.DaysUntilQuota = &days
+			}
+		}
+	}
+
+	return f
+}
+
+// average returns the arithmetic mean of values
+func average(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// forecastSummary is the JSON form of a forecast in /summary.json
+type forecastSummary struct {
+	CycleStart    string                `json:"cycle_start"`
+	CycleEnd      string                `json:"cycle_end"`
+	DaysElapsed   float64               `json:"days_elapsed"`
+	DaysRemaining float64               `json:"days_remaining"`
+	HistoryDays   int                   `json:"history_days"`
+	Rx            projectionSummary     `json:"rx"`
+	Tx            projectionSummary     `json:"tx"`
+	Total         projectionSummary     `json:"total"`
+	Quota         *quotaForecastSummary `json:"quota,omitempty"`
+}
+
+// projectionSummary is a projection with formatted values
+type projectionSummary struct {
+	projection
+	EstimateFormatted string `json:"estimate_formatted"`
+	LowFormatted      string `json:"low_formatted"`
+	HighFormatted     string `json:"high_formatted"`
+}
+
+// quotaForecastSummary describes quota usage and exhaustion
+type quotaForecastSummary struct {
+	Bytes          float64  `json:"bytes"`
+	BytesFormatted string   `json:"bytes_formatted"`
+	UsedPercent    float64  `json:"used_percent"`
+	DaysUntil      *float64 `json:"days_until_exhausted"` // null if not expected to be exhausted
+	ExhaustedAt    *string  `json:"exhausted_at"`
+}
+
+// summary converts the forecast to its JSON form
+func (f *trafficForecast) summary(units unitOptions, now time.Time) *forecastSummary {
+	convert := func(p projection) projectionSummary {
+		return projectionSummary{
+			projection:        p,
+			EstimateFormatted: units.Volume(p.Estimate),
+			LowFormatted:      units.Volume(p.Low),
+			HighFormatted:     units.Volume(p.High),
+		}
+	}
+
+	s := &forecastSummary{
+		CycleStart:    f.CycleStart.Format(time.RFC3339),
+		CycleEnd:      f.CycleEnd.Format(time.RFC3339),
+		DaysElapsed:   roundTo(f.DaysElapsed, 2),
+		DaysRemaining: roundTo(f.DaysRemaining, 2),
+		HistoryDays:   f.HistoryDays,
+		Rx:            convert(f.Rx),
+		Tx:            convert(f.Tx),
+		Total:         convert(f.Total),
+	}
+
+	if f.Quota > 0 {
+		quota := &quotaForecastSummary{
+			Bytes:          f.Quota,
+			BytesFormatted: units.Volume(f.Quota),
+			UsedPercent:    roundTo(f.QuotaUsed*100, 1),
+		}
+		if f.DaysUntilQuota != nil {
+			days := roundTo(*f.DaysUntilQuota, 1)
+			at := now.Add(time.Duration(*f.DaysUntilQuota * 24 * float64(time.Hour))).Format(time.RFC3339)
+			quota.DaysUntil, quota.ExhaustedAt = &days, &at
+		}
+		s.Quota = quota
+	}
+
+	return s
+}
+
+// roundTo rounds v to the given number of decimals
+func roundTo(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// renderForecastLines writes the forecast below a monthly table in the text views
+func (r *textRenderer) renderForecastLines(b *strings.Builder, traffic TrafficData) {
+	if r.opts.Forecast == nil {
+		return
+	}
+	f := forecastTraffic(traffic, *r.opts.Forecast, r.now)
+	if f == nil {
+		return
+	}
+
+	fmt.Fprintf(b, "     estimated %s - %s: %s (rx %s, tx %s), range %s - %s\n",
+		f.CycleStart.Format("2006-01-02"), f.CycleEnd.AddDate(0, 0, -1).Format("2006-01-02"),
+		r.opts.Volume(f.Total.Estimate), r.opts.Volume(f.Rx.Estimate), r.opts.Volume(f.Tx.Estimate),
+		r.opts.Volume(f.Total.Low), r.opts.Volume(f.Total.High))
+
+	if f.Quota > 0 {
+		status := "not expected to be exhausted this cycle"
+		if f.DaysUntilQuota != nil {
+			if *f.DaysUntilQuota == 0 {
+				status = "exhausted"
+			} else {
+				status = fmt.Sprintf("exhausted in %.1f days", *f.DaysUntilQuota)
+			}
+		}
+		fmt.Fprintf(b, "     quota %s: %s used (%.0f%%), %s\n",
+			r.opts.Volume(f.Quota), r.opts.Volume(f.Total.Used), f.QuotaUsed*100, status)
+	}
+}
+
+// generateForecastMetrics renders forecast gauges in Prometheus format
+func generateForecastMetrics(data *VnstatData, cfg forecastConfig, labels *labelConfig, now time.Time) string {
+	var metrics strings.Builder
+
+	type interfaceForecast struct {
+		name     string
+		forecast *trafficForecast
+	}
+	var forecasts []interfaceForecast
+	for _, iface := range data.Interfaces {
+		if f := forecastTraffic(iface.Traffic, cfg, now); f != nil {
+			forecasts = append(forecasts, interfaceForecast{iface.Name, f})
+		}
+	}
+	sort.Slice(forecasts, func(i, j int) bool { return forecasts[i].name < forecasts[j].name })
+
+	metrics.WriteString("# HELP vnstat_forecast_cycle_bytes Projected traffic for the current billing cycle in bytes\n")
+	metrics.WriteString("# TYPE vnstat_forecast_cycle_bytes gauge\n")
+	for _, item := range forecasts {
+		name := labels.interfaceLabels(item.name)
+		directions := []struct {
+			label string
+			p     projection
+		}{{"rx", item.forecast.Rx}, {"tx", item.forecast.Tx}, {"total", item.forecast.Total}}
+		for _, d := range directions {
+			values := []struct {
+				kind  string
+				value float64
+			}{{"linear", d.p.Linear}, {"weekday", d.p.Weekday}, {"estimate", d.p.Estimate}, {"low", d.p.Low}, {"high", d.p.High}}
+			for _, v := range values {
+				metrics.WriteString(fmt.Sprintf("vnstat_forecast_cycle_bytes{%s,direction=\"%s\",kind=\"%s\"} %.0f\n", name, d.label, v.kind, v.value))
+			}
+		}
+	}
+
+	metrics.WriteString("# HELP vnstat_forecast_cycle_end_timestamp_seconds End of the current billing cycle\n")
+	metrics.WriteString("# TYPE vnstat_forecast_cycle_end_timestamp_seconds gauge\n")
+	for _, item := range forecasts {
+		metrics.WriteString(fmt.Sprintf("vnstat_forecast_cycle_end_timestamp_seconds{%s} %d\n", labels.interfaceLabels(item.name), item.forecast.CycleEnd.Unix()))
+	}
+
+	if cfg.Quota > 0 {
+		metrics.WriteString("# HELP vnstat_forecast_days_until_quota Projected days until the traffic quota is exhausted (absent if not expected)\n")
+		metrics.WriteString("# TYPE vnstat_forecast_days_until_quota gauge\n")
+		for _, item := range forecasts {
+			if item.forecast.DaysUntilQuota != nil {
+				metrics.WriteString(fmt.Sprintf("vnstat_forecast_days_until_quota{%s} %.2f\n", labels.interfaceLabels(item.name), *item.forecast.DaysUntilQuota))
+			}
+		}
+	}
+
+	return metrics.String()
+}
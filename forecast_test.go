@@ -0,0 +1,174 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBillingCycle(t *testing.T) {
+	localUTC(t)
+	date := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		billingDay int
+		now        time.Time
+		start, end time.Time
+	}{
+		{"calendar month", 1, date(2026, 10, 19, 12), date(2026, 10, 1, 0), date(2026, 11, 1, 0)},
+		{"unset day", 0, date(2026, 10, 19, 12), date(2026, 10, 1, 0), date(2026, 11, 1, 0)},
+		{"after the billing day", 15, date(2026, 10, 19, 12), date(2026, 10, 15, 0), date(2026, 11, 15, 0)},
+		{"before the billing day", 15, date(2026, 10, 14, 23), date(2026, 9, 15, 0), date(2026, 10, 15, 0)},
+		{"cycle starting today at midnight", 15, date(2026, 10, 15, 0), date(2026, 10, 15, 0), date(2026, 11, 15, 0)},
+		{"cycle starting today", 15, date(2026, 10, 15, 9), date(2026, 10, 15, 0), date(2026, 11, 15, 0)},
+		{"across the year", 20, date(2027, 1, 5, 0), date(2026, 12, 20, 0), date(2027, 1, 20, 0)},
+		{"day 31 in February", 31, date(2026, 2, 28, 9), date(2026, 2, 28, 0), date(2026, 3, 31, 0)},
+		{"day 31 before the end of February", 31, date(2026, 2, 27, 9), date(2026, 1, 31, 0), date(2026, 2, 28, 0)},
+		{"day 31 in a leap February", 31, date(2028, 2, 28, 9), date(2028, 1, 31, 0), date(2028, 2, 29, 0)},
+		{"day 31 in a 30-day month", 31, date(2026, 4, 30, 9), date(2026, 4, 30, 0), date(2026, 5, 31, 0)},
+		{"day 30 in March", 30, date(2026, 3, 1, 9), date(2026, 2, 28, 0), date(2026, 3, 30, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := forecastConfig{BillingDay: tt.billingDay}.billingCycle(tt.now)
+			if !start.Equal(tt.start) || !end.Equal(tt.end) {
+				t.Errorf("billingCycle(%v) = %v - %v, want %v - %v", tt.now, start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+// forecastDays returns day entries from first to last (inclusive) with value(day) bytes received
+func forecastDays(first, last time.Time, value func(time.Time) uint64) []TrafficEntry {
+	var days []TrafficEntry
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, TrafficEntry{Date: newEntryDate(day, "day"), Rx: value(day)})
+	}
+	return days
+}
+
+// approxEqual reports whether a and b agree to 1e-9 relative precision
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
+
+func TestForecastTraffic(t *testing.T) {
+	localUTC(t)
+	weekendHeavy := func(day time.Time) uint64 {
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			return 10e6
+		}
+		return 1e6
+	}
+	// Thursday 2026-10-15 at midnight: 14 days of the October cycle elapsed, 17 remain
+	now := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	traffic := TrafficData{Day: forecastDays(now.AddDate(0, 0, -40), now.AddDate(0, 0, -1), weekendHeavy)}
+
+	f := forecastTraffic(traffic, forecastConfig{BillingDay: 1}, now)
+	if f == nil {
+		t.Fatal("no forecast")
+	}
+	if f.DaysElapsed != 14 || f.DaysRemaining != 17 || f.HistoryDays != forecastHistoryDays {
+		t.Errorf("elapsed %v, remaining %v, history %d; want 14, 17, %d", f.DaysElapsed, f.DaysRemaining, f.HistoryDays, forecastHistoryDays)
+	}
+
+	// October 1-14 has 4 weekend days; October 15-31 has 5 weekend days and 12 weekdays
+	used := 4*10e6 + 10*1e6
+	linear := used / 14 * 31
+	weekday := used + 5*10e6 + 12*1e6
+	estimate := (linear + weekday) / 2
+	// 28 days of history: 8 weekend days and 20 weekdays
+	mean := (8*10e6 + 20*1e6) / 28
+	stddev := math.Sqrt((8*math.Pow(10e6-mean, 2) + 20*math.Pow(1e6-mean, 2)) / 28)
+	margin := 1.96 * stddev * math.Sqrt(17)
+
+	want := projection{Used: used, Linear: linear, Weekday: weekday, Estimate: estimate, Low: math.Max(used, estimate-margin), High: estimate + margin}
+	got := f.Rx
+	if got.Used != want.Used || !approxEqual(got.Linear, want.Linear) || !approxEqual(got.Weekday, want.Weekday) ||
+		!approxEqual(got.Estimate, want.Estimate) || !approxEqual(got.Low, want.Low) || !approxEqual(got.High, want.High) {
+		t.Errorf("rx = %+v, want %+v", got, want)
+	}
+	if f.Tx != (projection{}) {
+		t.Errorf("tx = %+v, want zero", f.Tx)
+	}
+	if !approxEqual(f.Total.Estimate, estimate) {
+		t.Errorf("total estimate = %v, want %v", f.Total.Estimate, estimate)
+	}
+
+	t.Run("constant history has no spread", func(t *testing.T) {
+		flat := TrafficData{Day: forecastDays(now.AddDate(0, 0, -30), now.AddDate(0, 0, -1), func(time.Time) uint64 { return 2e6 })}
+		f := forecastTraffic(flat, forecastConfig{}, now)
+		if !approxEqual(f.Rx.Linear, 62e6) || !approxEqual(f.Rx.Weekday, 62e6) || f.Rx.Low != f.Rx.High || !approxEqual(f.Rx.High, 62e6) {
+			t.Errorf("rx = %+v, want 62e6 without a range", f.Rx)
+		}
+	})
+
+	t.Run("run-rate only without history", func(t *testing.T) {
+		noon := now.Add(12 * time.Hour)
+		today := TrafficData{Day: forecastDays(now, now, func(time.Time) uint64 { return 29e6 })}
+		f := forecastTraffic(today, forecastConfig{}, noon)
+		want := 29e6 / 14.5 * 31
+		if f.HistoryDays != 0 || !approxEqual(f.Rx.Linear, want) || f.Rx.Weekday != f.Rx.Linear ||
+			f.Rx.Estimate != f.Rx.Linear || f.Rx.Low != f.Rx.Linear || f.Rx.High != f.Rx.Linear {
+			t.Errorf("rx = %+v, want every estimate %v", f.Rx, want)
+		}
+	})
+
+	t.Run("first day of the cycle uses the weekday estimate", func(t *testing.T) {
+		start := time.Date(2026, 10, 1, 6, 0, 0, 0, time.UTC)
+		f := forecastTraffic(TrafficData{Day: forecastDays(start.AddDate(0, 0, -28), start, weekendHeavy)}, forecastConfig{}, start)
+		if f.DaysElapsed >= 1 || f.Rx.Estimate != f.Rx.Weekday {
+			t.Errorf("elapsed %v: estimate %v, want the weekday estimate %v", f.DaysElapsed, f.Rx.Estimate, f.Rx.Weekday)
+		}
+	})
+
+	if f := forecastTraffic(TrafficData{}, forecastConfig{}, now); f != nil {
+		t.Errorf("forecast without days = %+v, want nil", f)
+	}
+}
+
+func TestForecastQuota(t *testing.T) {
+	localUTC(t)
+	now := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	// 2 MB every day: 28 MB used, 34 MB more expected by the end of the cycle
+	traffic := TrafficData{Day: forecastDays(now.AddDate(0, 0, -30), now.AddDate(0, 0, -1), func(time.Time) uint64 { return 2e6 })}
+
+	tests := []struct {
+		name     string
+		quota    float64
+		used     float64
+		daysLeft *float64
+	}{
+		{"exhausted", 20e6, 1.4, ptr(0.0)},
+		{"exhausted exactly", 28e6, 1, ptr(0.0)},
+		{"exhausted within the cycle", 40e6, 0.7, ptr(6.0)},
+		{"exhausted on the last day", 62e6, 28e6 / 62e6, ptr(17.0)},
+		{"not exhausted this cycle", 100e6, 0.28, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := forecastTraffic(traffic, forecastConfig{Quota: tt.quota}, now)
+			if !approxEqual(f.QuotaUsed, tt.used) {
+				t.Errorf("quota used = %v, want %v", f.QuotaUsed, tt.used)
+			}
+			switch {
+			case tt.daysLeft == nil && f.DaysUntilQuota != nil:
+				t.Errorf("days until quota = %v, want nil", *f.DaysUntilQuota)
+			case tt.daysLeft != nil && (f.DaysUntilQuota == nil || math.Abs(*f.DaysUntilQuota-*tt.daysLeft) > 1e-9):
+				t.Errorf("days until quota = %v, want %v", f.DaysUntilQuota, *tt.daysLeft)
+			}
+		})
+	}
+
+	if f := forecastTraffic(traffic, forecastConfig{}, now); f.QuotaUsed != 0 || f.DaysUntilQuota != nil {
+		t.Errorf("without a quota: used %v, days %v", f.QuotaUsed, f.DaysUntilQuota)
+	}
+}
+
+// ptr returns a pointer to v
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxStatsdPacketSize keeps StatsD datagrams below the common Ethernet MTU
+const maxStatsdPacketSize = 1400
+
+// GraphiteExporter periodically sends traffic counters as Graphite plaintext (TCP) or StatsD gauges (UDP)
+type GraphiteExporter struct {
+	addr     string // Destination host:port
+	protocol string // "graphite" or "statsd"
+	prefix   string // Metric prefix template, supports {hostname} and {interface}
+	service  *VnstatService
+}
+
+// NewGraphiteExporter creates a new GraphiteExporter instance
+func NewGraphiteExporter(addr, protocol, prefix string, service *VnstatService) (*GraphiteExporter, error) {
+	protocol = strings.ToLower(protocol)
+	if protocol != "graphite" && protocol != "statsd" {
+		return nil, fmt.Errorf("unsupported protocol %q (expected graphite or statsd)", protocol)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+
+	return &GraphiteExporter{
+		addr:     addr,
+		protocol: protocol,
+		prefix:   prefix,
+		service:  service,
+	}, nil
+}
+
+// Start runs the exporter on the shared periodic scheduler
+func (e *GraphiteExporter) Start(port string, interval time.Duration) {
+	startPeriodicTask("Graphite export", port, interval, e.export)
+}
+
+// export fetches the current counters and sends them to the configured destination
+func (e *GraphiteExporter) export() {
+	start, succeeded := time.Now(), false
+	defer func() { selfMetrics.observePush("graphite", start, succeeded) }()
+
+	jsonData, err := e.service.GetJSON()
+	if err != nil {
+		slog.Error("Graphite export: failed to get JSON data", "err", err)
+		return
+	}
+
+	var vnstatData map[string]interface{}
+	if err := json.Unmarshal(jsonData, &vnstatData); err != nil {
+		slog.Error("Graphite export: failed to parse JSON data", "err", err)
+		return
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+		slog.Warn("Graphite export: failed to get hostname, using 'unknown'", "err", err)
+	}
+
+	lines := e.buildLines(vnstatData, hostname, time.Now())
+	if len(lines) == 0 {
+		slog.Warn("Graphite export: no interface data available")
+		return
+	}
+
+	if e.protocol == "statsd" {
+		err = e.sendStatsd(lines)
+	} else {
+		err = e.sendGraphite(lines)
+	}
+	if err != nil {
+		slog.Error("Graphite export: failed to send metrics", "addr", e.addr, "err", err)
+		return
+	}
+	succeeded = true
+}
+
+// buildLines formats the per-interface counters in the wire format of the configured protocol
+func (e *GraphiteExporter) buildLines(data map[string]interface{}, hostname string, now time.Time) []string {
+	interfaces, ok := extractInterfaceTraffic(data)
+	if !ok {
+		return nil
+	}
+
+	var lines []string
+	for _, iface := range interfaces {
+		prefix := e.metricPrefix(hostname, iface.Name)
+
+		if iface.HasTotal {
+			lines = append(lines, e.formatLine(prefix+".total.rx", iface.TotalRx, now))
+			lines = append(lines, e.formatLine(prefix+".total.tx", iface.TotalTx, now))
+		}
+		if iface.HasMonth {
+			lines = append(lines, e.formatLine(prefix+".month.rx", iface.MonthRx, now))
+			lines = append(lines, e.formatLine(prefix+".month.tx", iface.MonthTx, now))
+		}
+		if iface.HasToday {
+			lines = append(lines, e.formatLine(prefix+".today.rx", iface.TodayRx, now))
+			lines = append(lines, e.formatLine(prefix+".today.tx", iface.TodayTx, now))
+		}
+	}
+
+	return lines
+}
+
+// metricPrefix expands the prefix template for one interface
+func (e *GraphiteExporter) metricPrefix(hostname, interfaceName string) string {
+	prefix := strings.ReplaceAll(e.prefix, "{hostname}", sanitizeGraphitePath(hostname))
+	prefix = strings.ReplaceAll(prefix, "{interface}", sanitizeGraphitePath(interfaceName))
+	return strings.Trim(prefix, ".")
+}
+
+// formatLine formats one metric as a Graphite plaintext line or a StatsD gauge
+func (e *GraphiteExporter) formatLine(path string, value float64, now time.Time) string {
+	if e.protocol == "statsd" {
+		return fmt.Sprintf("%s:%.0f|g", path, value)
+	}
+	return fmt.Sprintf("%s %.0f %d", path, value, now.Unix())
+}
+
+// sendGraphite writes all lines over a single TCP connection
+func (e *GraphiteExporter) sendGraphite(lines []string) error {
+	conn, err := net.DialTimeout("tcp", e.addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err = conn.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	return err
+}
+
+// sendStatsd writes lines as UDP datagrams, batching as many lines per packet as fit
+func (e *GraphiteExporter) sendStatsd(lines []string) error {
+	conn, err := net.Dial("udp", e.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxStatsdPacketSize {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		_, err = conn.Write(packet.Bytes())
+	}
+	return err
+}
+
+// sanitizeGraphitePath replaces characters that have special meaning in Graphite/StatsD metric paths
+func sanitizeGraphitePath(s string) string {
+	replacer := strings.NewReplacer(".", "_", " ", "_", ":", "_", "|", "_", "/", "_", "\n", "_")
+	return replacer.Replace(s)
+}
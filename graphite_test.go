@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGraphiteHostname is the sanitized host name the exporter puts into metric paths
+func testGraphiteHostname(t *testing.T) string {
+	t.Helper()
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sanitizeGraphitePath(hostname)
+}
+
+func TestSanitizeGraphitePath(t *testing.T) {
+	tests := map[string]string{
+		"eth0":            "eth0",
+		"eth0.100":        "eth0_100",
+		"web.example.com": "web_example_com",
+		"my iface":        "my_iface",
+		"a:b|c/d\ne":      "a_b_c_d_e",
+		"wg-home_1":       "wg-home_1",
+	}
+	for input, want := range tests {
+		if got := sanitizeGraphitePath(input); got != want {
+			t.Errorf("sanitizeGraphitePath(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestGraphiteMetricPrefix(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"vnstat.{hostname}.{interface}", "vnstat.web_example_com.eth0_100"},
+		{".{interface}.", "eth0_100"},
+		{"net", "net"},
+	}
+	for _, tt := range tests {
+		e := &GraphiteExporter{prefix: tt.template}
+		if got := e.metricPrefix("web.example.com", "eth0.100"); got != tt.want {
+			t.Errorf("metricPrefix with %q = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestGraphitePlaintextExport(t *testing.T) {
+	fakeVnstat(t, testVnstatJSON)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		defer conn.Close()
+		body, _ := io.ReadAll(conn)
+		received <- string(body)
+	}()
+
+	exporter, err := NewGraphiteExporter(listener.Addr().String(), "graphite", "vnstat.{hostname}.{interface}", NewVnstatService(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().Unix()
+	exporter.export()
+	after := time.Now().Unix()
+
+	var body string
+	select {
+	case body = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection from the exporter")
+	}
+	if !strings.HasSuffix(body, "\n") {
+		t.Errorf("body %q does not end with a newline", body)
+	}
+
+	prefix := "vnstat." + testGraphiteHostname(t) + ".eth0"
+	want := []string{
+		prefix + ".total.rx 8000000000",
+		prefix + ".total.tx 2000000000",
+		prefix + ".month.rx 50000000",
+		prefix + ".month.tx 20000000",
+		prefix + ".today.rx 2000000",
+		prefix + ".today.tx 900000",
+	}
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), body)
+	}
+	for i, line := range lines {
+		// path value timestamp; the timestamp is the time of the export
+		cut := strings.LastIndexByte(line, ' ')
+		if cut < 0 || line[:cut] != want[i] {
+			t.Errorf("line %d = %q, want %q followed by a timestamp", i, line, want[i])
+			continue
+		}
+		timestamp, err := strconv.ParseInt(line[cut+1:], 10, 64)
+		if err != nil || timestamp < before || timestamp > after {
+			t.Errorf("line %d timestamp %q, want unix seconds between %d and %d", i, line[cut+1:], before, after)
+		}
+	}
+}
+
+func TestGraphiteFormatLine(t *testing.T) {
+	now := time.Unix(1792420800, 0)
+	graphite := &GraphiteExporter{protocol: "graphite"}
+	if got, want := graphite.formatLine("a.b.rx", 1234567890123, now), "a.b.rx 1234567890123 1792420800"; got != want {
+		t.Errorf("graphite line = %q, want %q", got, want)
+	}
+	statsd := &GraphiteExporter{protocol: "statsd"}
+	if got, want := statsd.formatLine("a.b.rx", 1234567890123, now), "a.b.rx:1234567890123|g"; got != want {
+		t.Errorf("statsd line = %q, want %q", got, want)
+	}
+}
+
+func TestStatsdExport(t *testing.T) {
+	fakeVnstat(t, testVnstatJSON)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	exporter, err := NewGraphiteExporter(conn.LocalAddr().String(), "statsd", "net.{interface}", NewVnstatService(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter.export()
+
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"net.eth0.total.rx:8000000000|g",
+		"net.eth0.total.tx:2000000000|g",
+		"net.eth0.month.rx:50000000|g",
+		"net.eth0.month.tx:20000000|g",
+		"net.eth0.today.rx:2000000|g",
+		"net.eth0.today.tx:900000|g",
+	}, "\n")
+	if got := string(buf[:n]); got != want {
+		t.Errorf("datagram =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestStatsdPacketBatching(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var lines []string
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf("vnstat.host.interface%03d.total.rx:%d|g", i, 1000000000+i))
+	}
+	exporter := &GraphiteExporter{addr: conn.LocalAddr().String(), protocol: "statsd"}
+	if err := exporter.sendStatsd(lines); err != nil {
+		t.Fatal(err)
+	}
+
+	var received []string
+	buf := make([]byte, 65536)
+	for len(received) < len(lines) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("after %d lines: %v", len(received), err)
+		}
+		if n > maxStatsdPacketSize {
+			t.Errorf("datagram of %d bytes, want at most %d", n, maxStatsdPacketSize)
+		}
+		received = append(received, strings.Split(string(buf[:n]), "\n")...)
+	}
+	if strings.Join(received, "\n") != strings.Join(lines, "\n") {
+		t.Error("lines were lost, split or reordered across datagrams")
+	}
+}
+
+func TestNewGraphiteExporterErrors(t *testing.T) {
+	if _, err := NewGraphiteExporter("localhost:2003", "carbon", "", nil); err == nil {
+		t.Error("unknown protocol accepted")
+	}
+	if _, err := NewGraphiteExporter("localhost", "graphite", "", nil); err == nil {
+		t.Error("address without port accepted")
+	}
+	if exporter, err := NewGraphiteExporter("localhost:8125", "StatsD", "", nil); err != nil || exporter.protocol != "statsd" {
+		t.Errorf("protocol is not case-insensitive: %v", err)
+	}
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// graphqlMaxBodyBytes bounds the size of a POST /graphql request body
+const graphqlMaxBodyBytes = 1 << 20
+
+// List sizes assumed by the complexity limit when a query does not bound a list
+const (
+	graphqlInterfaceListSize = 10  // interfaces without names
+	graphqlLabelListSize     = 10  // labels of an interface
+	graphqlEntryListSize     = 100 // traffic and top without limit
+)
+
+// graphqlContext is the data a query is resolved against, fetched once per request
+type graphqlContext struct {
+	data     *VnstatData
+	labels   *labelConfig
+	forecast forecastConfig
+	now      time.Time
+}
+
+// graphqlPeriod is the source of Traffic and TrafficPeriod objects
+type graphqlPeriod struct {
+	start, end time.Time
+	rx, tx     uint64
+}
+
+// graphqlLabel is the source of Label objects
+type graphqlLabel struct {
+	name, value string
+}
+
+// graphqlProperty wraps a resolver that only reads its source
+func graphqlProperty(get func(source interface{}) interface{}) graphqlResolver {
+	return func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+		return get(source), nil
+	}
+}
+
+// graphqlUnits returns the unit options selected by a units argument (IEC, SI or BYTES)
+func graphqlUnits(args map[string]interface{}) unitOptions {
+	units := defaultUnitOptions()
+	if value, ok := args["units"].(string); ok {
+		units.Units = strings.ToLower(value)
+	}
+	return units
+}
+
+// graphqlUnitsArgument is the units argument of formatted fields
+func graphqlUnitsArgument() []*graphqlArgumentDefinition {
+	return []*graphqlArgumentDefinition{{Name: "units", Type: "Units", Default: "IEC"}}
+}
+
+// graphqlListSize returns the limit argument, or fallback when the list is unbounded
+func graphqlListSize(fallback int) func(args map[string]interface{}) int {
+	return func(args map[string]interface{}) int {
+		if limit, ok := args["limit"].(int); ok && limit > 0 {
+			return limit
+		}
+		return fallback
+	}
+}
+
+// graphqlVolumeFields are the byte count fields shared by Traffic and TrafficPeriod
+func graphqlVolumeFields() []*graphqlFieldDefinition {
+	volume := func(name, description string, bytes func(p graphqlPeriod) uint64) []*graphqlFieldDefinition {
+		return []*graphqlFieldDefinition{
+			{Name: name, Description: description, Type: "Bytes!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+				return bytes(source.(graphqlPeriod))
+			})},
+			{Name: name + "Formatted", Description: description + ", human-readable", Type: "String!", Args: graphqlUnitsArgument(), Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return graphqlUnits(args).Volume(float64(bytes(source.(graphqlPeriod)))), nil
+			}},
+		}
+	}
+
+	var fields []*graphqlFieldDefinition
+	fields = append(fields, volume("rx", "Received bytes", func(p graphqlPeriod) uint64 { return p.rx })...)
+	fields = append(fields, volume("tx", "Transmitted bytes", func(p graphqlPeriod) uint64 { return p.tx })...)
+	fields = append(fields, volume("total", "Received plus transmitted bytes", func(p graphqlPeriod) uint64 { return p.rx + p.tx })...)
+	return fields
+}
+
+// graphqlTimestamp formats a vnstat timestamp as RFC 3339, nil if it is unknown
+func graphqlTimestamp(stamp EntryStamp) interface{} {
+	if stamp.Timestamp <= 0 {
+		return nil
+	}
+	return time.Unix(stamp.Timestamp, 0).Format(time.RFC3339)
+}
+
+// graphqlPeriods converts traffic entries of a granularity to TrafficPeriod sources
+func graphqlPeriods(entries []TrafficEntry, granularity string) []interface{} {
+	periods := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		start := entry.Start()
+		periods = append(periods, graphqlPeriod{start: start, end: periodEnd(start, granularity), rx: entry.Rx, tx: entry.Tx})
+	}
+	return periods
+}
+
+// newTrafficGraphQLSchema builds the schema of /graphql over the typed traffic model
+func newTrafficGraphQLSchema() (*graphqlSchema, error) {
+	query := &graphqlType{Name: "Query", Kind: graphqlKindObject, Fields: []*graphqlFieldDefinition{
+		{
+			Name:        "interfaces",
+			Description: "Interfaces in vnstat order, optionally only the named ones",
+			Type:        "[Interface!]!",
+			Args:        []*graphqlArgumentDefinition{{Name: "names", Type: "[String!]"}},
+			Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+				names, filtered := args["names"].([]interface{})
+				interfaces := []interface{}{}
+				for i := range ctx.data.Interfaces {
+					iface := &ctx.data.Interfaces[i]
+					if !filtered || containsValue(names, iface.Name) {
+						interfaces = append(interfaces, iface)
+					}
+				}
+				return interfaces, nil
+			},
+			ListSize: func(args map[string]interface{}) int {
+				if names, ok := args["names"].([]interface{}); ok {
+					return len(names)
+				}
+				return graphqlInterfaceListSize
+			},
+		},
+		{
+			Name:        "interface",
+			Description: "One interface, null if it does not exist",
+			Type:        "Interface",
+			Args:        []*graphqlArgumentDefinition{{Name: "name", Type: "String!"}},
+			Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+				if iface := ctx.data.Interface(args["name"].(string)); iface != nil {
+					return iface, nil
+				}
+				return nil, nil
+			},
+		},
+		{
+			Name:        "generated",
+			Description: "Time the response was generated (RFC 3339)",
+			Type:        "String!",
+			Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return ctx.now.Format(time.RFC3339), nil
+			},
+		},
+	}}
+
+	iface := &graphqlType{Name: "Interface", Kind: graphqlKindObject, Description: "A network interface monitored by vnstat, or an interface group", Fields: []*graphqlFieldDefinition{
+		{Name: "name", Type: "String!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return source.(*InterfaceData).Name
+		})},
+		{Name: "alias", Type: "String", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			if alias := source.(*InterfaceData).Alias; alias != "" {
+				return alias
+			}
+			return nil
+		})},
+		{Name: "displayName", Description: "\"alias (name)\" when an alias is set, otherwise the name", Type: "String!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return interfaceDisplayName(source.(*InterfaceData))
+		})},
+		{Name: "created", Description: "Time the interface was added to the database (RFC 3339)", Type: "String", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return graphqlTimestamp(source.(*InterfaceData).Created)
+		})},
+		{Name: "updated", Description: "Time of the last database update (RFC 3339)", Type: "String", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return graphqlTimestamp(source.(*InterfaceData).Updated)
+		})},
+		{
+			Name:        "labels",
+			Description: "Configured interface and external labels, sorted by name",
+			Type:        "[Label!]!",
+			Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+				extra := ctx.labels.seriesLabels(source.(*InterfaceData).Name)
+				names := make([]string, 0, len(extra))
+				for name := range extra {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				labels := make([]interface{}, 0, len(names))
+				for _, name := range names {
+					labels = append(labels, graphqlLabel{name: name, value: extra[name]})
+				}
+				return labels, nil
+			},
+			ListSize: func(args map[string]interface{}) int { return graphqlLabelListSize },
+		},
+		{
+			Name:        "total",
+			Description: "All-time traffic",
+			Type:        "Traffic!",
+			Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+				total := source.(*InterfaceData).Traffic.Total
+				return graphqlPeriod{rx: total.Rx, tx: total.Tx}, nil
+			},
+		},
+		{
+			Name:        "traffic",
+			Description: "Entries of a granularity in chronological order, from and to (YYYY-MM-DD or RFC 3339) are inclusive, limit keeps the most recent entries",
+			Type:        "[TrafficPeriod!]!",
+			Args: []*graphqlArgumentDefinition{
+				{Name: "granularity", Type: "Granularity!"},
+				{Name: "from", Type: "String"},
+				{Name: "to", Type: "String"},
+				{Name: "limit", Type: "Int"},
+			},
+			Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+				var dateRange exportRange
+				var err error
+				if from, ok := args["from"].(string); ok {
+					if dateRange.From, err = parseExportTime(from, false); err != nil {
+						return nil, fmt.Errorf("invalid from: %v", err)
+					}
+				}
+				if to, ok := args["to"].(string); ok {
+					if dateRange.To, err = parseExportTime(to, true); err != nil {
+						return nil, fmt.Errorf("invalid to: %v", err)
+					}
+				}
+				limit, err := graphqlLimit(args)
+				if err != nil {
+					return nil, err
+				}
+
+				granularity := strings.ToLower(args["granularity"].(string))
+				entries, _ := source.(*InterfaceData).Traffic.Entries(granularity)
+				var selected []TrafficEntry
+				for _, entry := range entries {
+					if dateRange.contains(entry.Start()) {
+						selected = append(selected, entry)
+					}
+				}
+				if limit > 0 && len(selected) > limit {
+					selected = selected[len(selected)-limit:]
+				}
+				return graphqlPeriods(selected, granularity), nil
+			},
+			ListSize: graphqlListSize(graphqlEntryListSize),
+		},
+		{
+			Name:        "top",
+			Description: "Top traffic days, highest first",
+			Type:        "[TrafficPeriod!]!",
+			Args:        []*graphqlArgumentDefinition{{Name: "limit", Type: "Int"}},
+			Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+				limit, err := graphqlLimit(args)
+				if err != nil {
+					return nil, err
+				}
+				top := source.(*InterfaceData).Traffic.Top
+				if limit > 0 && len(top) > limit {
+					top = top[:limit]
+				}
+				return graphqlPeriods(top, "day"), nil
+			},
+			ListSize: graphqlListSize(graphqlEntryListSize),
+		},
+		{
+			Name:        "forecast",
+			Description: "Billing cycle forecast, null without daily data",
+			Type:        "Forecast",
+			Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+				if forecast := forecastTraffic(source.(*InterfaceData).Traffic, ctx.forecast, ctx.now); forecast != nil {
+					return forecast, nil
+				}
+				return nil, nil
+			},
+		},
+	}}
+
+	label := &graphqlType{Name: "Label", Kind: graphqlKindObject, Fields: []*graphqlFieldDefinition{
+		{Name: "name", Type: "String!", Resolve: graphqlProperty(func(source interface{}) interface{} { return source.(graphqlLabel).name })},
+		{Name: "value", Type: "String!", Resolve: graphqlProperty(func(source interface{}) interface{} { return source.(graphqlLabel).value })},
+	}}
+
+	traffic := &graphqlType{Name: "Traffic", Kind: graphqlKindObject, Description: "Traffic volume", Fields: graphqlVolumeFields()}
+
+	period := &graphqlType{Name: "TrafficPeriod", Kind: graphqlKindObject, Description: "Traffic of one period [start, end)", Fields: append([]*graphqlFieldDefinition{
+		{Name: "start", Description: "Period start (RFC 3339)", Type: "String!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return source.(graphqlPeriod).start.Format(time.RFC3339)
+		})},
+		{Name: "end", Description: "Exclusive period end (RFC 3339)", Type: "String!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return source.(graphqlPeriod).end.Format(time.RFC3339)
+		})},
+		{Name: "complete", Description: "False for the period in progress", Type: "Boolean!", Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return !source.(graphqlPeriod).end.After(ctx.now), nil
+		}},
+	}, graphqlVolumeFields()...)}
+
+	forecast := &graphqlType{Name: "Forecast", Kind: graphqlKindObject, Description: "Projected traffic of the current billing cycle", Fields: []*graphqlFieldDefinition{
+		{Name: "cycleStart", Type: "String!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return source.(*trafficForecast).CycleStart.Format(time.RFC3339)
+		})},
+		{Name: "cycleEnd", Type: "String!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return source.(*trafficForecast).CycleEnd.Format(time.RFC3339)
+		})},
+		{Name: "daysElapsed", Type: "Float!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return roundTo(source.(*trafficForecast).DaysElapsed, 2)
+		})},
+		{Name: "daysRemaining", Type: "Float!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return roundTo(source.(*trafficForecast).DaysRemaining, 2)
+		})},
+		{Name: "historyDays", Description: "Complete days used as history", Type: "Int!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return source.(*trafficForecast).HistoryDays
+		})},
+		{Name: "rx", Type: "Projection!", Resolve: graphqlProperty(func(source interface{}) interface{} { return source.(*trafficForecast).Rx })},
+		{Name: "tx", Type: "Projection!", Resolve: graphqlProperty(func(source interface{}) interface{} { return source.(*trafficForecast).Tx })},
+		{Name: "total", Type: "Projection!", Resolve: graphqlProperty(func(source interface{}) interface{} { return source.(*trafficForecast).Total })},
+		{Name: "quota", Description: "Quota in bytes, null if not configured", Type: "Float", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			if f := source.(*trafficForecast); f.Quota > 0 {
+				return f.Quota
+			}
+			return nil
+		})},
+		{Name: "quotaUsedPercent", Description: "Share of the quota used so far, null if no quota is configured", Type: "Float", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			if f := source.(*trafficForecast); f.Quota > 0 {
+				return roundTo(f.QuotaUsed*100, 1)
+			}
+			return nil
+		})},
+		{Name: "daysUntilQuota", Description: "Days until the projected usage reaches the quota, null if it is not expected to", Type: "Float", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			if f := source.(*trafficForecast); f.Quota > 0 && f.DaysUntilQuota != nil {
+				return roundTo(*f.DaysUntilQuota, 1)
+			}
+			return nil
+		})},
+	}}
+
+	projectionValue := func(name, description string, get func(p projection) float64) *graphqlFieldDefinition {
+		return &graphqlFieldDefinition{Name: name, Description: description, Type: "Float!", Resolve: graphqlProperty(func(source interface{}) interface{} {
+			return get(source.(projection))
+		})}
+	}
+	estimate := &graphqlType{Name: "Projection", Kind: graphqlKindObject, Description: "Forecast of one direction in bytes", Fields: []*graphqlFieldDefinition{
+		projectionValue("used", "Traffic so far in the cycle", func(p projection) float64 { return p.Used }),
+		projectionValue("linear", "Run-rate of the cycle so far extended to the full cycle", func(p projection) float64 { return p.Linear }),
+		projectionValue("weekday", "Used plus day-of-week averages for the remaining days", func(p projection) float64 { return p.Weekday }),
+		projectionValue("estimate", "Mean of the linear and weekday estimates", func(p projection) float64 { return p.Estimate }),
+		projectionValue("low", "Lower bound of the 95% confidence range", func(p projection) float64 { return p.Low }),
+		projectionValue("high", "Upper bound of the 95% confidence range", func(p projection) float64 { return p.High }),
+		{Name: "estimateFormatted", Type: "String!", Args: graphqlUnitsArgument(), Resolve: func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return graphqlUnits(args).Volume(source.(projection).Estimate), nil
+		}},
+	}}
+
+	return newGraphQLSchema(
+		query,
+		iface,
+		label,
+		traffic,
+		period,
+		forecast,
+		estimate,
+		&graphqlType{Name: "Granularity", Kind: graphqlKindEnum, Values: []string{"FIVEMINUTE", "HOUR", "DAY", "MONTH", "YEAR"}},
+		&graphqlType{Name: "Units", Kind: graphqlKindEnum, Description: "Units of formatted volumes: IEC (KiB, MiB, ...), SI (kB, MB, ...) or plain BYTES", Values: []string{"IEC", "SI", "BYTES"}},
+		&graphqlType{Name: "Bytes", Kind: graphqlKindScalar, Description: "Byte count, a JSON number that can exceed the 32-bit Int range"},
+	)
+}
+
+// graphqlLimit returns the limit argument, 0 if it is not set
+func graphqlLimit(args map[string]interface{}) (int, error) {
+	limit, ok := args["limit"].(int)
+	if !ok {
+		return 0, nil
+	}
+	if limit < 1 {
+		return 0, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	return limit, nil
+}
+
+// containsValue reports whether list contains the string s
+func containsValue(list []interface{}, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// graphqlParams are the query, operation name and variables of a GraphQL request
+type graphqlParams struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// parseGraphQLParams reads the request parameters from the query string (GET) or the body (POST)
+// POST bodies are JSON, or the bare query with Content-Type application/graphql
+func parseGraphQLParams(w http.ResponseWriter, r *http.Request) (graphqlParams, error) {
+	var params graphqlParams
+	if r.Method == "GET" {
+		query := r.URL.Query()
+		params.Query = query.Get("query")
+		params.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			decoder := json.NewDecoder(strings.NewReader(variables))
+			decoder.UseNumber()
+			if err := decoder.Decode(&params.Variables); err != nil {
+				return params, fmt.Errorf("invalid variables: %v", err)
+			}
+		}
+		return params, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, graphqlMaxBodyBytes))
+	if err != nil {
+		return params, fmt.Errorf("failed to read request body: %v", err)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/graphql" {
+		params.Query = string(body)
+		return params, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&params); err != nil {
+		return params, fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return params, nil
+}
+
+// writeGraphQLErrors writes a response with only an errors list
+func writeGraphQLErrors(w http.ResponseWriter, status int, errs ...*graphqlError) {
+	writeAPIJSON(w, status, map[string]interface{}{"errors": errs})
+}
+
+// graphqlErrors writes middleware errors of /graphql as a GraphQL errors list
+func graphqlErrors(w http.ResponseWriter, status int, message string) {
+	writeGraphQLErrors(w, status, newGraphQLError(message))
+}
+
+// graphqlResponse is the result of an executed query; data is null if a non-null root field failed
+type graphqlResponse struct {
+	Data   interface{}     `json:"data"`
+	Errors []*graphqlError `json:"errors,omitempty"`
+}
+
+// handleGraphQL handles /graphql endpoint, runs a GraphQL query over the traffic data
+// GET takes query, operationName and variables (JSON) parameters, POST a JSON body with the same fields
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	params, err := parseGraphQLParams(w, r)
+	if err != nil {
+		writeGraphQLErrors(w, http.StatusBadRequest, newGraphQLError(err.Error()))
+		return
+	}
+	request, errs := s.graphql.prepare(params.Query, params.OperationName, params.Variables, s.graphqlLimits)
+	if len(errs) > 0 {
+		writeGraphQLErrors(w, http.StatusBadRequest, errs...)
+		return
+	}
+
+	jsonData, err := s.service.GetJSON()
+	if err != nil {
+		slog.Error("Failed to get JSON data for GraphQL", "err", err)
+		writeGraphQLErrors(w, http.StatusInternalServerError, newGraphQLError(err.Error()))
+		return
+	}
+	data, err := parseVnstatData(jsonData)
+	if err != nil {
+		slog.Error("Failed to parse JSON data", "err", err)
+		writeGraphQLErrors(w, http.StatusInternalServerError, newGraphQLError(err.Error()))
+		return
+	}
+
+	result, errs := request.execute(&graphqlContext{
+		data:     data,
+		labels:   s.service.labels,
+		forecast: *s.forecastConfig(),
+		now:      time.Now(),
+	})
+	writeAPIJSON(w, http.StatusOK, graphqlResponse{Data: result, Errors: errs})
+}
+
+// handleGraphQLSchema handles /graphql/schema.graphql endpoint, returns the schema in SDL
+func (s *Server) handleGraphQLSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(s.graphql.SDL()))
+}
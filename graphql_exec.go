@@ -0,0 +1,876 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// graphqlError is one entry of the errors list of a GraphQL response
+type graphqlError struct {
+	Message   string            `json:"message"`
+	Locations []graphqlLocation `json:"locations,omitempty"`
+	Path      []interface{}     `json:"path,omitempty"`
+}
+
+// newGraphQLError builds an error at the given locations
+func newGraphQLError(message string, locations ...graphqlLocation) *graphqlError {
+	return &graphqlError{Message: message, Locations: locations}
+}
+
+// graphqlResolver returns the value of a field of source
+type graphqlResolver func(ctx *graphqlContext, source interface{}, args map[string]interface{}) (interface{}, error)
+
+// graphqlSchema is the type system served by /graphql: object, scalar and enum types, with Query as root
+type graphqlSchema struct {
+	Types map[string]*graphqlType
+	Order []string // Type names in definition order, used to render the SDL
+}
+
+// Type kinds of graphqlType
+const (
+	graphqlKindObject = "OBJECT"
+	graphqlKindScalar = "SCALAR"
+	graphqlKindEnum   = "ENUM"
+)
+
+// graphqlType is a named type of the schema
+type graphqlType struct {
+	Name        string
+	Kind        string
+	Description string
+	Fields      []*graphqlFieldDefinition // Object types
+	Values      []string                  // Enum types
+}
+
+// Field returns the field definition with the given name, or nil
+func (t *graphqlType) Field(name string) *graphqlFieldDefinition {
+	for _, field := range t.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// graphqlFieldDefinition is a field of an object type
+type graphqlFieldDefinition struct {
+	Name        string
+	Description string
+	Type        string // Type reference in GraphQL syntax, e.g. [TrafficPeriod!]!
+	Args        []*graphqlArgumentDefinition
+	Resolve     graphqlResolver
+	// ListSize estimates the length of a list field from its arguments for the complexity limit
+	ListSize func(args map[string]interface{}) int
+
+	typeRef *graphqlTypeRef
+}
+
+// graphqlArgumentDefinition is an argument of a field
+type graphqlArgumentDefinition struct {
+	Name        string
+	Description string
+	Type        string
+	Default     string // Default value in GraphQL syntax, empty if there is none
+
+	typeRef      *graphqlTypeRef
+	defaultValue *graphqlValue
+}
+
+// newGraphQLSchema checks the type definitions and parses their type references and defaults
+func newGraphQLSchema(types ...*graphqlType) (*graphqlSchema, error) {
+	schema := &graphqlSchema{Types: make(map[string]*graphqlType)}
+	for _, name := range []string{"Int", "Float", "String", "Boolean"} {
+		schema.Types[name] = &graphqlType{Name: name, Kind: graphqlKindScalar}
+	}
+	for _, t := range types {
+		if _, exists := schema.Types[t.Name]; exists {
+			return nil, fmt.Errorf("type %s defined twice", t.Name)
+		}
+		schema.Types[t.Name] = t
+		schema.Order = append(schema.Order, t.Name)
+	}
+	if query := schema.Types["Query"]; query == nil || query.Kind != graphqlKindObject {
+		return nil, fmt.Errorf("schema has no Query object type")
+	}
+
+	for _, t := range types {
+		for _, field := range t.Fields {
+			ref, err := schema.parseTypeRef(field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", t.Name, field.Name, err)
+			}
+			field.typeRef = ref
+			if field.Resolve == nil {
+				return nil, fmt.Errorf("%s.%s has no resolver", t.Name, field.Name)
+			}
+			for _, arg := range field.Args {
+				if arg.typeRef, err = schema.parseTypeRef(arg.Type); err != nil {
+					return nil, fmt.Errorf("%s.%s(%s): %v", t.Name, field.Name, arg.Name, err)
+				}
+				if schema.Types[arg.typeRef.Named()].Kind == graphqlKindObject {
+					return nil, fmt.Errorf("%s.%s(%s): %s is not an input type", t.Name, field.Name, arg.Name, arg.Type)
+				}
+				if arg.Default != "" {
+					p := &graphqlParser{lexer: &graphqlLexer{source: arg.Default, line: 1}}
+					if err := p.advance(); err != nil {
+						return nil, err
+					}
+					if arg.defaultValue, err = p.parseValue(true); err != nil {
+						return nil, fmt.Errorf("%s.%s(%s) default: %v", t.Name, field.Name, arg.Name, err)
+					}
+					if _, gqlErr := schema.coerceLiteral(arg.defaultValue, arg.typeRef, nil); gqlErr != nil {
+						return nil, fmt.Errorf("%s.%s(%s) default: %s", t.Name, field.Name, arg.Name, gqlErr.Message)
+					}
+				}
+			}
+		}
+	}
+	return schema, nil
+}
+
+// parseTypeRef parses a type reference and checks that its named type exists
+func (s *graphqlSchema) parseTypeRef(source string) (*graphqlTypeRef, error) {
+	p := &graphqlParser{lexer: &graphqlLexer{source: source, line: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	ref, err := p.parseTypeRef()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.Kind != graphqlTokenEOF {
+		return nil, fmt.Errorf("invalid type reference %q", source)
+	}
+	if _, ok := s.Types[ref.Named()]; !ok {
+		return nil, fmt.Errorf("unknown type %s", ref.Named())
+	}
+	return ref, nil
+}
+
+// SDL renders the schema in the GraphQL schema definition language
+func (s *graphqlSchema) SDL() string {
+	var b strings.Builder
+	description := func(text, indent string) {
+		if text != "" {
+			fmt.Fprintf(&b, "%s%s\n", indent, strconv.Quote(text))
+		}
+	}
+	for i, name := range s.Order {
+		t := s.Types[name]
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		description(t.Description, "")
+		switch t.Kind {
+		case graphqlKindScalar:
+			fmt.Fprintf(&b, "scalar %s\n", t.Name)
+		case graphqlKindEnum:
+			fmt.Fprintf(&b, "enum %s {\n", t.Name)
+			for _, value := range t.Values {
+				fmt.Fprintf(&b, "  %s\n", value)
+			}
+			b.WriteString("}\n")
+		default:
+			fmt.Fprintf(&b, "type %s {\n", t.Name)
+			for _, field := range t.Fields {
+				description(field.Description, "  ")
+				fmt.Fprintf(&b, "  %s", field.Name)
+				if len(field.Args) > 0 {
+					args := make([]string, 0, len(field.Args))
+					for _, arg := range field.Args {
+						rendered := arg.Name + ": " + arg.Type
+						if arg.Default != "" {
+							rendered += " = " + arg.Default
+						}
+						args = append(args, rendered)
+					}
+					fmt.Fprintf(&b, "(%s)", strings.Join(args, ", "))
+				}
+				fmt.Fprintf(&b, ": %s\n", field.Type)
+			}
+			b.WriteString("}\n")
+		}
+	}
+	return b.String()
+}
+
+// graphqlLimits bounds the cost of a query
+type graphqlLimits struct {
+	MaxDepth      int // Deepest allowed field nesting, root fields are depth 1
+	MaxComplexity int // Allowed sum of field costs, list fields multiply the cost of their selections
+}
+
+// graphqlRequest is a parsed query with the selected operation and coerced variables
+type graphqlRequest struct {
+	schema    *graphqlSchema
+	document  *graphqlDocument
+	operation *graphqlOperation
+	variables map[string]interface{}
+	declared  map[string]bool // Variables defined by the operation
+}
+
+// prepare parses and validates a query, selects the operation and coerces the variables
+// All returned errors are request errors: nothing has been executed
+func (s *graphqlSchema) prepare(query, operationName string, variables map[string]interface{}, limits graphqlLimits) (*graphqlRequest, []*graphqlError) {
+	if strings.TrimSpace(query) == "" {
+		return nil, []*graphqlError{newGraphQLError("Must provide a query")}
+	}
+	document, err := parseGraphQL(query)
+	if err != nil {
+		if syntaxErr, ok := err.(*graphqlSyntaxError); ok {
+			return nil, []*graphqlError{newGraphQLError("Syntax error: "+syntaxErr.Message, syntaxErr.Location)}
+		}
+		return nil, []*graphqlError{newGraphQLError(err.Error())}
+	}
+
+	var operation *graphqlOperation
+	switch {
+	case operationName != "":
+		for _, candidate := range document.Operations {
+			if candidate.Name == operationName {
+				operation = candidate
+			}
+		}
+		if operation == nil {
+			return nil, []*graphqlError{newGraphQLError(fmt.Sprintf("Unknown operation named %q", operationName))}
+		}
+	case len(document.Operations) == 1:
+		operation = document.Operations[0]
+	default:
+		return nil, []*graphqlError{newGraphQLError("Must provide operation name if query contains multiple operations")}
+	}
+	if operation.Type != "query" {
+		return nil, []*graphqlError{newGraphQLError(fmt.Sprintf("Only query operations are supported, got %s", operation.Type), operation.Location)}
+	}
+
+	request := &graphqlRequest{schema: s, document: document, operation: operation, variables: make(map[string]interface{}), declared: make(map[string]bool)}
+	if errs := request.coerceVariables(variables); len(errs) > 0 {
+		return nil, errs
+	}
+
+	v := &graphqlValidator{request: request, fragmentPath: make(map[string]bool), fragmentCosts: make(map[string]graphqlCost)}
+	depth, complexity := v.selectionCost(operation.Selections, s.Types["Query"], 1)
+	if len(v.errors) > 0 {
+		return nil, v.errors
+	}
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return nil, []*graphqlError{newGraphQLError(fmt.Sprintf("Query depth %d exceeds the maximum depth %d", depth, limits.MaxDepth), operation.Location)}
+	}
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		return nil, []*graphqlError{newGraphQLError(fmt.Sprintf("Query complexity %d exceeds the maximum complexity %d", complexity, limits.MaxComplexity), operation.Location)}
+	}
+	return request, nil
+}
+
+// coerceVariables coerces the JSON variable values against the operation's variable definitions
+func (r *graphqlRequest) coerceVariables(values map[string]interface{}) []*graphqlError {
+	var errs []*graphqlError
+	for _, definition := range r.operation.Variables {
+		if r.declared[definition.Name] {
+			errs = append(errs, newGraphQLError(fmt.Sprintf("There can be only one variable named \"$%s\"", definition.Name), definition.Location))
+			continue
+		}
+		r.declared[definition.Name] = true
+
+		named, ok := r.schema.Types[definition.Type.Named()]
+		if !ok || named.Kind == graphqlKindObject {
+			errs = append(errs, newGraphQLError(fmt.Sprintf("Variable \"$%s\" cannot be of non-input type %s", definition.Name, definition.Type), definition.Location))
+			continue
+		}
+
+		value, provided := values[definition.Name]
+		switch {
+		case !provided && definition.Default != nil:
+			coerced, err := r.schema.coerceLiteral(definition.Default, definition.Type, nil)
+			if err != nil {
+				err.Message = fmt.Sprintf("Variable \"$%s\" has an invalid default value: %s", definition.Name, err.Message)
+				errs = append(errs, err)
+				continue
+			}
+			r.variables[definition.Name] = coerced
+		case !provided && definition.Type.NonNull:
+			errs = append(errs, newGraphQLError(fmt.Sprintf("Variable \"$%s\" of required type %s was not provided", definition.Name, definition.Type), definition.Location))
+		case provided:
+			coerced, err := r.schema.coerceJSON(value, definition.Type)
+			if err != nil {
+				errs = append(errs, newGraphQLError(fmt.Sprintf("Variable \"$%s\" got invalid value: %v", definition.Name, err), definition.Location))
+				continue
+			}
+			r.variables[definition.Name] = coerced
+		}
+	}
+	return errs
+}
+
+// coerceJSON coerces a decoded JSON variable value (numbers as json.Number) to an input type
+func (s *graphqlSchema) coerceJSON(value interface{}, t *graphqlTypeRef) (interface{}, error) {
+	if value == nil {
+		if t.NonNull {
+			return nil, fmt.Errorf("expected non-null value of type %s", t)
+		}
+		return nil, nil
+	}
+	if t.Elem != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value} // A single value is coerced to a list of one
+		}
+		list := make([]interface{}, 0, len(items))
+		for i, item := range items {
+			coerced, err := s.coerceJSON(item, t.Elem)
+			if err != nil {
+				return nil, fmt.Errorf("at index %d: %v", i, err)
+			}
+			list = append(list, coerced)
+		}
+		return list, nil
+	}
+
+	switch named := s.Types[t.Name]; {
+	case named.Kind == graphqlKindEnum:
+		if text, ok := value.(string); ok && containsString(named.Values, text) {
+			return text, nil
+		}
+	case t.Name == "String":
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+	case t.Name == "Boolean":
+		if flag, ok := value.(bool); ok {
+			return flag, nil
+		}
+	case t.Name == "Int":
+		if number, ok := value.(json.Number); ok {
+			if n, err := strconv.ParseInt(string(number), 10, 32); err == nil {
+				return int(n), nil
+			}
+		}
+	case t.Name == "Float":
+		if number, ok := value.(json.Number); ok {
+			if f, err := number.Float64(); err == nil {
+				return f, nil
+			}
+		}
+	}
+	encoded, _ := json.Marshal(value)
+	return nil, fmt.Errorf("%s is not a valid %s", encoded, t.Name)
+}
+
+// coerceLiteral coerces a literal from the query to an input type, resolving variables
+func (s *graphqlSchema) coerceLiteral(value *graphqlValue, t *graphqlTypeRef, variables map[string]interface{}) (interface{}, *graphqlError) {
+	invalid := func() (interface{}, *graphqlError) {
+		return nil, newGraphQLError(fmt.Sprintf("Expected value of type %s, found %s", t, formatGraphQLValue(value)), value.Location)
+	}
+
+	if value.Kind == graphqlValueVariable {
+		resolved, ok := variables[value.Raw]
+		if !ok {
+			if t.NonNull {
+				return nil, newGraphQLError(fmt.Sprintf("Variable \"$%s\" is not defined or has no value, expected %s", value.Raw, t), value.Location)
+			}
+			return nil, nil
+		}
+		if resolved == nil && t.NonNull {
+			return invalid()
+		}
+		return resolved, nil
+	}
+	if value.Kind == graphqlValueNull {
+		if t.NonNull {
+			return invalid()
+		}
+		return nil, nil
+	}
+	if t.Elem != nil {
+		items := value.List
+		if value.Kind != graphqlValueList {
+			items = []*graphqlValue{value}
+		}
+		list := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			coerced, err := s.coerceLiteral(item, t.Elem, variables)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, coerced)
+		}
+		return list, nil
+	}
+
+	switch named := s.Types[t.Name]; {
+	case named.Kind == graphqlKindEnum:
+		if value.Kind == graphqlValueEnum && containsString(named.Values, value.Raw) {
+			return value.Raw, nil
+		}
+	case t.Name == "String":
+		if value.Kind == graphqlValueString {
+			return value.Raw, nil
+		}
+	case t.Name == "Boolean":
+		if value.Kind == graphqlValueBoolean {
+			return value.Raw == "true", nil
+		}
+	case t.Name == "Int":
+		if value.Kind == graphqlValueInt {
+			if n, err := strconv.ParseInt(value.Raw, 10, 32); err == nil {
+				return int(n), nil
+			}
+		}
+	case t.Name == "Float":
+		if value.Kind == graphqlValueInt || value.Kind == graphqlValueFloat {
+			if f, err := strconv.ParseFloat(value.Raw, 64); err == nil {
+				return f, nil
+			}
+		}
+	}
+	return invalid()
+}
+
+// formatGraphQLValue renders a literal for error messages
+func formatGraphQLValue(value *graphqlValue) string {
+	switch value.Kind {
+	case graphqlValueVariable:
+		return "$" + value.Raw
+	case graphqlValueString:
+		return strconv.Quote(value.Raw)
+	case graphqlValueList:
+		items := make([]string, 0, len(value.List))
+		for _, item := range value.List {
+			items = append(items, formatGraphQLValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case graphqlValueObject:
+		fields := make([]string, 0, len(value.Fields))
+		for _, field := range value.Fields {
+			fields = append(fields, field.Name+": "+formatGraphQLValue(field.Value))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	default:
+		return value.Raw
+	}
+}
+
+// undeclaredVariable returns the first variable referenced by value that the operation does not define
+func (r *graphqlRequest) undeclaredVariable(value *graphqlValue) *graphqlValue {
+	switch value.Kind {
+	case graphqlValueVariable:
+		if !r.declared[value.Raw] {
+			return value
+		}
+	case graphqlValueList:
+		for _, item := range value.List {
+			if undeclared := r.undeclaredVariable(item); undeclared != nil {
+				return undeclared
+			}
+		}
+	case graphqlValueObject:
+		for _, field := range value.Fields {
+			if undeclared := r.undeclaredVariable(field.Value); undeclared != nil {
+				return undeclared
+			}
+		}
+	}
+	return nil
+}
+
+// coerceArguments coerces the arguments of a field, applying defaults and checking required arguments
+func (r *graphqlRequest) coerceArguments(definition *graphqlFieldDefinition, field *graphqlField) (map[string]interface{}, *graphqlError) {
+	args := make(map[string]interface{})
+	for _, argument := range field.Arguments {
+		if undeclared := r.undeclaredVariable(argument.Value); undeclared != nil {
+			return nil, newGraphQLError(fmt.Sprintf("Variable \"$%s\" is not defined", undeclared.Raw), undeclared.Location)
+		}
+		known := false
+		for _, arg := range definition.Args {
+			known = known || arg.Name == argument.Name
+		}
+		if !known {
+			return nil, newGraphQLError(fmt.Sprintf("Unknown argument %q on field %q", argument.Name, field.Name), argument.Location)
+		}
+	}
+
+	for _, arg := range definition.Args {
+		var literal *graphqlArgument
+		for _, argument := range field.Arguments {
+			if argument.Name == arg.Name {
+				literal = argument
+			}
+		}
+
+		provided := literal != nil
+		if provided && literal.Value.Kind == graphqlValueVariable {
+			_, provided = r.variables[literal.Value.Raw]
+		}
+		switch {
+		case provided:
+			value, err := r.schema.coerceLiteral(literal.Value, arg.typeRef, r.variables)
+			if err != nil {
+				err.Message = fmt.Sprintf("Argument %q of field %q: %s", arg.Name, field.Name, err.Message)
+				return nil, err
+			}
+			args[arg.Name] = value
+		case arg.defaultValue != nil:
+			args[arg.Name], _ = r.schema.coerceLiteral(arg.defaultValue, arg.typeRef, nil)
+		case arg.typeRef.NonNull:
+			return nil, newGraphQLError(fmt.Sprintf("Field %q argument %q of type %s is required but not provided", field.Name, arg.Name, arg.Type), field.Location)
+		}
+	}
+	return args, nil
+}
+
+// graphqlValidator checks a selection set against the schema and computes its depth and complexity
+type graphqlValidator struct {
+	request       *graphqlRequest
+	fragmentPath  map[string]bool // Fragments being expanded, to detect cycles
+	fragmentCosts map[string]graphqlCost
+	errors        []*graphqlError
+}
+
+// graphqlCost is the depth and complexity of a fragment's selections, computed once per fragment
+// so that fragments spreading each other repeatedly are not re-walked exponentially often
+type graphqlCost struct {
+	Depth      int // Depth of the deepest field when the fragment is spread at depth 1
+	Complexity int
+}
+
+// selectionCost validates the selections on parent and returns their maximum depth and total complexity
+func (v *graphqlValidator) selectionCost(selections []graphqlSelection, parent *graphqlType, depth int) (int, int) {
+	maxDepth, complexity := 0, 0
+	add := func(d, c int) {
+		if d > maxDepth {
+			maxDepth = d
+		}
+		complexity = saturatingAdd(complexity, c)
+	}
+
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *graphqlField:
+			add(v.fieldCost(selection, parent, depth))
+		case *graphqlInlineFragment:
+			v.checkDirectives(selection.Directives)
+			if selection.TypeCondition != "" && !v.checkTypeCondition(selection.TypeCondition, parent, selection.Location) {
+				continue
+			}
+			add(v.selectionCost(selection.Selections, parent, depth))
+		case *graphqlFragmentSpread:
+			v.checkDirectives(selection.Directives)
+			fragment, ok := v.request.document.Fragments[selection.Name]
+			if !ok {
+				v.errors = append(v.errors, newGraphQLError(fmt.Sprintf("Unknown fragment %q", selection.Name), selection.Location))
+				continue
+			}
+			if v.fragmentPath[fragment.Name] {
+				v.errors = append(v.errors, newGraphQLError(fmt.Sprintf("Cannot spread fragment %q within itself", fragment.Name), selection.Location))
+				continue
+			}
+			if !v.checkTypeCondition(fragment.TypeCondition, parent, selection.Location) {
+				continue
+			}
+			cost, ok := v.fragmentCosts[fragment.Name]
+			if !ok {
+				v.fragmentPath[fragment.Name] = true
+				cost.Depth, cost.Complexity = v.selectionCost(fragment.Selections, parent, 1)
+				delete(v.fragmentPath, fragment.Name)
+				v.fragmentCosts[fragment.Name] = cost
+			}
+			add(depth-1+cost.Depth, cost.Complexity)
+		}
+	}
+	return maxDepth, complexity
+}
+
+// fieldCost validates one field and returns its depth and complexity
+func (v *graphqlValidator) fieldCost(field *graphqlField, parent *graphqlType, depth int) (int, int) {
+	v.checkDirectives(field.Directives)
+	if field.Name == "__typename" {
+		if len(field.Selections) > 0 {
+			v.errors = append(v.errors, newGraphQLError("Field \"__typename\" must not have a selection since type String! has no subfields", field.Location))
+		}
+		return depth, 1
+	}
+
+	definition := parent.Field(field.Name)
+	if definition == nil {
+		v.errors = append(v.errors, newGraphQLError(fmt.Sprintf("Cannot query field %q on type %q", field.Name, parent.Name), field.Location))
+		return depth, 1
+	}
+	args, err := v.request.coerceArguments(definition, field)
+	if err != nil {
+		v.errors = append(v.errors, err)
+		return depth, 1
+	}
+
+	named := v.request.schema.Types[definition.typeRef.Named()]
+	if named.Kind != graphqlKindObject {
+		if len(field.Selections) > 0 {
+			v.errors = append(v.errors, newGraphQLError(fmt.Sprintf("Field %q must not have a selection since type %s has no subfields", field.Name, definition.Type), field.Location))
+		}
+		return depth, 1
+	}
+	if len(field.Selections) == 0 {
+		v.errors = append(v.errors, newGraphQLError(fmt.Sprintf("Field %q of type %s must have a selection of subfields", field.Name, definition.Type), field.Location))
+		return depth, 1
+	}
+
+	childDepth, childComplexity := v.selectionCost(field.Selections, named, depth+1)
+	size := 1
+	if definition.ListSize != nil {
+		size = definition.ListSize(args)
+	}
+	return childDepth, saturatingAdd(1, saturatingMul(size, childComplexity))
+}
+
+// checkTypeCondition reports whether a fragment on typeName applies to parent, recording an error if it never can
+func (v *graphqlValidator) checkTypeCondition(typeName string, parent *graphqlType, location graphqlLocation) bool {
+	t, ok := v.request.schema.Types[typeName]
+	switch {
+	case !ok:
+		v.errors = append(v.errors, newGraphQLError(fmt.Sprintf("Unknown type %q", typeName), location))
+	case t.Kind != graphqlKindObject:
+		v.errors = append(v.errors, newGraphQLError(fmt.Sprintf("Fragment cannot condition on non composite type %q", typeName), location))
+	case t != parent:
+		v.errors = append(v.errors, newGraphQLError(fmt.Sprintf("Fragment cannot be spread here as objects of type %q can never be of type %q", parent.Name, typeName), location))
+	default:
+		return true
+	}
+	return false
+}
+
+// checkDirectives validates @include and @skip, the only supported directives
+func (v *graphqlValidator) checkDirectives(directives []*graphqlDirective) {
+	for _, directive := range directives {
+		if _, err := v.request.directiveCondition(directive); err != nil {
+			v.errors = append(v.errors, err)
+		}
+	}
+}
+
+// directiveCondition evaluates the if argument of @include or @skip
+func (r *graphqlRequest) directiveCondition(directive *graphqlDirective) (bool, *graphqlError) {
+	if directive.Name != "include" && directive.Name != "skip" {
+		return false, newGraphQLError(fmt.Sprintf("Unknown directive \"@%s\"", directive.Name), directive.Location)
+	}
+	if len(directive.Arguments) != 1 || directive.Arguments[0].Name != "if" {
+		return false, newGraphQLError(fmt.Sprintf("Directive \"@%s\" requires exactly one argument \"if\" of type Boolean!", directive.Name), directive.Location)
+	}
+	if undeclared := r.undeclaredVariable(directive.Arguments[0].Value); undeclared != nil {
+		return false, newGraphQLError(fmt.Sprintf("Variable \"$%s\" is not defined", undeclared.Raw), undeclared.Location)
+	}
+	value, err := r.schema.coerceLiteral(directive.Arguments[0].Value, &graphqlTypeRef{Name: "Boolean", NonNull: true}, r.variables)
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
+
+// included reports whether @skip and @include let a selection through
+func (r *graphqlRequest) included(directives []*graphqlDirective) bool {
+	for _, directive := range directives {
+		condition, _ := r.directiveCondition(directive) // Validated before execution
+		if (directive.Name == "skip") == condition {
+			return false
+		}
+	}
+	return true
+}
+
+// saturatingAdd adds non-negative costs without overflowing
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// saturatingMul multiplies non-negative costs without overflowing
+func saturatingMul(a, b int) int {
+	if a != 0 && b > math.MaxInt/a {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// graphqlObject is a result object that keeps the order of the selected fields when encoded
+type graphqlObject []graphqlObjectField
+
+// graphqlObjectField is one key of a result object
+type graphqlObjectField struct {
+	Key   string
+	Value interface{}
+}
+
+// MarshalJSON encodes the fields in selection order
+func (o graphqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		b.Write(key)
+		b.WriteByte(':')
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// graphqlExecutor executes a validated request, collecting field errors
+type graphqlExecutor struct {
+	request *graphqlRequest
+	ctx     *graphqlContext
+	errors  []*graphqlError
+}
+
+// execute runs the operation and returns the data (nil if a non-null root field failed) and field errors
+func (r *graphqlRequest) execute(ctx *graphqlContext) (interface{}, []*graphqlError) {
+	e := &graphqlExecutor{request: r, ctx: ctx}
+	data, ok := e.executeSelections(r.operation.Selections, r.schema.Types["Query"], nil, nil)
+	if !ok {
+		return nil, e.errors
+	}
+	return data, e.errors
+}
+
+// graphqlFieldGroup is the fields selected under one response key, merged in selection order
+type graphqlFieldGroup struct {
+	key    string
+	fields []*graphqlField
+}
+
+// collectFields flattens fragments and applies @skip/@include, grouping fields by response key
+func (e *graphqlExecutor) collectFields(selections []graphqlSelection, groups []*graphqlFieldGroup, visited map[string]bool) []*graphqlFieldGroup {
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *graphqlField:
+			if !e.request.included(selection.Directives) {
+				continue
+			}
+			key := selection.ResponseKey()
+			var group *graphqlFieldGroup
+			for _, existing := range groups {
+				if existing.key == key {
+					group = existing
+				}
+			}
+			if group == nil {
+				group = &graphqlFieldGroup{key: key}
+				groups = append(groups, group)
+			}
+			group.fields = append(group.fields, selection)
+		case *graphqlInlineFragment:
+			if e.request.included(selection.Directives) {
+				groups = e.collectFields(selection.Selections, groups, visited)
+			}
+		case *graphqlFragmentSpread:
+			if visited[selection.Name] || !e.request.included(selection.Directives) {
+				continue
+			}
+			visited[selection.Name] = true
+			groups = e.collectFields(e.request.document.Fragments[selection.Name].Selections, groups, visited)
+		}
+	}
+	return groups
+}
+
+// executeSelections resolves the selections on source; ok is false if the object must become null
+func (e *graphqlExecutor) executeSelections(selections []graphqlSelection, parent *graphqlType, source interface{}, path []interface{}) (graphqlObject, bool) {
+	groups := e.collectFields(selections, nil, make(map[string]bool))
+	result := make(graphqlObject, 0, len(groups))
+	for _, group := range groups {
+		value, ok := e.executeField(group, parent, source, appendPath(path, group.key))
+		if !ok {
+			return nil, false
+		}
+		result = append(result, graphqlObjectField{Key: group.key, Value: value})
+	}
+	return result, true
+}
+
+// executeField resolves one response key; ok is false if a null must propagate to the parent
+func (e *graphqlExecutor) executeField(group *graphqlFieldGroup, parent *graphqlType, source interface{}, path []interface{}) (interface{}, bool) {
+	field := group.fields[0]
+	if field.Name == "__typename" {
+		return parent.Name, true
+	}
+	definition := parent.Field(field.Name)
+	for _, other := range group.fields[1:] {
+		if other.Name != field.Name {
+			e.errors = append(e.errors, &graphqlError{Message: fmt.Sprintf("Fields %q conflict because %s and %s are different fields", group.key, field.Name, other.Name), Locations: []graphqlLocation{field.Location, other.Location}, Path: path})
+			return nil, !definition.typeRef.NonNull
+		}
+	}
+
+	args, gqlErr := e.request.coerceArguments(definition, field)
+	if gqlErr != nil {
+		gqlErr.Path = path
+		e.errors = append(e.errors, gqlErr)
+		return nil, !definition.typeRef.NonNull
+	}
+	value, err := definition.Resolve(e.ctx, source, args)
+	if err != nil {
+		e.errors = append(e.errors, &graphqlError{Message: err.Error(), Locations: []graphqlLocation{field.Location}, Path: path})
+		return nil, !definition.typeRef.NonNull
+	}
+
+	var selections []graphqlSelection
+	for _, f := range group.fields {
+		selections = append(selections, f.Selections...)
+	}
+	return e.completeValue(definition.typeRef, selections, value, field, path)
+}
+
+// completeValue shapes a resolved value according to its type; ok is false if a null must propagate
+func (e *graphqlExecutor) completeValue(t *graphqlTypeRef, selections []graphqlSelection, value interface{}, field *graphqlField, path []interface{}) (interface{}, bool) {
+	if value == nil {
+		if t.NonNull {
+			e.errors = append(e.errors, &graphqlError{Message: fmt.Sprintf("Cannot return null for non-nullable field %q", field.Name), Locations: []graphqlLocation{field.Location}, Path: path})
+			return nil, false
+		}
+		return nil, true
+	}
+
+	var completed interface{}
+	ok := true
+	switch {
+	case t.Elem != nil:
+		items := value.([]interface{})
+		list := make([]interface{}, 0, len(items))
+		for i, item := range items {
+			var itemValue interface{}
+			if itemValue, ok = e.completeValue(t.Elem, selections, item, field, appendPath(path, i)); !ok {
+				break
+			}
+			list = append(list, itemValue)
+		}
+		if ok {
+			completed = list
+		}
+	case e.request.schema.Types[t.Name].Kind == graphqlKindObject:
+		completed, ok = e.executeSelections(selections, e.request.schema.Types[t.Name], value, path)
+	default:
+		completed = value
+	}
+
+	if !ok {
+		return nil, !t.NonNull
+	}
+	return completed, true
+}
+
+// appendPath returns path extended by key without sharing the backing array
+func appendPath(path []interface{}, key interface{}) []interface{} {
+	extended := make([]interface{}, len(path), len(path)+1)
+	copy(extended, path)
+	return append(extended, key)
+}
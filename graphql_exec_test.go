@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGraphQLLimits are the default -graphql-max-depth and -graphql-max-complexity
+var testGraphQLLimits = graphqlLimits{MaxDepth: 8, MaxComplexity: 10000}
+
+func newTestGraphQLSchema(t *testing.T) *graphqlSchema {
+	t.Helper()
+	schema, err := newTrafficGraphQLSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// prepareError prepares a query that must be rejected and returns the joined error messages
+func prepareError(t *testing.T, schema *graphqlSchema, query string, variables map[string]interface{}, limits graphqlLimits) string {
+	t.Helper()
+	if _, errs := schema.prepare(query, "", variables, limits); len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, err := range errs {
+			messages[i] = err.Message
+		}
+		return strings.Join(messages, "; ")
+	}
+	t.Fatalf("query accepted: %s", query)
+	return ""
+}
+
+func TestGraphQLValidation(t *testing.T) {
+	schema := newTestGraphQLSchema(t)
+	tests := []struct {
+		name    string
+		query   string
+		message string
+	}{
+		{"unknown field", "{ nothing }", `Cannot query field "nothing" on type "Query"`},
+		{"leaf with selection", "{ generated { x } }", "must not have a selection"},
+		{"object without selection", "{ interfaces }", "must have a selection of subfields"},
+		{"unknown argument", "{ interfaces(size: 1) { name } }", `Unknown argument "size"`},
+		{"missing argument", "{ interface { name } }", `argument "name" of type String! is required`},
+		{"wrong argument type", `{ interface(name: 1) { name } }`, `Argument "name" of field "interface"`},
+		{"invalid enum", "{ interfaces { traffic(granularity: WEEK) { start } } }", `Argument "granularity"`},
+		{"undeclared variable", "{ interface(name: $name) { name } }", `Variable "$name" is not defined`},
+		{"unknown fragment", "{ ...Missing }", `Unknown fragment "Missing"`},
+		{"fragment cycle", "{ ...A } fragment A on Query { ...B } fragment B on Query { ...A }", "within itself"},
+		{"wrong type condition", "{ ...I } fragment I on Interface { name }", "can never be of type"},
+		{"unknown type condition", "{ ... on Nothing { generated } }", `Unknown type "Nothing"`},
+		{"invalid directive", "{ generated @include }", "if"},
+		{"mutation", "mutation { generated }", "Only query operations are supported"},
+		{"multiple operations", "query A { generated } query B { generated }", "Must provide operation name"},
+		{"empty query", " ", "Must provide a query"},
+		{"syntax error", "{ generated", "Syntax error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if message := prepareError(t, schema, tt.query, nil, testGraphQLLimits); !strings.Contains(message, tt.message) {
+				t.Errorf("errors = %q, want one containing %q", message, tt.message)
+			}
+		})
+	}
+}
+
+func TestGraphQLVariables(t *testing.T) {
+	schema := newTestGraphQLSchema(t)
+	query := "query ($name: String!, $limit: Int = 2) { interface(name: $name) { traffic(granularity: DAY, limit: $limit) { start } } }"
+
+	if _, errs := schema.prepare(query, "", map[string]interface{}{"name": "eth0"}, testGraphQLLimits); len(errs) > 0 {
+		t.Fatalf("valid variables rejected: %v", errs[0].Message)
+	}
+	if message := prepareError(t, schema, query, nil, testGraphQLLimits); !strings.Contains(message, "$name") {
+		t.Errorf("missing required variable: errors = %q", message)
+	}
+	if message := prepareError(t, schema, query, map[string]interface{}{"name": json.Number("1")}, testGraphQLLimits); !strings.Contains(message, "$name") {
+		t.Errorf("variable of the wrong type: errors = %q", message)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	schema := newTestGraphQLSchema(t)
+	tests := []struct {
+		name       string
+		query      string
+		depth      int
+		complexity int
+	}{
+		{"root fields", "{ generated now: generated }", 1, 2},
+		{"list", "{ interfaces { name } }", 2, 1 + graphqlInterfaceListSize},
+		{"filtered list", `{ interfaces(names: ["eth0", "wg0"]) { name alias } }`, 2, 1 + 2*2},
+		{"limit multiplies", "{ interface(name: \"eth0\") { traffic(granularity: DAY, limit: 5) { rx tx } } }", 3, 1 + 1 + 5*2},
+		{"fragment", "{ interfaces { ...T } } fragment T on Interface { total { rx } }", 3, 1 + graphqlInterfaceListSize*2},
+		{"fragment spread twice", "{ ...G ...G } fragment G on Query { generated }", 1, 2},
+		{"inline fragment", "{ interfaces { ... on Interface { total { rx } } } }", 3, 1 + graphqlInterfaceListSize*2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exact := graphqlLimits{MaxDepth: tt.depth, MaxComplexity: tt.complexity}
+			if _, errs := schema.prepare(tt.query, "", nil, exact); len(errs) > 0 {
+				t.Fatalf("rejected at its own depth and complexity: %s", errs[0].Message)
+			}
+			shallower := graphqlLimits{MaxDepth: tt.depth - 1, MaxComplexity: tt.complexity}
+			if tt.depth > 1 && !strings.Contains(prepareError(t, schema, tt.query, nil, shallower), fmt.Sprintf("depth %d exceeds", tt.depth)) {
+				t.Errorf("not rejected at depth %d", tt.depth-1)
+			}
+			cheaper := graphqlLimits{MaxDepth: tt.depth, MaxComplexity: tt.complexity - 1}
+			if tt.complexity > 1 && !strings.Contains(prepareError(t, schema, tt.query, nil, cheaper), fmt.Sprintf("complexity %d exceeds", tt.complexity)) {
+				t.Errorf("not rejected at complexity %d", tt.complexity-1)
+			}
+		})
+	}
+}
+
+func TestGraphQLFragmentExpansion(t *testing.T) {
+	schema := newTestGraphQLSchema(t)
+
+	// Each fragment spreads the next twice: walking every spread would take 2^64 steps
+	var query strings.Builder
+	query.WriteString("{ ...F0 }\n")
+	const fragments = 64
+	for i := 0; i < fragments; i++ {
+		fmt.Fprintf(&query, "fragment F%d on Query { ...F%d ...F%d }\n", i, i+1, i+1)
+	}
+	fmt.Fprintf(&query, "fragment F%d on Query { generated }\n", fragments)
+
+	done := make(chan []*graphqlError)
+	go func() {
+		_, errs := schema.prepare(query.String(), "", nil, testGraphQLLimits)
+		done <- errs
+	}()
+	select {
+	case errs := <-done:
+		if len(errs) != 1 || !strings.Contains(errs[0].Message, "complexity") {
+			t.Errorf("errors = %+v, want the complexity limit", errs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("validation of nested fragments did not finish")
+	}
+
+	// An error inside a fragment is reported once, however often the fragment is spread
+	message := prepareError(t, schema, "{ ...A ...A ...A } fragment A on Query { nothing }", nil, testGraphQLLimits)
+	if strings.Count(message, "nothing") != 1 {
+		t.Errorf("errors = %q, want one", message)
+	}
+}
+
+func TestGraphQLExecute(t *testing.T) {
+	schema := newTestGraphQLSchema(t)
+	data, err := parseVnstatData([]byte(testVnstatJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := `query ($skip: Boolean!) {
+		interfaces { ...Names }
+		missing: interface(name: "none") { name }
+		eth0: interface(name: "eth0") {
+			total { rx tx total totalFormatted(units: SI) }
+			days: traffic(granularity: DAY, limit: 1) { rx complete }
+			alias @skip(if: $skip)
+			__typename
+		}
+	}
+	fragment Names on Interface { name displayName name }`
+	request, errs := schema.prepare(query, "", map[string]interface{}{"skip": true}, testGraphQLLimits)
+	if len(errs) > 0 {
+		t.Fatal(errs[0].Message)
+	}
+	result, errs := request.execute(&graphqlContext{data: data, now: time.Unix(1792420800, 0)})
+	if len(errs) > 0 {
+		t.Fatal(errs[0].Message)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"interfaces":[{"name":"eth0","displayName":"eth0"}],"missing":null,` +
+		`"eth0":{"total":{"rx":8000000000,"tx":2000000000,"total":10000000000,"totalFormatted":"10.0 GB"},` +
+		`"days":[{"rx":2000000,"complete":false}],"__typename":"Interface"}}`
+	if string(encoded) != want {
+		t.Errorf("result =\n%s\nwant\n%s", encoded, want)
+	}
+}
+
+func TestGraphQLExecuteFieldError(t *testing.T) {
+	schema := newTestGraphQLSchema(t)
+	data, err := parseVnstatData([]byte(testVnstatJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, errs := schema.prepare(`{ generated eth0: interface(name: "eth0") { traffic(granularity: DAY, from: "soon") { rx } } }`, "", nil, testGraphQLLimits)
+	if len(errs) > 0 {
+		t.Fatal(errs[0].Message)
+	}
+	result, errs := request.execute(&graphqlContext{data: data, now: time.Unix(1792420800, 0)})
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "invalid from") {
+		t.Fatalf("errors = %+v, want the invalid from argument", errs)
+	}
+	if path := fmt.Sprint(errs[0].Path); path != "[eth0 traffic]" {
+		t.Errorf("error path = %s, want [eth0 traffic]", path)
+	}
+
+	// The non-null traffic list fails, so the nullable interface becomes null; other fields are kept
+	encoded, _ := json.Marshal(result)
+	if want := `{"generated":"` + time.Unix(1792420800, 0).Format(time.RFC3339) + `","eth0":null}`; string(encoded) != want {
+		t.Errorf("result = %s, want %s", encoded, want)
+	}
+}
@@ -0,0 +1,905 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// graphqlMaxNesting bounds nested selection sets, lists and objects while parsing,
+// so a pathological document cannot recurse without limit before the depth check runs
+const graphqlMaxNesting = 64
+
+// graphqlLocation is a 1-based line and column in the query document
+type graphqlLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// graphqlSyntaxError is a parse error at a location of the document
+type graphqlSyntaxError struct {
+	Message  string
+	Location graphqlLocation
+}
+
+func (e *graphqlSyntaxError) Error() string {
+	return fmt.Sprintf("Syntax error at %d:%d: %s", e.Location.Line, e.Location.Column, e.Message)
+}
+
+// Token kinds of the GraphQL lexer
+const (
+	graphqlTokenEOF = iota
+	graphqlTokenPunctuator
+	graphqlTokenName
+	graphqlTokenInt
+	graphqlTokenFloat
+	graphqlTokenString
+)
+
+// graphqlToken is one lexical token
+type graphqlToken struct {
+	Kind     int
+	Value    string // Punctuator, name, number literal or decoded string value
+	Location graphqlLocation
+}
+
+// graphqlLexer splits a GraphQL document into tokens, skipping whitespace, commas and comments
+type graphqlLexer struct {
+	source    string
+	pos       int
+	line      int
+	lineStart int
+}
+
+// location returns the location of the byte offset pos
+func (l *graphqlLexer) location(pos int) graphqlLocation {
+	return graphqlLocation{Line: l.line, Column: utf8.RuneCountInString(l.source[l.lineStart:pos]) + 1}
+}
+
+// errorf returns a syntax error at the byte offset pos
+func (l *graphqlLexer) errorf(pos int, format string, args ...interface{}) error {
+	return &graphqlSyntaxError{Message: fmt.Sprintf(format, args...), Location: l.location(pos)}
+}
+
+// newline records a line break ending at the byte offset pos
+func (l *graphqlLexer) newline(pos int) {
+	l.line++
+	l.lineStart = pos
+}
+
+// skipIgnored skips whitespace, line terminators, commas, comments and a byte order mark
+func (l *graphqlLexer) skipIgnored() {
+	for l.pos < len(l.source) {
+		switch c := l.source[l.pos]; {
+		case c == ' ' || c == '\t' || c == ',':
+			l.pos++
+		case c == '\n':
+			l.pos++
+			l.newline(l.pos)
+		case c == '\r':
+			l.pos++
+			if l.pos < len(l.source) && l.source[l.pos] == '\n' {
+				l.pos++
+			}
+			l.newline(l.pos)
+		case c == '#':
+			for l.pos < len(l.source) && l.source[l.pos] != '\n' && l.source[l.pos] != '\r' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.source[l.pos:], "\uFEFF"):
+			l.pos += len("\uFEFF")
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token
+func (l *graphqlLexer) next() (graphqlToken, error) {
+	l.skipIgnored()
+	start := l.pos
+	location := l.location(start)
+	if start >= len(l.source) {
+		return graphqlToken{Kind: graphqlTokenEOF, Location: location}, nil
+	}
+
+	c := l.source[start]
+	switch {
+	case strings.IndexByte("!$&()=:@[]{}|", c) >= 0:
+		l.pos++
+		return graphqlToken{Kind: graphqlTokenPunctuator, Value: string(c), Location: location}, nil
+	case c == '.':
+		if !strings.HasPrefix(l.source[start:], "...") {
+			return graphqlToken{}, l.errorf(start, "unexpected \".\", did you mean \"...\"?")
+		}
+		l.pos += 3
+		return graphqlToken{Kind: graphqlTokenPunctuator, Value: "...", Location: location}, nil
+	case c == '_' || isGraphQLLetter(c):
+		for l.pos < len(l.source) && (l.source[l.pos] == '_' || isGraphQLLetter(l.source[l.pos]) || isGraphQLDigit(l.source[l.pos])) {
+			l.pos++
+		}
+		return graphqlToken{Kind: graphqlTokenName, Value: l.source[start:l.pos], Location: location}, nil
+	case c == '-' || isGraphQLDigit(c):
+		return l.readNumber(location)
+	case c == '"':
+		if strings.HasPrefix(l.source[start:], `"""`) {
+			return l.readBlockString(location)
+		}
+		return l.readString(location)
+	}
+
+	r, _ := utf8.DecodeRuneInString(l.source[start:])
+	return graphqlToken{}, l.errorf(start, "unexpected character %q", r)
+}
+
+// readNumber reads an Int or Float literal
+func (l *graphqlLexer) readNumber(location graphqlLocation) (graphqlToken, error) {
+	start := l.pos
+	digits := func() int {
+		begin := l.pos
+		for l.pos < len(l.source) && isGraphQLDigit(l.source[l.pos]) {
+			l.pos++
+		}
+		return l.pos - begin
+	}
+
+	if l.source[l.pos] == '-' {
+		l.pos++
+	}
+	intStart := l.pos
+	if digits() == 0 {
+		return graphqlToken{}, l.errorf(l.pos, "invalid number, expected digit")
+	}
+	if l.pos-intStart > 1 && l.source[intStart] == '0' {
+		return graphqlToken{}, l.errorf(intStart, "invalid number, unexpected digit after 0")
+	}
+
+	kind := graphqlTokenInt
+	if l.pos < len(l.source) && l.source[l.pos] == '.' {
+		kind = graphqlTokenFloat
+		l.pos++
+		if digits() == 0 {
+			return graphqlToken{}, l.errorf(l.pos, "invalid number, expected digit after \".\"")
+		}
+	}
+	if l.pos < len(l.source) && (l.source[l.pos] == 'e' || l.source[l.pos] == 'E') {
+		kind = graphqlTokenFloat
+		l.pos++
+		if l.pos < len(l.source) && (l.source[l.pos] == '+' || l.source[l.pos] == '-') {
+			l.pos++
+		}
+		if digits() == 0 {
+			return graphqlToken{}, l.errorf(l.pos, "invalid number, expected digit in exponent")
+		}
+	}
+	if l.pos < len(l.source) && (l.source[l.pos] == '.' || l.source[l.pos] == '_' || isGraphQLLetter(l.source[l.pos])) {
+		return graphqlToken{}, l.errorf(l.pos, "invalid number, unexpected %q", l.source[l.pos])
+	}
+	return graphqlToken{Kind: kind, Value: l.source[start:l.pos], Location: location}, nil
+}
+
+// readString reads a quoted string literal and decodes its escape sequences
+func (l *graphqlLexer) readString(location graphqlLocation) (graphqlToken, error) {
+	l.pos++ // Opening quote
+	var b strings.Builder
+	for l.pos < len(l.source) {
+		c := l.source[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return graphqlToken{Kind: graphqlTokenString, Value: b.String(), Location: location}, nil
+		case c == '\n' || c == '\r':
+			return graphqlToken{}, l.errorf(l.pos, "unterminated string")
+		case c == '\\':
+			if l.pos+1 >= len(l.source) {
+				return graphqlToken{}, l.errorf(l.pos, "unterminated string")
+			}
+			escape := l.source[l.pos+1]
+			if escape == 'u' {
+				if l.pos+6 > len(l.source) {
+					return graphqlToken{}, l.errorf(l.pos, "invalid unicode escape sequence")
+				}
+				code, err := strconv.ParseUint(l.source[l.pos+2:l.pos+6], 16, 32)
+				if err != nil {
+					return graphqlToken{}, l.errorf(l.pos, "invalid unicode escape sequence %q", l.source[l.pos:l.pos+6])
+				}
+				b.WriteRune(rune(code))
+				l.pos += 6
+				continue
+			}
+			decoded, ok := map[byte]string{'"': `"`, '\\': `\`, '/': "/", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t"}[escape]
+			if !ok {
+				return graphqlToken{}, l.errorf(l.pos, "invalid escape sequence \\%c", escape)
+			}
+			b.WriteString(decoded)
+			l.pos += 2
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return graphqlToken{}, l.errorf(l.pos, "unterminated string")
+}
+
+// readBlockString reads a """block string""" and removes its common indentation
+func (l *graphqlLexer) readBlockString(location graphqlLocation) (graphqlToken, error) {
+	l.pos += 3
+	var b strings.Builder
+	for l.pos < len(l.source) {
+		switch {
+		case strings.HasPrefix(l.source[l.pos:], `"""`):
+			l.pos += 3
+			return graphqlToken{Kind: graphqlTokenString, Value: dedentBlockString(b.String()), Location: location}, nil
+		case strings.HasPrefix(l.source[l.pos:], `\"""`):
+			b.WriteString(`"""`)
+			l.pos += 4
+		default:
+			c := l.source[l.pos]
+			b.WriteByte(c)
+			l.pos++
+			if c == '\n' || (c == '\r' && (l.pos >= len(l.source) || l.source[l.pos] != '\n')) {
+				l.newline(l.pos)
+			}
+		}
+	}
+	return graphqlToken{}, l.errorf(l.pos, "unterminated block string")
+}
+
+// dedentBlockString applies the block string value algorithm: common indentation and blank edge lines are removed
+func dedentBlockString(raw string) string {
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(raw), "\n")
+	common := -1
+	for _, line := range lines[1:] {
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < len(line) && (common < 0 || indent < common) {
+			common = indent
+		}
+	}
+	if common > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= common {
+				lines[i] = lines[i][common:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isGraphQLLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isGraphQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// graphqlDocument is a parsed executable document
+type graphqlDocument struct {
+	Operations []*graphqlOperation
+	Fragments  map[string]*graphqlFragment
+}
+
+// graphqlOperation is a query, mutation or subscription definition
+type graphqlOperation struct {
+	Type       string // "query", "mutation" or "subscription"
+	Name       string
+	Variables  []*graphqlVariableDefinition
+	Directives []*graphqlDirective
+	Selections []graphqlSelection
+	Location   graphqlLocation
+}
+
+// graphqlVariableDefinition declares an operation variable
+type graphqlVariableDefinition struct {
+	Name     string
+	Type     *graphqlTypeRef
+	Default  *graphqlValue // nil if there is no default
+	Location graphqlLocation
+}
+
+// graphqlFragment is a named fragment definition
+type graphqlFragment struct {
+	Name          string
+	TypeCondition string
+	Directives    []*graphqlDirective
+	Selections    []graphqlSelection
+	Location      graphqlLocation
+}
+
+// graphqlSelection is a *graphqlField, *graphqlFragmentSpread or *graphqlInlineFragment
+type graphqlSelection interface{}
+
+// graphqlField selects a field, optionally under an alias
+type graphqlField struct {
+	Alias      string
+	Name       string
+	Arguments  []*graphqlArgument
+	Directives []*graphqlDirective
+	Selections []graphqlSelection
+	Location   graphqlLocation
+}
+
+// ResponseKey returns the key of the field in the result: the alias if set, otherwise the name
+func (f *graphqlField) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// graphqlFragmentSpread includes a named fragment
+type graphqlFragmentSpread struct {
+	Name       string
+	Directives []*graphqlDirective
+	Location   graphqlLocation
+}
+
+// graphqlInlineFragment includes a selection set, optionally for a type condition
+type graphqlInlineFragment struct {
+	TypeCondition string
+	Directives    []*graphqlDirective
+	Selections    []graphqlSelection
+	Location      graphqlLocation
+}
+
+// graphqlDirective is an @name(arguments) annotation
+type graphqlDirective struct {
+	Name      string
+	Arguments []*graphqlArgument
+	Location  graphqlLocation
+}
+
+// graphqlArgument is a name: value pair of a field or directive
+type graphqlArgument struct {
+	Name     string
+	Value    *graphqlValue
+	Location graphqlLocation
+}
+
+// Value kinds of graphqlValue
+const (
+	graphqlValueVariable = iota
+	graphqlValueInt
+	graphqlValueFloat
+	graphqlValueString
+	graphqlValueBoolean
+	graphqlValueNull
+	graphqlValueEnum
+	graphqlValueList
+	graphqlValueObject
+)
+
+// graphqlValue is an input value literal or variable reference
+type graphqlValue struct {
+	Kind     int
+	Raw      string // Variable name, number literal, string value, true/false or enum value
+	List     []*graphqlValue
+	Fields   []*graphqlArgument // Object fields
+	Location graphqlLocation
+}
+
+// graphqlTypeRef is a type reference such as Int, [String!] or Granularity!
+type graphqlTypeRef struct {
+	Name    string          // Named type, empty for lists
+	Elem    *graphqlTypeRef // Element type of a list
+	NonNull bool
+}
+
+// String renders the type reference in GraphQL syntax
+func (t *graphqlTypeRef) String() string {
+	s := t.Name
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+	if t.NonNull {
+		s += "!"
+	}
+	return s
+}
+
+// Named returns the innermost named type
+func (t *graphqlTypeRef) Named() string {
+	for t.Elem != nil {
+		t = t.Elem
+	}
+	return t.Name
+}
+
+// graphqlParser is a recursive descent parser for executable GraphQL documents
+type graphqlParser struct {
+	lexer   *graphqlLexer
+	token   graphqlToken
+	nesting int
+}
+
+// parseGraphQL parses a query document
+func parseGraphQL(source string) (*graphqlDocument, error) {
+	p := &graphqlParser{lexer: &graphqlLexer{source: source, line: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &graphqlDocument{Fragments: make(map[string]*graphqlFragment)}
+	if p.token.Kind == graphqlTokenEOF {
+		return nil, p.errorf("document contains no operations")
+	}
+	for p.token.Kind != graphqlTokenEOF {
+		switch {
+		case p.peek(graphqlTokenPunctuator, "{"):
+			// Query shorthand without the query keyword
+			operation := &graphqlOperation{Type: "query", Location: p.token.Location}
+			var err error
+			if operation.Selections, err = p.parseSelectionSet(); err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, operation)
+		case p.peek(graphqlTokenName, "query"), p.peek(graphqlTokenName, "mutation"), p.peek(graphqlTokenName, "subscription"):
+			operation, err := p.parseOperation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, operation)
+		case p.peek(graphqlTokenName, "fragment"):
+			fragment, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := doc.Fragments[fragment.Name]; exists {
+				return nil, &graphqlSyntaxError{Message: fmt.Sprintf("there can be only one fragment named %q", fragment.Name), Location: fragment.Location}
+			}
+			doc.Fragments[fragment.Name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, p.errorf("document contains no operations")
+	}
+	return doc, nil
+}
+
+// advance reads the next token
+func (p *graphqlParser) advance() error {
+	token, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = token
+	return nil
+}
+
+// peek reports whether the current token has the given kind and value
+func (p *graphqlParser) peek(kind int, value string) bool {
+	return p.token.Kind == kind && p.token.Value == value
+}
+
+// skip consumes the current token if it is the given punctuator
+func (p *graphqlParser) skip(punctuator string) (bool, error) {
+	if !p.peek(graphqlTokenPunctuator, punctuator) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+// expect consumes the given punctuator or fails
+func (p *graphqlParser) expect(punctuator string) error {
+	if !p.peek(graphqlTokenPunctuator, punctuator) {
+		return p.errorf("expected %q, found %s", punctuator, p.describe())
+	}
+	return p.advance()
+}
+
+// expectName consumes a name token and returns it
+func (p *graphqlParser) expectName() (string, error) {
+	if p.token.Kind != graphqlTokenName {
+		return "", p.errorf("expected name, found %s", p.describe())
+	}
+	name := p.token.Value
+	return name, p.advance()
+}
+
+// enter tracks nesting of selection sets and values, failing beyond graphqlMaxNesting
+func (p *graphqlParser) enter() error {
+	p.nesting++
+	if p.nesting > graphqlMaxNesting {
+		return p.errorf("document is nested too deeply")
+	}
+	return nil
+}
+
+func (p *graphqlParser) leave() {
+	p.nesting--
+}
+
+// errorf returns a syntax error at the current token
+func (p *graphqlParser) errorf(format string, args ...interface{}) error {
+	return &graphqlSyntaxError{Message: fmt.Sprintf(format, args...), Location: p.token.Location}
+}
+
+// unexpected returns a syntax error for the current token
+func (p *graphqlParser) unexpected() error {
+	return p.errorf("unexpected %s", p.describe())
+}
+
+// describe names the current token for error messages
+func (p *graphqlParser) describe() string {
+	switch p.token.Kind {
+	case graphqlTokenEOF:
+		return "<EOF>"
+	case graphqlTokenString:
+		return fmt.Sprintf("string %q", p.token.Value)
+	default:
+		return fmt.Sprintf("%q", p.token.Value)
+	}
+}
+
+// parseOperation parses "query Name($var: Type = default) @directive { ... }"
+func (p *graphqlParser) parseOperation() (*graphqlOperation, error) {
+	operation := &graphqlOperation{Type: p.token.Value, Location: p.token.Location}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.token.Kind == graphqlTokenName {
+		if operation.Name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+
+	if ok, err := p.skip("("); err != nil {
+		return nil, err
+	} else if ok {
+		for !p.peek(graphqlTokenPunctuator, ")") {
+			definition, err := p.parseVariableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			operation.Variables = append(operation.Variables, definition)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if operation.Directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if operation.Selections, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return operation, nil
+}
+
+// parseVariableDefinition parses "$name: Type = default"
+func (p *graphqlParser) parseVariableDefinition() (*graphqlVariableDefinition, error) {
+	definition := &graphqlVariableDefinition{Location: p.token.Location}
+	if err := p.expect("$"); err != nil {
+		return nil, err
+	}
+	var err error
+	if definition.Name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	if definition.Type, err = p.parseTypeRef(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip("="); err != nil {
+		return nil, err
+	} else if ok {
+		if definition.Default, err = p.parseValue(true); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+// parseTypeRef parses a type reference
+func (p *graphqlParser) parseTypeRef() (*graphqlTypeRef, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	t := &graphqlTypeRef{}
+	if ok, err := p.skip("["); err != nil {
+		return nil, err
+	} else if ok {
+		if t.Elem, err = p.parseTypeRef(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	} else if t.Name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+
+	if ok, err := p.skip("!"); err != nil {
+		return nil, err
+	} else if ok {
+		t.NonNull = true
+	}
+	return t, nil
+}
+
+// parseFragment parses "fragment Name on Type @directive { ... }"
+func (p *graphqlParser) parseFragment() (*graphqlFragment, error) {
+	fragment := &graphqlFragment{Location: p.token.Location}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if fragment.Name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if fragment.Name == "on" {
+		return nil, &graphqlSyntaxError{Message: "fragment cannot be named \"on\"", Location: fragment.Location}
+	}
+	if !p.peek(graphqlTokenName, "on") {
+		return nil, p.errorf("expected \"on\", found %s", p.describe())
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if fragment.TypeCondition, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if fragment.Directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if fragment.Selections, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+// parseSelectionSet parses "{ selection ... }"
+func (p *graphqlParser) parseSelectionSet() ([]graphqlSelection, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []graphqlSelection
+	for !p.peek(graphqlTokenPunctuator, "}") {
+		selection, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, p.errorf("selection set cannot be empty")
+	}
+	return selections, p.advance()
+}
+
+// parseSelection parses a field, fragment spread or inline fragment
+func (p *graphqlParser) parseSelection() (graphqlSelection, error) {
+	location := p.token.Location
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		if p.token.Kind == graphqlTokenName && p.token.Value != "on" {
+			spread := &graphqlFragmentSpread{Name: p.token.Value, Location: location}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if spread.Directives, err = p.parseDirectives(); err != nil {
+				return nil, err
+			}
+			return spread, nil
+		}
+
+		inline := &graphqlInlineFragment{Location: location}
+		if p.peek(graphqlTokenName, "on") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if inline.TypeCondition, err = p.expectName(); err != nil {
+				return nil, err
+			}
+		}
+		if inline.Directives, err = p.parseDirectives(); err != nil {
+			return nil, err
+		}
+		if inline.Selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+		return inline, nil
+	}
+
+	field := &graphqlField{Location: location}
+	var err error
+	if field.Name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		field.Alias = field.Name
+		if field.Name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	if field.Arguments, err = p.parseArguments(); err != nil {
+		return nil, err
+	}
+	if field.Directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if p.peek(graphqlTokenPunctuator, "{") {
+		if field.Selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// parseArguments parses an optional "(name: value ...)" list
+func (p *graphqlParser) parseArguments() ([]*graphqlArgument, error) {
+	if ok, err := p.skip("("); err != nil || !ok {
+		return nil, err
+	}
+	var arguments []*graphqlArgument
+	for !p.peek(graphqlTokenPunctuator, ")") {
+		argument, err := p.parseArgument(false)
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range arguments {
+			if existing.Name == argument.Name {
+				return nil, &graphqlSyntaxError{Message: fmt.Sprintf("there can be only one argument named %q", argument.Name), Location: argument.Location}
+			}
+		}
+		arguments = append(arguments, argument)
+	}
+	if len(arguments) == 0 {
+		return nil, p.errorf("argument list cannot be empty")
+	}
+	return arguments, p.advance()
+}
+
+// parseArgument parses "name: value"
+func (p *graphqlParser) parseArgument(constant bool) (*graphqlArgument, error) {
+	argument := &graphqlArgument{Location: p.token.Location}
+	var err error
+	if argument.Name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	if argument.Value, err = p.parseValue(constant); err != nil {
+		return nil, err
+	}
+	return argument, nil
+}
+
+// parseDirectives parses zero or more "@name(arguments)"
+func (p *graphqlParser) parseDirectives() ([]*graphqlDirective, error) {
+	var directives []*graphqlDirective
+	for p.peek(graphqlTokenPunctuator, "@") {
+		directive := &graphqlDirective{Location: p.token.Location}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		if directive.Name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+		if directive.Arguments, err = p.parseArguments(); err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// parseValue parses an input value; constant values (defaults) cannot reference variables
+func (p *graphqlParser) parseValue(constant bool) (*graphqlValue, error) {
+	value := &graphqlValue{Location: p.token.Location}
+	switch p.token.Kind {
+	case graphqlTokenInt:
+		value.Kind, value.Raw = graphqlValueInt, p.token.Value
+	case graphqlTokenFloat:
+		value.Kind, value.Raw = graphqlValueFloat, p.token.Value
+	case graphqlTokenString:
+		value.Kind, value.Raw = graphqlValueString, p.token.Value
+	case graphqlTokenName:
+		switch p.token.Value {
+		case "true", "false":
+			value.Kind = graphqlValueBoolean
+		case "null":
+			value.Kind = graphqlValueNull
+		default:
+			value.Kind = graphqlValueEnum
+		}
+		value.Raw = p.token.Value
+	case graphqlTokenPunctuator:
+		switch p.token.Value {
+		case "$":
+			if constant {
+				return nil, p.errorf("unexpected variable in constant value")
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			value.Kind, value.Raw = graphqlValueVariable, name
+			return value, nil
+		case "[":
+			return p.parseListValue(value, constant)
+		case "{":
+			return p.parseObjectValue(value, constant)
+		}
+		return nil, p.unexpected()
+	default:
+		return nil, p.unexpected()
+	}
+	return value, p.advance()
+}
+
+// parseListValue parses "[value ...]"
+func (p *graphqlParser) parseListValue(value *graphqlValue, constant bool) (*graphqlValue, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	value.Kind = graphqlValueList
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for !p.peek(graphqlTokenPunctuator, "]") {
+		item, err := p.parseValue(constant)
+		if err != nil {
+			return nil, err
+		}
+		value.List = append(value.List, item)
+	}
+	return value, p.advance()
+}
+
+// parseObjectValue parses "{name: value ...}"
+func (p *graphqlParser) parseObjectValue(value *graphqlValue, constant bool) (*graphqlValue, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	value.Kind = graphqlValueObject
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for !p.peek(graphqlTokenPunctuator, "}") {
+		field, err := p.parseArgument(constant)
+		if err != nil {
+			return nil, err
+		}
+		value.Fields = append(value.Fields, field)
+	}
+	return value, p.advance()
+}
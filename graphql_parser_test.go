@@ -0,0 +1,200 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraphQLLexer(t *testing.T) {
+	source := "\uFEFF{ a(x: -12.5e3, y: \"q\\\"\\u00e9\\n\") # comment\n  ...F, $v }"
+	lexer := &graphqlLexer{source: source, line: 1}
+	want := []graphqlToken{
+		{Kind: graphqlTokenPunctuator, Value: "{"},
+		{Kind: graphqlTokenName, Value: "a"},
+		{Kind: graphqlTokenPunctuator, Value: "("},
+		{Kind: graphqlTokenName, Value: "x"},
+		{Kind: graphqlTokenPunctuator, Value: ":"},
+		{Kind: graphqlTokenFloat, Value: "-12.5e3"},
+		{Kind: graphqlTokenName, Value: "y"},
+		{Kind: graphqlTokenPunctuator, Value: ":"},
+		{Kind: graphqlTokenString, Value: "q\"é\n"},
+		{Kind: graphqlTokenPunctuator, Value: ")"},
+		{Kind: graphqlTokenPunctuator, Value: "...", Location: graphqlLocation{Line: 2, Column: 3}},
+		{Kind: graphqlTokenName, Value: "F"},
+		{Kind: graphqlTokenPunctuator, Value: "$"},
+		{Kind: graphqlTokenName, Value: "v"},
+		{Kind: graphqlTokenPunctuator, Value: "}"},
+		{Kind: graphqlTokenEOF},
+	}
+	for i, expected := range want {
+		token, err := lexer.next()
+		if err != nil {
+			t.Fatalf("token %d: %v", i, err)
+		}
+		if token.Kind != expected.Kind || token.Value != expected.Value {
+			t.Fatalf("token %d = %d %q, want %d %q", i, token.Kind, token.Value, expected.Kind, expected.Value)
+		}
+		if expected.Location.Line != 0 && token.Location != expected.Location {
+			t.Errorf("token %d at %+v, want %+v", i, token.Location, expected.Location)
+		}
+	}
+}
+
+func TestGraphQLBlockString(t *testing.T) {
+	lexer := &graphqlLexer{source: "\"\"\"\n    first\n      second \\\"\"\"\n    \"\"\" next", line: 1}
+	token, err := lexer.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first\n  second \"\"\""; token.Value != want {
+		t.Errorf("block string = %q, want %q", token.Value, want)
+	}
+	if token, _ = lexer.next(); token.Location != (graphqlLocation{Line: 4, Column: 9}) {
+		t.Errorf("token after block string at %+v, want 4:9", token.Location)
+	}
+}
+
+func TestParseGraphQL(t *testing.T) {
+	document, err := parseGraphQL(`
+		query Traffic($names: [String!] = ["eth0"], $granularity: Granularity!) @skip(if: false) {
+			list: interfaces(names: $names) {
+				name
+				...Totals
+				... on Interface @include(if: true) { alias }
+			}
+		}
+		fragment Totals on Interface { total { rx tx } traffic(granularity: $granularity, limit: 3) { start } }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Operations) != 1 || len(document.Fragments) != 1 {
+		t.Fatalf("got %d operations and %d fragments, want 1 and 1", len(document.Operations), len(document.Fragments))
+	}
+	operation := document.Operations[0]
+	if operation.Type != "query" || operation.Name != "Traffic" || len(operation.Directives) != 1 {
+		t.Errorf("operation = %s %q with %d directives", operation.Type, operation.Name, len(operation.Directives))
+	}
+	if len(operation.Variables) != 2 {
+		t.Fatalf("got %d variables, want 2", len(operation.Variables))
+	}
+	names := operation.Variables[0]
+	if names.Type.String() != "[String!]" || names.Default == nil || names.Default.Kind != graphqlValueList || names.Default.List[0].Raw != "eth0" {
+		t.Errorf("variable $names = %s with default %+v", names.Type, names.Default)
+	}
+	if granularity := operation.Variables[1]; granularity.Type.String() != "Granularity!" || granularity.Type.Named() != "Granularity" {
+		t.Errorf("variable $granularity has type %s", granularity.Type)
+	}
+
+	list, ok := operation.Selections[0].(*graphqlField)
+	if !ok || list.Name != "interfaces" || list.ResponseKey() != "list" {
+		t.Fatalf("first selection = %#v, want interfaces aliased as list", operation.Selections[0])
+	}
+	if argument := list.Arguments[0]; argument.Name != "names" || argument.Value.Kind != graphqlValueVariable || argument.Value.Raw != "names" {
+		t.Errorf("argument = %q %+v, want names: $names", argument.Name, argument.Value)
+	}
+	if location := list.Location; location != (graphqlLocation{Line: 3, Column: 4}) {
+		t.Errorf("field at %+v, want 3:4", location)
+	}
+	if spread, ok := list.Selections[1].(*graphqlFragmentSpread); !ok || spread.Name != "Totals" {
+		t.Errorf("second selection = %#v, want ...Totals", list.Selections[1])
+	}
+	if inline, ok := list.Selections[2].(*graphqlInlineFragment); !ok || inline.TypeCondition != "Interface" || len(inline.Directives) != 1 {
+		t.Errorf("third selection = %#v, want inline fragment on Interface", list.Selections[2])
+	}
+
+	fragment := document.Fragments["Totals"]
+	if fragment.TypeCondition != "Interface" || len(fragment.Selections) != 2 {
+		t.Errorf("fragment on %q with %d selections", fragment.TypeCondition, len(fragment.Selections))
+	}
+}
+
+func TestParseGraphQLValues(t *testing.T) {
+	document, err := parseGraphQL(`{ f(a: 1, b: 2.5, c: "s", d: true, e: null, g: DAY, h: [1, [2]], i: {j: "k"}) }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		kind int
+		raw  string
+	}{
+		{graphqlValueInt, "1"},
+		{graphqlValueFloat, "2.5"},
+		{graphqlValueString, "s"},
+		{graphqlValueBoolean, "true"},
+		{graphqlValueNull, ""},
+		{graphqlValueEnum, "DAY"},
+		{graphqlValueList, ""},
+		{graphqlValueObject, ""},
+	}
+	arguments := document.Operations[0].Selections[0].(*graphqlField).Arguments
+	if len(arguments) != len(want) {
+		t.Fatalf("got %d arguments, want %d", len(arguments), len(want))
+	}
+	for i, expected := range want {
+		value := arguments[i].Value
+		if value.Kind != expected.kind || (expected.raw != "" && value.Raw != expected.raw) {
+			t.Errorf("argument %s = kind %d %q, want kind %d %q", arguments[i].Name, value.Kind, value.Raw, expected.kind, expected.raw)
+		}
+	}
+	if list := arguments[6].Value.List; len(list) != 2 || list[1].Kind != graphqlValueList {
+		t.Errorf("nested list = %+v", list)
+	}
+	if fields := arguments[7].Value.Fields; len(fields) != 1 || fields[0].Name != "j" || fields[0].Value.Raw != "k" {
+		t.Errorf("object fields = %+v", fields)
+	}
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		message  string
+		location graphqlLocation
+	}{
+		{"empty", "  ", "no operations", graphqlLocation{Line: 1, Column: 3}},
+		{"only fragment", "fragment F on Query { a }", "no operations", graphqlLocation{Line: 1, Column: 26}},
+		{"unclosed selection", "{ a", "", graphqlLocation{Line: 1, Column: 4}},
+		{"single dot", "{ .a }", "did you mean", graphqlLocation{Line: 1, Column: 3}},
+		{"bad character", "{ a ? }", "unexpected character", graphqlLocation{Line: 1, Column: 5}},
+		{"leading zero", "{ a(x: 01) }", "after 0", graphqlLocation{Line: 1, Column: 8}},
+		{"missing exponent", "{ a(x: 1e) }", "exponent", graphqlLocation{Line: 1, Column: 10}},
+		{"unterminated string", "{ a(x: \"abc\n) }", "unterminated string", graphqlLocation{Line: 1, Column: 12}},
+		{"bad escape", `{ a(x: "\q") }`, "escape", graphqlLocation{Line: 1, Column: 9}},
+		{"variable in constant", "query ($a: Int = $b) { f }", "", graphqlLocation{Line: 1, Column: 18}},
+		{"duplicate fragment", "{ ...F } fragment F on Query { a } fragment F on Query { b }", "only one fragment", graphqlLocation{Line: 1, Column: 36}},
+		{"fragment named on", "{ a } fragment on on Query { a }", `named "on"`, graphqlLocation{Line: 1, Column: 7}},
+		{"second line", "{\n  a(\n}", "", graphqlLocation{Line: 3, Column: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseGraphQL(tt.query)
+			syntaxErr, ok := err.(*graphqlSyntaxError)
+			if !ok {
+				t.Fatalf("error = %v, want a syntax error", err)
+			}
+			if !strings.Contains(syntaxErr.Message, tt.message) {
+				t.Errorf("message = %q, want it to contain %q", syntaxErr.Message, tt.message)
+			}
+			if syntaxErr.Location != tt.location {
+				t.Errorf("location = %+v, want %+v", syntaxErr.Location, tt.location)
+			}
+		})
+	}
+}
+
+func TestParseGraphQLNesting(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("{ a ", depth) + strings.Repeat("}", depth)
+	}
+	if _, err := parseGraphQL(nested(graphqlMaxNesting)); err != nil {
+		t.Errorf("nesting %d rejected: %v", graphqlMaxNesting, err)
+	}
+	if _, err := parseGraphQL(nested(graphqlMaxNesting + 1)); err == nil {
+		t.Errorf("nesting %d accepted", graphqlMaxNesting+1)
+	}
+	if _, err := parseGraphQL("{ f(x: " + strings.Repeat("[", 10000) + strings.Repeat("]", 10000) + ") }"); err == nil {
+		t.Error("deeply nested list value accepted")
+	}
+}
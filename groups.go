@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// InterfaceGroup is a synthetic interface summing the traffic of the interfaces matching its patterns
+type InterfaceGroup struct {
+	Name    string
+	Include []string // Glob patterns of member interfaces
+	Exclude []string // Glob patterns removed from the members
+}
+
+// parseInterfaceGroup parses "name=pattern,pattern,!pattern" where patterns prefixed with ! exclude members
+func parseInterfaceGroup(spec string) (InterfaceGroup, error) {
+	name, patterns, ok := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return InterfaceGroup{}, fmt.Errorf("invalid interface group %q (expected name=pattern[,pattern...])", spec)
+	}
+
+	group := InterfaceGroup{Name: name}
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		exclude := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return InterfaceGroup{}, fmt.Errorf("invalid pattern %q in interface group %q", pattern, name)
+		}
+		if exclude {
+			group.Exclude = append(group.Exclude, pattern)
+		} else {
+			group.Include = append(group.Include, pattern)
+		}
+	}
+	if len(group.Include) == 0 {
+		return InterfaceGroup{}, fmt.Errorf("interface group %q has no member patterns", name)
+	}
+	return group, nil
+}
+
+// parseGlobList parses a comma-separated list of glob patterns
+func parseGlobList(spec string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(spec, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// matchesAny reports whether name matches one of the glob patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the interface is a member of the group
+func (g InterfaceGroup) matches(name string) bool {
+	return matchesAny(g.Include, name) && !matchesAny(g.Exclude, name)
+}
+
+// InterfaceGrouping hides excluded interfaces and adds interface groups to vnstat data
+type InterfaceGrouping struct {
+	exclude []string // Glob patterns of interfaces hidden everywhere
+	groups  []InterfaceGroup
+
+	mu     sync.Mutex
+	warned map[string]bool // Groups already reported as clashing with a real interface
+}
+
+// NewInterfaceGrouping creates a new InterfaceGrouping instance
+func NewInterfaceGrouping(exclude []string, groups []InterfaceGroup) *InterfaceGrouping {
+	return &InterfaceGrouping{
+		exclude: exclude,
+		groups:  groups,
+		warned:  make(map[string]bool),
+	}
+}
+
+// Excluded reports whether the interface is hidden by the global exclude list
+func (g *InterfaceGrouping) Excluded(name string) bool {
+	return g != nil && matchesAny(g.exclude, name)
+}
+
+// Apply removes excluded interfaces and appends one aggregate interface per group with members present
+func (g *InterfaceGrouping) Apply(data *VnstatData) {
+	interfaces := make([]InterfaceData, 0, len(data.Interfaces)+len(g.groups))
+	for _, iface := range data.Interfaces {
+		if !g.Excluded(iface.Name) {
+			interfaces = append(interfaces, iface)
+		}
+	}
+
+	realCount := len(interfaces)
+	for _, group := range g.groups {
+		var members []InterfaceData
+		clash := false
+		for _, iface := range interfaces[:realCount] {
+			if iface.Name == group.Name {
+				clash = true
+				break
+			}
+			if group.matches(iface.Name) {
+				members = append(members, iface)
+			}
+		}
+		if clash {
+			g.warnClash(group.Name)
+			continue
+		}
+		if len(members) > 0 {
+			interfaces = append(interfaces, aggregateInterfaces(group.Name, members))
+		}
+	}
+
+	data.Interfaces = interfaces
+}
+
+// groupEntries sums one granularity of the groups for callers that see the real interfaces one at a time
+type groupEntries struct {
+	grouping *InterfaceGrouping
+	members  map[string][][]TrafficEntry // Group name -> entries of each member seen so far
+	real     map[string]bool             // Real interfaces seen, a group with the same name is skipped
+}
+
+// newGroupEntries returns an empty accumulator; a nil grouping has no groups
+func (g *InterfaceGrouping) newGroupEntries() *groupEntries {
+	return &groupEntries{
+		grouping: g,
+		members:  make(map[string][][]TrafficEntry),
+		real:     make(map[string]bool),
+	}
+}
+
+// add records the entries of a real, not excluded interface
+func (e *groupEntries) add(name string, entries []TrafficEntry) {
+	e.real[name] = true
+	if e.grouping == nil {
+		return
+	}
+	for _, group := range e.grouping.groups {
+		if group.matches(name) {
+			e.members[group.Name] = append(e.members[group.Name], entries)
+		}
+	}
+}
+
+// each calls fn with the summed entries of every group with members, in group order, like Apply
+func (e *groupEntries) each(fn func(name string, entries []TrafficEntry) error) error {
+	if e.grouping == nil {
+		return nil
+	}
+	for _, group := range e.grouping.groups {
+		if e.real[group.Name] {
+			e.grouping.warnClash(group.Name)
+			continue
+		}
+		if lists := e.members[group.Name]; len(lists) > 0 {
+			if err := fn(group.Name, sumEntries(lists)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// warnClash logs once that a group is skipped because a real interface has its name
+func (g *InterfaceGrouping) warnClash(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.warned[name] {
+		g.warned[name] = true
+		slog.Warn("Interface group skipped: an interface with the same name exists", "group", name)
+	}
+}
+
+// aggregateInterfaces sums the traffic of members into one interface named name
+// Periods are matched on their start time, so members with different retention still add up per period
+func aggregateInterfaces(name string, members []InterfaceData) InterfaceData {
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		names = append(names, member.Name)
+	}
+
+	aggregate := InterfaceData{Name: name, Alias: strings.Join(names, "+")}
+	for _, member := range members {
+		if member.Created.Timestamp > 0 && (aggregate.Created.Timestamp == 0 || member.Created.Timestamp < aggregate.Created.Timestamp) {
+			aggregate.Created = member.Created
+		}
+		if member.Updated.Timestamp > aggregate.Updated.Timestamp {
+			aggregate.Updated = member.Updated
+		}
+		aggregate.Traffic.Total.Rx += member.Traffic.Total.Rx
+		aggregate.Traffic.Total.Tx += member.Traffic.Total.Tx
+	}
+
+	for _, granularity := range trafficGranularities {
+		lists := make([][]TrafficEntry, 0, len(members))
+		for _, member := range members {
+			entries, _ := member.Traffic.Entries(granularity)
+			lists = append(lists, entries)
+		}
+		aggregate.Traffic.setEntries(granularity, sumEntries(lists))
+	}
+
+	// Top days are recomputed from the summed days, including days members only keep in their top list
+	topSize := 0
+	days := make([][]TrafficEntry, 0, len(members))
+	for _, member := range members {
+		if len(member.Traffic.Top) > topSize {
+			topSize = len(member.Traffic.Top)
+		}
+		known := make(map[int64]bool, len(member.Traffic.Day))
+		memberDays := append([]TrafficEntry(nil), member.Traffic.Day...)
+		for _, entry := range member.Traffic.Day {
+			known[entry.Start().Unix()] = true
+		}
+		for _, entry := range member.Traffic.Top {
+			if !known[entry.Start().Unix()] {
+				memberDays = append(memberDays, entry)
+			}
+		}
+		days = append(days, memberDays)
+	}
+	top := sumEntries(days)
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Total() > top[j].Total() })
+	if len(top) > topSize {
+		top = top[:topSize]
+	}
+	aggregate.Traffic.Top = top
+
+	return aggregate
+}
+
+// sumEntries adds up entries of the same period start across lists, sorted by start
+func sumEntries(lists [][]TrafficEntry) []TrafficEntry {
+	index := make(map[int64]int)
+	var summed []TrafficEntry
+	for _, entries := range lists {
+		for _, entry := range entries {
+			start := entry.Start().Unix()
+			if i, ok := index[start]; ok {
+				summed[i].Rx += entry.Rx
+				summed[i].Tx += entry.Tx
+				continue
+			}
+			index[start] = len(summed)
+			summed = append(summed, TrafficEntry{
+				Date:      entry.Date,
+				Time:      entry.Time,
+				Timestamp: entry.Timestamp,
+				Rx:        entry.Rx,
+				Tx:        entry.Tx,
+			})
+		}
+	}
+	sort.SliceStable(summed, func(i, j int) bool { return summed[i].Start().Before(summed[j].Start()) })
+	return summed
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseInterfaceGroup(t *testing.T) {
+	group, err := parseInterfaceGroup(" wan = eth*, wg?, !eth9 ,, !wg1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.Name != "wan" || !slices.Equal(group.Include, []string{"eth*", "wg?"}) || !slices.Equal(group.Exclude, []string{"eth9", "wg1"}) {
+		t.Errorf("group = %+v", group)
+	}
+
+	for _, spec := range []string{"wan", "=eth0", "wan=!eth0", "wan=eth[", "wan= , "} {
+		if _, err := parseInterfaceGroup(spec); err == nil {
+			t.Errorf("parseInterfaceGroup(%q) accepted", spec)
+		}
+	}
+}
+
+func TestInterfaceGroupMatches(t *testing.T) {
+	group, err := parseInterfaceGroup("wan=eth*,wg?,!eth9,!*.100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"eth0":     true,
+		"eth10":    true,
+		"wg0":      true,
+		"wg10":     false, // ? matches one character
+		"eth9":     false, // Exclusions win over inclusions
+		"eth0.100": false,
+		"docker0":  false,
+	}
+	for name, want := range tests {
+		if got := group.matches(name); got != want {
+			t.Errorf("matches(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestAggregateInterfaces(t *testing.T) {
+	// eth1 keeps fewer days than eth0, and its top list has a day that is no longer in its days
+	eth0 := InterfaceData{Name: "eth0", Traffic: TrafficData{
+		Total: TrafficTotal{Rx: 1000, Tx: 100},
+		Day:   []TrafficEntry{testDay(1, 10), testDay(2, 20), testDay(3, 30), testDay(4, 40)},
+		Top:   []TrafficEntry{testDay(4, 40), testDay(3, 30)},
+	}}
+	eth1 := InterfaceData{Name: "eth1", Traffic: TrafficData{
+		Total: TrafficTotal{Rx: 500, Tx: 50},
+		Day:   []TrafficEntry{testDay(3, 5), testDay(4, 6)},
+		Top:   []TrafficEntry{testDay(1, 90), testDay(4, 6)},
+	}}
+	aggregate := aggregateInterfaces("wan", []InterfaceData{eth0, eth1})
+
+	if aggregate.Name != "wan" || aggregate.Alias != "eth0+eth1" || aggregate.Traffic.Total != (TrafficTotal{Rx: 1500, Tx: 150}) {
+		t.Errorf("aggregate = %s (%s), total %+v", aggregate.Name, aggregate.Alias, aggregate.Traffic.Total)
+	}
+	// Periods are matched on their start: days only eth0 still has are kept as they are
+	var days []uint64
+	for _, entry := range aggregate.Traffic.Day {
+		days = append(days, entry.Rx)
+	}
+	if want := []uint64{10, 20, 35, 46}; !slices.Equal(days, want) {
+		t.Errorf("days = %v, want %v", days, want)
+	}
+	// Top days are recomputed from the summed days plus days only in a top list, and keep the longest list's size
+	var top []uint64
+	for _, entry := range aggregate.Traffic.Top {
+		top = append(top, entry.Rx)
+	}
+	if want := []uint64{100, 46}; !slices.Equal(top, want) {
+		t.Errorf("top = %v, want %v (day 1 from eth1's top list added to eth0's day)", top, want)
+	}
+}
+
+func TestInterfaceGroupingApply(t *testing.T) {
+	data := &VnstatData{Interfaces: []InterfaceData{
+		{Name: "eth0", Traffic: TrafficData{Day: []TrafficEntry{testDay(1, 1)}}},
+		{Name: "eth1", Traffic: TrafficData{Day: []TrafficEntry{testDay(1, 2)}}},
+		{Name: "docker0", Traffic: TrafficData{Day: []TrafficEntry{testDay(1, 4)}}},
+		{Name: "all", Traffic: TrafficData{Day: []TrafficEntry{testDay(1, 8)}}},
+	}}
+	grouping := NewInterfaceGrouping([]string{"docker*"}, []InterfaceGroup{
+		{Name: "wan", Include: []string{"eth*"}},
+		{Name: "containers", Include: []string{"docker*"}}, // Its only member is excluded
+		{Name: "all", Include: []string{"*"}},              // Clashes with a real interface
+		{Name: "everything", Include: []string{"*"}, Exclude: []string{"all"}},
+	})
+	grouping.Apply(data)
+
+	var names []string
+	for _, iface := range data.Interfaces {
+		names = append(names, iface.Name)
+	}
+	if want := []string{"eth0", "eth1", "all", "wan", "everything"}; !slices.Equal(names, want) {
+		t.Fatalf("interfaces = %v, want %v", names, want)
+	}
+	if rx := data.Interface("wan").Traffic.Day[0].Rx; rx != 3 {
+		t.Errorf("wan rx = %d, want 3", rx)
+	}
+	// Excluded interfaces are no members, even of a group matching everything
+	if everything := data.Interface("everything"); everything.Alias != "eth0+eth1" || everything.Traffic.Day[0].Rx != 3 {
+		t.Errorf("everything = %s with rx %d, want eth0+eth1 with 3", everything.Alias, everything.Traffic.Day[0].Rx)
+	}
+	if all := data.Interface("all"); all.Alias != "" || all.Traffic.Day[0].Rx != 8 {
+		t.Errorf("the real interface all was replaced by the group: %+v", all)
+	}
+	if !grouping.warned["all"] || len(grouping.warned) != 1 {
+		t.Errorf("warned about %v, want only the clashing group all", grouping.warned)
+	}
+}
+
+func TestExcludedInterfaceHiddenFromJSON(t *testing.T) {
+	s := newTestServer(t)
+	// vnstat reports eth0 and wg0; wg0 is hidden and so is no member of the group
+	data, err := parseVnstatData([]byte(testVnstatJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg0 := data.Interfaces[0]
+	wg0.Name = "wg0"
+	data.Interfaces = append(data.Interfaces, wg0)
+	output, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeVnstat(t, string(output))
+	s.service.SetInterfaceGrouping(NewInterfaceGrouping([]string{"wg*"}, []InterfaceGroup{{Name: "all", Include: []string{"*"}}}))
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(t, handler, "GET", "/json?token=secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (body %s)", rec.Code, rec.Body)
+	}
+	var served VnstatData
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, iface := range served.Interfaces {
+		names = append(names, iface.Name+"("+iface.Alias+")")
+	}
+	if want := []string{"eth0()", "all(eth0)"}; !slices.Equal(names, want) {
+		t.Errorf("interfaces = %v, want %v", names, want)
+	}
+	if rec := serve(t, handler, "GET", "/metrics?token=secret"); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `interface="wg0"`) {
+		t.Errorf("/metrics status %d, excluded interface present:\n%s", rec.Code, rec.Body)
+	}
+}
@@ -1,17 +1,33 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // Server wraps HTTP server configuration
 type Server struct {
-	token   string
-	service *VnstatService
+	token             string
+	service           *VnstatService
+	aggregator        *Aggregator // Set in aggregator mode
+	monthlyQuota      float64     // Monthly traffic quota in bytes, 0 if not configured
+	billingDay        int         // Day of month the billing cycle starts
+	anomalyThreshold  float64     // Robust z-score above which a period is anomalous
+	live              *LiveMonitor
+	accessLog         bool         // Log every request, not only server errors
+	exposeSelfMetrics bool         // Append the exporter's own metrics to /metrics
+	cors              *corsPolicy  // nil disables CORS
+	limiter           *rateLimiter // nil disables rate limiting and lockouts
+	trustedProxies    trustedProxies
+	graphql           *graphqlSchema
+	graphqlLimits     graphqlLimits
+	readinessConfig   readinessConfig
+	readiness         readinessCache
 }
 
 // NewServer creates a new Server instance
@@ -22,11 +38,9 @@ func NewServer(token string, service *VnstatService) *Server {
 	}
 }
 
-// addCORS adds CORS response headers
-func (s *Server) addCORS(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// forecastConfig returns the quota and billing cycle settings used by forecasts
+func (s *Server) forecastConfig() *forecastConfig {
+	return &forecastConfig{Quota: s.monthlyQuota, BillingDay: s.billingDay}
 }
 
 // checkToken validates the token in the request
@@ -36,37 +50,17 @@ func (s *Server) checkToken(r *http.Request) bool {
 		return true
 	}
 
-	// Get token from query parameters
+	// Get token from query parameters, compared in constant time so response timing reveals nothing about it
 	token := r.URL.Query().Get("token")
-	return token == s.token
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
 }
 
 // handleJSON handles /json endpoint, returns vnstat JSON data
 func (s *Server) handleJSON(w http.ResponseWriter, r *http.Request) {
-	s.addCORS(w)
-
-	// Handle OPTIONS preflight request
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	// Only allow GET requests
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Check token authentication
-	if !s.checkToken(r) {
-		http.Error(w, "Unauthorized: Invalid or missing token", http.StatusUnauthorized)
-		return
-	}
-
 	// Execute vnstat --json command
 	jsonData, err := s.service.GetJSON()
 	if err != nil {
-		log.Printf("Failed to get JSON data: %v", err)
+		slog.Error("Failed to get JSON data", "err", err)
 		// Return JSON formatted error
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -83,32 +77,19 @@ func (s *Server) handleJSON(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonData)
 }
 
-// handleText handles root path / endpoint, returns vnstat text data (monthly view)
+// handleText handles / and /monthly endpoints, returns the monthly text view
 func (s *Server) handleText(w http.ResponseWriter, r *http.Request) {
-	s.addCORS(w)
-
-	// Handle OPTIONS preflight request
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	// Only allow GET requests
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Check token authentication
-	if !s.checkToken(r) {
-		http.Error(w, "Unauthorized: Invalid or missing token", http.StatusUnauthorized)
+	opts, err := parseTextOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	opts.Forecast = s.forecastConfig()
 
-	// Execute vnstat -m command
-	textData, err := s.service.GetText()
+	// Render monthly view
+	textData, err := s.service.GetText(opts)
 	if err != nil {
-		log.Printf("Failed to get text data: %v", err)
+		slog.Error("Failed to get text data", "err", err)
 		// Return plain text error
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -123,31 +104,19 @@ func (s *Server) handleText(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleTextGeneric is a generic text handler function
-func (s *Server) handleTextGeneric(w http.ResponseWriter, r *http.Request, getData func() ([]byte, error)) {
-	s.addCORS(w)
-
-	// Handle OPTIONS preflight request
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	// Only allow GET requests
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Check token authentication
-	if !s.checkToken(r) {
-		http.Error(w, "Unauthorized: Invalid or missing token", http.StatusUnauthorized)
+// Query options: units, rate, columns, rows, ascii (see parseTextOptions)
+func (s *Server) handleTextGeneric(w http.ResponseWriter, r *http.Request, getData func(textOptions) ([]byte, error)) {
+	opts, err := parseTextOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	opts.Forecast = s.forecastConfig()
 
 	// Execute data retrieval function
-	textData, err := getData()
+	textData, err := getData(opts)
 	if err != nil {
-		log.Printf("Failed to get data: %v", err)
+		slog.Error("Failed to get data", "err", err)
 		// Return plain text error
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -197,22 +166,8 @@ func (s *Server) handleOneline(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleHealth handles /health endpoint for health checks
+// Health check does not require token authentication
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	s.addCORS(w)
-
-	// Handle OPTIONS preflight request
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	// Only allow GET requests
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Health check does not require token authentication
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -222,31 +177,18 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 // handleMetrics handles /metrics endpoint, returns Prometheus format metrics
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
-	s.addCORS(w)
-
-	// Handle OPTIONS preflight request
-	if r.Method == "OPTIONS" {
+	// In aggregator mode, serve fleet metrics with hostname labels
+	if s.aggregator != nil {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	// Only allow GET requests
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Token authentication is optional for metrics endpoint
-	// If token is set, require it; otherwise allow anonymous access
-	if s.token != "" && !s.checkToken(r) {
-		http.Error(w, "Unauthorized: Invalid or missing token", http.StatusUnauthorized)
+		w.Write([]byte(s.aggregator.generatePrometheusMetrics() + s.selfMetricsText()))
 		return
 	}
 
 	// Get JSON data
 	jsonData, err := s.service.GetJSON()
 	if err != nil {
-		log.Printf("Failed to get JSON data for metrics: %v", err)
+		slog.Error("Failed to get JSON data for metrics", "err", err)
 		http.Error(w, "Failed to fetch data", http.StatusInternalServerError)
 		return
 	}
@@ -254,7 +196,7 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	// Parse JSON and convert to Prometheus format
 	var vnstatData map[string]interface{}
 	if err := json.Unmarshal(jsonData, &vnstatData); err != nil {
-		log.Printf("Failed to parse JSON data: %v", err)
+		slog.Error("Failed to parse JSON data", "err", err)
 		http.Error(w, "Failed to parse data", http.StatusInternalServerError)
 		return
 	}
@@ -262,11 +204,37 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	// Generate Prometheus metrics
 	metrics := s.generatePrometheusMetrics(vnstatData)
 
+	// Append billing cycle forecasts and anomaly scores
+	if data, err := parseVnstatData(jsonData); err == nil {
+		metrics += generateForecastMetrics(data, *s.forecastConfig(), s.service.labels, time.Now())
+		metrics += generateAnomalyMetrics(data, s.anomalyThreshold, s.service.labels, time.Now())
+	} else {
+		slog.Warn("Forecast and anomaly metrics skipped", "err", err)
+	}
+
+	// Append kernel counter metrics if the live sampler is enabled
+	netDevCounters, err := s.service.GetNetDevCounters()
+	if err != nil {
+		slog.Error("Failed to sample interface counters", "err", err)
+	} else if netDevCounters != nil {
+		metrics += generateNetDevMetrics(netDevCounters, s.service.labels)
+	}
+
+	metrics += s.selfMetricsText()
+
 	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(metrics))
 }
 
+// selfMetricsText returns the exporter metrics appended to /metrics, empty when they are disabled or served on their own address
+func (s *Server) selfMetricsText() string {
+	if !s.exposeSelfMetrics {
+		return ""
+	}
+	return selfMetrics.generatePrometheusMetrics()
+}
+
 // generatePrometheusMetrics converts vnstat JSON to Prometheus format
 func (s *Server) generatePrometheusMetrics(data map[string]interface{}) string {
 	var metrics strings.Builder
@@ -290,11 +258,8 @@ func (s *Server) generatePrometheusMetrics(data map[string]interface{}) string {
 			continue
 		}
 
-		interfaceName := fmt.Sprintf("%v", ifaceMap["name"])
-		// Escape interface name for Prometheus label
-		interfaceName = strings.ReplaceAll(interfaceName, "\"", "\\\"")
-		interfaceName = strings.ReplaceAll(interfaceName, "\n", "\\n")
-		interfaceName = strings.ReplaceAll(interfaceName, "\\", "\\\\")
+		// Interface name plus configured interface and external labels, escaped for Prometheus
+		labels := s.service.labels.interfaceLabels(fmt.Sprintf("%v", ifaceMap["name"]))
 
 		traffic, ok := ifaceMap["traffic"].(map[string]interface{})
 		if !ok {
@@ -304,10 +269,10 @@ func (s *Server) generatePrometheusMetrics(data map[string]interface{}) string {
 		// Total traffic
 		if total, ok := traffic["total"].(map[string]interface{}); ok {
 			if rx, ok := total["rx"].(float64); ok {
-				metrics.WriteString(fmt.Sprintf("vnstat_traffic_total_bytes{interface=\"%s\",direction=\"rx\"} %.0f\n", interfaceName, rx))
+				metrics.WriteString(fmt.Sprintf("vnstat_traffic_total_bytes{%s,direction=\"rx\"} %.0f\n", labels, rx))
 			}
 			if tx, ok := total["tx"].(float64); ok {
-				metrics.WriteString(fmt.Sprintf("vnstat_traffic_total_bytes{interface=\"%s\",direction=\"tx\"} %.0f\n", interfaceName, tx))
+				metrics.WriteString(fmt.Sprintf("vnstat_traffic_total_bytes{%s,direction=\"tx\"} %.0f\n", labels, tx))
 			}
 		}
 
@@ -315,10 +280,10 @@ func (s *Server) generatePrometheusMetrics(data map[string]interface{}) string {
 		if month, ok := traffic["month"].([]interface{}); ok && len(month) > 0 {
 			if monthData := extractLatestMonthData(month); monthData != nil {
 				if rx, ok := monthData["rx"].(float64); ok {
-					metrics.WriteString(fmt.Sprintf("vnstat_traffic_month_bytes{interface=\"%s\",direction=\"rx\"} %.0f\n", interfaceName, rx))
+					metrics.WriteString(fmt.Sprintf("vnstat_traffic_month_bytes{%s,direction=\"rx\"} %.0f\n", labels, rx))
 				}
 				if tx, ok := monthData["tx"].(float64); ok {
-					metrics.WriteString(fmt.Sprintf("vnstat_traffic_month_bytes{interface=\"%s\",direction=\"tx\"} %.0f\n", interfaceName, tx))
+					metrics.WriteString(fmt.Sprintf("vnstat_traffic_month_bytes{%s,direction=\"tx\"} %.0f\n", labels, tx))
 				}
 			}
 		}
@@ -329,10 +294,10 @@ func (s *Server) generatePrometheusMetrics(data map[string]interface{}) string {
 			dayData, ok := day[len(day)-1].(map[string]interface{})
 			if ok {
 				if rx, ok := dayData["rx"].(float64); ok {
-					metrics.WriteString(fmt.Sprintf("vnstat_traffic_today_bytes{interface=\"%s\",direction=\"rx\"} %.0f\n", interfaceName, rx))
+					metrics.WriteString(fmt.Sprintf("vnstat_traffic_today_bytes{%s,direction=\"rx\"} %.0f\n", labels, rx))
 				}
 				if tx, ok := dayData["tx"].(float64); ok {
-					metrics.WriteString(fmt.Sprintf("vnstat_traffic_today_bytes{interface=\"%s\",direction=\"tx\"} %.0f\n", interfaceName, tx))
+					metrics.WriteString(fmt.Sprintf("vnstat_traffic_today_bytes{%s,direction=\"tx\"} %.0f\n", labels, tx))
 				}
 			}
 		}
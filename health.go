@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of readiness checks
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+	checkSkip = "skip" // Not run because a check it depends on failed, or nothing to check
+)
+
+// readinessCacheTTL is how long a /readyz result is reused, so frequent probes do not each run vnstat
+const readinessCacheTTL = 5 * time.Second
+
+// readinessConfig holds the thresholds of /readyz
+type readinessConfig struct {
+	DataMaxAge time.Duration // Newest interface update must be younger, 0 disables the check
+	PushMaxAge time.Duration // Every push target must have succeeded within, 0 disables the check
+}
+
+// healthCheck is the result of one readiness check
+type healthCheck struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Message    string  `json:"message,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// readinessReport is the body of /readyz
+type readinessReport struct {
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks"`
+}
+
+// readinessCache holds the last readiness report
+type readinessCache struct {
+	mu     sync.Mutex
+	report readinessReport
+	at     time.Time // Zero until the first report
+}
+
+// handleLivez handles /livez endpoint: the process is up and serving requests, nothing else is checked
+// Like /health it does not require token authentication
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ok",
+	})
+}
+
+// handleReadyz handles /readyz endpoint, runs the readiness checks and answers 503 if one fails
+// Does not require token authentication so orchestrators can probe it; without the token the check messages are left out
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := s.cachedReadiness(time.Now())
+	if s.token != "" && !s.checkToken(r) {
+		report = report.summary()
+	}
+
+	status := http.StatusOK
+	if report.Status != checkOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// cachedReadiness returns the last report if it is younger than readinessCacheTTL, otherwise runs the checks
+// The lock is held while the checks run, so concurrent probes wait for one run instead of starting their own
+func (s *Server) cachedReadiness(now time.Time) readinessReport {
+	s.readiness.mu.Lock()
+	defer s.readiness.mu.Unlock()
+
+	hit := !s.readiness.at.IsZero() && now.Sub(s.readiness.at) < readinessCacheTTL
+	selfMetrics.cacheLookup("readiness", hit)
+	if hit {
+		return s.readiness.report
+	}
+	s.readiness.report = s.runReadiness(now)
+	s.readiness.at = now
+	return s.readiness.report
+}
+
+// summary returns the report without check messages, which reveal interface counts, upstream names and push targets
+func (r readinessReport) summary() readinessReport {
+	checks := make([]healthCheck, len(r.Checks))
+	for i, check := range r.Checks {
+		check.Message = ""
+		checks[i] = check
+	}
+	return readinessReport{Status: r.Status, Checks: checks}
+}
+
+// runReadiness runs the checks: the local backend and its data, or the upstreams in aggregator mode, then the pushes
+func (s *Server) runReadiness(now time.Time) readinessReport {
+	var checks []healthCheck
+	if s.aggregator != nil {
+		checks = append(checks, runCheck("upstreams", func() (string, error) {
+			return s.checkUpstreams(now)
+		}))
+	} else {
+		checks = append(checks, s.checkBackend(now)...)
+	}
+	if s.readinessConfig.PushMaxAge > 0 {
+		checks = append(checks, runCheck("push", func() (string, error) {
+			return checkPushes(now, s.readinessConfig.PushMaxAge)
+		}))
+	}
+
+	report := readinessReport{Status: checkOK, Checks: checks}
+	for _, check := range checks {
+		if check.Status == checkFail {
+			report.Status = checkFail
+		}
+	}
+	return report
+}
+
+// skippedCheck is returned by a check that has nothing to check; it is reported as skip with the reason as message
+type skippedCheck string
+
+func (e skippedCheck) Error() string { return string(e) }
+
+// runCheck times a check; it fails with the error's message, or passes with the returned message
+func runCheck(name string, check func() (string, error)) healthCheck {
+	start := time.Now()
+	message, err := check()
+	result := healthCheck{Name: name, Status: checkOK, Message: message}
+	var skipped skippedCheck
+	if errors.As(err, &skipped) {
+		result.Status, result.Message = checkSkip, err.Error()
+	} else if err != nil {
+		result.Status, result.Message = checkFail, err.Error()
+	}
+	result.DurationMS = roundTo(float64(time.Since(start))/float64(time.Millisecond), 2)
+	return result
+}
+
+// checkBackend checks that vnstat (or the collector) answers, that its JSON parses and that the data is recent
+func (s *Server) checkBackend(now time.Time) []healthCheck {
+	var jsonData []byte
+	backend := runCheck("backend", func() (message string, err error) {
+		jsonData, err = s.service.GetJSON()
+		return "", err
+	})
+
+	var data *VnstatData
+	parse := healthCheck{Name: "json", Status: checkSkip, Message: "backend unavailable"}
+	if backend.Status == checkOK {
+		parse = runCheck("json", func() (message string, err error) {
+			if data, err = parseVnstatData(jsonData); err != nil {
+				return "", err
+			}
+			if len(data.Interfaces) == 0 {
+				return "", fmt.Errorf("no interfaces in the data")
+			}
+			return fmt.Sprintf("%d interfaces", len(data.Interfaces)), nil
+		})
+	}
+	checks := []healthCheck{backend, parse}
+
+	if s.readinessConfig.DataMaxAge > 0 {
+		freshness := healthCheck{Name: "freshness", Status: checkSkip, Message: "no parsed data"}
+		if parse.Status == checkOK {
+			freshness = runCheck("freshness", func() (string, error) {
+				return checkDataFreshness(data, now, s.readinessConfig.DataMaxAge)
+			})
+		}
+		checks = append(checks, freshness)
+	}
+	return checks
+}
+
+// checkDataFreshness fails if no interface was updated within maxAge
+// The newest interface counts, an idle or removed interface alone does not make the data stale
+// Interfaces without an update timestamp (older vnstat JSON) are ignored; the check is skipped if none has one
+func checkDataFreshness(data *VnstatData, now time.Time, maxAge time.Duration) (string, error) {
+	var newest int64
+	for _, iface := range data.Interfaces {
+		newest = max(newest, iface.Updated.Timestamp)
+	}
+	if newest == 0 {
+		return "", skippedCheck("no interface has an update timestamp")
+	}
+	age := max(0, now.Sub(time.Unix(newest, 0)).Round(time.Second)) // Clock skew with the vnstat daemon
+	if age > maxAge {
+		return "", fmt.Errorf("last update %v ago, older than %v", age, maxAge)
+	}
+	return fmt.Sprintf("last update %v ago", age), nil
+}
+
+// checkUpstreams fails in aggregator mode if no upstream has fresh data
+func (s *Server) checkUpstreams(now time.Time) (string, error) {
+	fresh, stale := s.aggregator.upstreamFreshness(now)
+	if fresh == 0 {
+		return "", fmt.Errorf("no upstream with fresh data (stale: %s)", strings.Join(stale, ", "))
+	}
+	if len(stale) > 0 {
+		return fmt.Sprintf("%d fresh, stale: %s", fresh, strings.Join(stale, ", ")), nil
+	}
+	return fmt.Sprintf("%d fresh", fresh), nil
+}
+
+// checkPushes fails if a push target that has run did not succeed within maxAge
+func checkPushes(now time.Time, maxAge time.Duration) (string, error) {
+	targets, stale := selfMetrics.stalePushes(now, maxAge)
+	if len(stale) > 0 {
+		return "", fmt.Errorf("no successful push within %v: %s", maxAge, strings.Join(stale, ", "))
+	}
+	if targets == 0 {
+		return "no push targets", nil
+	}
+	return fmt.Sprintf("%d targets healthy", targets), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReadyzDetails(t *testing.T) {
+	s := newTestServer(t)
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		target   string
+		messages bool
+	}{
+		{"/readyz?token=secret", true},
+		{"/readyz", false},
+		{"/readyz?token=wrong", false},
+	} {
+		rec := serve(t, handler, "GET", tt.target)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want 200 (body %s)", tt.target, rec.Code, rec.Body)
+		}
+		var report readinessReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		hasMessages := false
+		for _, check := range report.Checks {
+			hasMessages = hasMessages || check.Message != ""
+		}
+		if hasMessages != tt.messages {
+			t.Errorf("GET %s: check messages shown = %v, want %v", tt.target, hasMessages, tt.messages)
+		}
+	}
+}
+
+func TestReadinessCache(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Now()
+	first := s.cachedReadiness(now)
+	if first.Status != checkOK {
+		t.Fatalf("status = %s, want ok: %+v", first.Status, first.Checks)
+	}
+
+	// Break the backend: the cached report is served until it expires
+	t.Setenv("PATH", t.TempDir())
+	if report := s.cachedReadiness(now.Add(readinessCacheTTL - time.Second)); report.Status != checkOK {
+		t.Errorf("status within the cache TTL = %s, want the cached ok", report.Status)
+	}
+	if report := s.cachedReadiness(now.Add(readinessCacheTTL)); report.Status != checkFail {
+		t.Errorf("status after the cache TTL = %s, want fail", report.Status)
+	}
+}
+
+func TestCheckDataFreshness(t *testing.T) {
+	now := time.Unix(1792420800, 0)
+	withUpdates := func(timestamps ...int64) *VnstatData {
+		data := &VnstatData{}
+		for _, timestamp := range timestamps {
+			iface := InterfaceData{Name: "eth0"}
+			iface.Updated.Timestamp = timestamp
+			data.Interfaces = append(data.Interfaces, iface)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name   string
+		data   *VnstatData
+		status string
+	}{
+		{"fresh", withUpdates(now.Unix() - 60), checkOK},
+		{"stale", withUpdates(now.Unix() - 3600), checkFail},
+		{"newest counts", withUpdates(now.Unix()-3600, now.Unix()-60), checkOK},
+		{"missing timestamp ignored", withUpdates(0, now.Unix()-60), checkOK},
+		{"no timestamps", withUpdates(0, 0), checkSkip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := runCheck("freshness", func() (string, error) {
+				return checkDataFreshness(tt.data, now, 15*time.Minute)
+			})
+			if check.Status != tt.status {
+				t.Errorf("status = %s (%s), want %s", check.Status, check.Message, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// labelNamePattern is the Prometheus label name syntax
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels are set by the metrics themselves and cannot be configured
+var reservedLabels = []string{"interface", "direction", "hostname", "kind", "granularity"}
+
+// labelConfig holds interface aliases, per-interface labels and external labels added to every series
+type labelConfig struct {
+	aliases  map[string]string            // Display name per interface
+	labels   map[string]map[string]string // Extra metric labels per interface
+	external map[string]string            // Labels added to every series
+}
+
+// newLabelConfig parses -interface-alias, -interface-labels and -external-labels values
+func newLabelConfig(aliasSpecs, labelSpecs []string, externalSpec string) (*labelConfig, error) {
+	c := &labelConfig{
+		aliases:  make(map[string]string),
+		labels:   make(map[string]map[string]string),
+		external: make(map[string]string),
+	}
+
+	for _, spec := range aliasSpecs {
+		name, alias, ok := strings.Cut(spec, "=")
+		name, alias = strings.TrimSpace(name), strings.TrimSpace(alias)
+		if !ok || name == "" || alias == "" {
+			return nil, fmt.Errorf("invalid interface alias %q (expected interface=alias)", spec)
+		}
+		c.aliases[name] = alias
+	}
+
+	for _, spec := range labelSpecs {
+		name, pairs, ok := strings.Cut(spec, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid interface labels %q (expected interface:key=value[,key=value...])", spec)
+		}
+		labels, err := parseLabelPairs(pairs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interface labels for %s: %v", name, err)
+		}
+		if c.labels[name] == nil {
+			c.labels[name] = make(map[string]string)
+		}
+		for key, value := range labels {
+			c.labels[name][key] = value
+		}
+	}
+
+	external, err := parseLabelPairs(externalSpec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid external labels: %v", err)
+	}
+	c.external = external
+
+	return c, nil
+}
+
+// parseLabelPairs parses "key=value,key=value" and validates the label names
+func parseLabelPairs(spec string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q (expected key=value)", pair)
+		}
+		if !labelNamePattern.MatchString(key) || strings.HasPrefix(key, "__") {
+			return nil, fmt.Errorf("invalid label name %q", key)
+		}
+		if containsString(reservedLabels, key) {
+			return nil, fmt.Errorf("label name %q is reserved", key)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// Apply sets the configured aliases as the interface alias of the data
+func (c *labelConfig) Apply(data *VnstatData) {
+	if c == nil {
+		return
+	}
+	for i := range data.Interfaces {
+		if alias, ok := c.aliases[data.Interfaces[i].Name]; ok {
+			data.Interfaces[i].Alias = alias
+		}
+	}
+}
+
+// seriesLabels returns the extra labels of an interface merged with the external labels
+// Interface labels win over external labels with the same name
+func (c *labelConfig) seriesLabels(name string) map[string]string {
+	labels := make(map[string]string)
+	if c == nil {
+		return labels
+	}
+	for key, value := range c.external {
+		labels[key] = value
+	}
+	for key, value := range c.labels[name] {
+		labels[key] = value
+	}
+	return labels
+}
+
+// interfaceLabels renders interface="name" followed by the extra and external labels, sorted by name
+func (c *labelConfig) interfaceLabels(name string) string {
+	return fmt.Sprintf("interface=\"%s\"", escapeLabelValue(name)) + formatExtraLabels(c.seriesLabels(name))
+}
+
+// externalLabels renders the external labels as a label set, empty if there are none
+func (c *labelConfig) externalLabels() string {
+	if c == nil || len(c.external) == 0 {
+		return ""
+	}
+	return "{" + strings.TrimPrefix(formatExtraLabels(c.external), ",") + "}"
+}
+
+// formatExtraLabels renders labels as ,key="value" pairs sorted by name
+func formatExtraLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, ",%s=\"%s\"", key, escapeLabelValue(labels[key]))
+	}
+	return b.String()
+}
+
+// interfaceDisplayName returns "alias (name)" like vnstat when an alias is set, otherwise the name
+func interfaceDisplayName(iface *InterfaceData) string {
+	if iface.Alias == "" || iface.Alias == iface.Name {
+		return iface.Name
+	}
+	return fmt.Sprintf("%s (%s)", iface.Alias, iface.Name)
+}
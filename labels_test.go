@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseLabelPairs(t *testing.T) {
+	labels, err := parseLabelPairs(" site = ams ,, env=prod,empty=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 3 || labels["site"] != "ams" || labels["env"] != "prod" || labels["empty"] != "" {
+		t.Errorf("labels = %v", labels)
+	}
+
+	for _, spec := range []string{
+		"interface=eth9", "direction=up", "hostname=spoofed", "kind=x", "granularity=x",
+		"__name__=other", "__meta=x", "1site=ams", "site-name=ams", "site",
+	} {
+		if _, err := parseLabelPairs(spec); err == nil {
+			t.Errorf("parseLabelPairs(%q) accepted", spec)
+		}
+		if _, err := newLabelConfig(nil, []string{"eth0:" + spec}, ""); err == nil {
+			t.Errorf("interface labels %q accepted", spec)
+		}
+		if _, err := newLabelConfig(nil, nil, spec); err == nil {
+			t.Errorf("external labels %q accepted", spec)
+		}
+	}
+}
+
+func TestRemoteWriteLabels(t *testing.T) {
+	labels, err := newLabelConfig(nil, []string{"eth0:site=ams,zone=a"}, "env=prod,region=eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Even labels that slipped past parsing cannot replace the fixed labels
+	labels.labels["eth0"]["interface"] = "eth9"
+	labels.external["hostname"] = "spoofed"
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(testVnstatJSON), &data); err != nil {
+		t.Fatal(err)
+	}
+	request := convertToPrometheusWriteRequest(data, "host1", labels)
+	if request == nil || len(request.Timeseries) == 0 {
+		t.Fatal("no time series")
+	}
+
+	for _, series := range request.Timeseries {
+		values := make(map[string]string)
+		for i, label := range series.Labels {
+			if i > 0 && series.Labels[i-1].Name >= label.Name {
+				t.Errorf("labels not sorted by name: %v", series.Labels)
+			}
+			values[label.Name] = label.Value
+		}
+		if series.Labels[0].Name != "__name__" {
+			t.Errorf("first label %q, want __name__", series.Labels[0].Name)
+		}
+		if values["interface"] != "eth0" || values["hostname"] != "host1" || (values["direction"] != "rx" && values["direction"] != "tx") {
+			t.Errorf("%s: fixed labels %v", values["__name__"], values)
+		}
+		if values["site"] != "ams" || values["zone"] != "a" || values["env"] != "prod" || values["region"] != "eu" {
+			t.Errorf("%s: extra labels %v", values["__name__"], values)
+		}
+	}
+}
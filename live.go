@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// websocketGUID is the fixed GUID from RFC 6455 used to compute Sec-WebSocket-Accept
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// liveCounters holds the kernel counters of one interface at one point in time
+type liveCounters struct {
+	RxBytes   uint64
+	TxBytes   uint64
+	RxPackets uint64
+	TxPackets uint64
+}
+
+// liveRate is the throughput of one interface between two samples
+type liveRate struct {
+	Name            string  `json:"name"`
+	RxBytesPerSec   float64 `json:"rx_bytes_per_sec"`
+	TxBytesPerSec   float64 `json:"tx_bytes_per_sec"`
+	RxPacketsPerSec float64 `json:"rx_packets_per_sec"`
+	TxPacketsPerSec float64 `json:"tx_packets_per_sec"`
+	RxRate          string  `json:"rx_rate"` // Human readable bit rate
+	TxRate          string  `json:"tx_rate"`
+}
+
+// liveSample is one event sent to live clients
+type liveSample struct {
+	Timestamp       int64      `json:"timestamp"`
+	IntervalSeconds float64    `json:"interval_seconds"`
+	Interfaces      []liveRate `json:"interfaces"`
+}
+
+// LiveMonitor samples interface statistics from sysfs for live throughput streaming
+type LiveMonitor struct {
+	root             string        // sysfs network class directory, normally /sys/class/net
+	interval         time.Duration // Sampling interval
+	defaultInterface string        // Interface streamed when the client does not filter (empty for all)
+	exclude          []string      // Glob patterns of interfaces left out when streaming all
+	slots            chan struct{} // Limits concurrent live connections
+}
+
+// NewLiveMonitor creates a new LiveMonitor instance
+func NewLiveMonitor(root string, interval time.Duration, maxConnections int, defaultInterface string, exclude []string) *LiveMonitor {
+	return &LiveMonitor{
+		root:             root,
+		interval:         interval,
+		defaultInterface: defaultInterface,
+		exclude:          exclude,
+		slots:            make(chan struct{}, maxConnections),
+	}
+}
+
+// acquire reserves a connection slot, returning false if the limit is reached
+func (m *LiveMonitor) acquire() bool {
+	select {
+	case m.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a connection slot
+func (m *LiveMonitor) release() {
+	<-m.slots
+}
+
+// resolveInterfaces returns the interfaces to sample for a comma-separated filter
+func (m *LiveMonitor) resolveInterfaces(filter string) ([]string, error) {
+	if filter == "" {
+		filter = m.defaultInterface
+	}
+
+	if filter != "" {
+		var names []string
+		for _, name := range strings.Split(filter, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			// Reject path components so the filter cannot escape the sysfs root
+			if name != filepath.Base(name) || name == "." || name == ".." {
+				return nil, fmt.Errorf("invalid interface name %q", name)
+			}
+			if _, err := os.Stat(filepath.Join(m.root, name, "statistics")); err != nil {
+				return nil, fmt.Errorf("interface %q not found", name)
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	}
+
+	entries, err := os.ReadDir(m.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Name() == "lo" || matchesAny(m.exclude, entry.Name()) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(m.root, entry.Name(), "statistics")); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readCounters reads the byte and packet counters of the given interfaces
+func (m *LiveMonitor) readCounters(names []string) map[string]liveCounters {
+	counters := make(map[string]liveCounters, len(names))
+	for _, name := range names {
+		dir := filepath.Join(m.root, name, "statistics")
+		var c liveCounters
+		var err error
+		if c.RxBytes, err = readSysfsCounter(filepath.Join(dir, "rx_bytes")); err != nil {
+			continue
+		}
+		if c.TxBytes, err = readSysfsCounter(filepath.Join(dir, "tx_bytes")); err != nil {
+			continue
+		}
+		c.RxPackets, _ = readSysfsCounter(filepath.Join(dir, "rx_packets"))
+		c.TxPackets, _ = readSysfsCounter(filepath.Join(dir, "tx_packets"))
+		counters[name] = c
+	}
+	return counters
+}
+
+// readSysfsCounter reads a single numeric sysfs attribute
+func readSysfsCounter(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// stream samples the interfaces every interval and calls emit with the rates until ctx is done or emit fails
+func (m *LiveMonitor) stream(ctx context.Context, names []string, emit func(liveSample) error) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	previous := m.readCounters(names)
+	previousTime := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		current := m.readCounters(names)
+		elapsed := now.Sub(previousTime).Seconds()
+
+		sample := liveSample{
+			Timestamp:       now.Unix(),
+			IntervalSeconds: elapsed,
+			Interfaces:      make([]liveRate, 0, len(names)),
+		}
+		for _, name := range names {
+			cur, ok := current[name]
+			prev, hadPrev := previous[name]
+			if !ok || !hadPrev {
+				continue
+			}
+			rate := liveRate{
+				Name:            name,
+				RxBytesPerSec:   counterRate(prev.RxBytes, cur.RxBytes, elapsed),
+				TxBytesPerSec:   counterRate(prev.TxBytes, cur.TxBytes, elapsed),
+				RxPacketsPerSec: counterRate(prev.RxPackets, cur.RxPackets, elapsed),
+				TxPacketsPerSec: counterRate(prev.TxPackets, cur.TxPackets, elapsed),
+			}
+			rate.RxRate = formatBitRate(rate.RxBytesPerSec * 8)
+			rate.TxRate = formatBitRate(rate.TxBytesPerSec * 8)
+			sample.Interfaces = append(sample.Interfaces, rate)
+		}
+
+		if err := emit(sample); err != nil {
+			return err
+		}
+
+		previous, previousTime = current, now
+	}
+}
+
+// counterRate computes a per-second rate, treating a counter decrease (reset) as no traffic
+func counterRate(previous, current uint64, seconds float64) float64 {
+	if current < previous || seconds <= 0 {
+		return 0
+	}
+	return float64(current-previous) / seconds
+}
+
+// handleLive handles /live endpoint, streams live throughput as Server-Sent Events
+// Query options: interface (comma-separated filter)
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	names, err := s.live.resolveInterfaces(r.URL.Query().Get("interface"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !s.live.acquire() {
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "Too many live connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.live.release()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Tell EventSource clients how long to wait before reconnecting
+	fmt.Fprintf(w, "retry: %d\n\n", s.live.interval.Milliseconds()*2)
+	flusher.Flush()
+
+	err = s.live.stream(r.Context(), names, func(sample liveSample) error {
+		data, err := json.Marshal(sample)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: sample\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		slog.Debug("Live stream ended", "err", err)
+	}
+}
+
+// websocketOriginAllowed reports whether a WebSocket upgrade may proceed: browsers do not apply CORS to WebSockets,
+// so a browser's Origin must be the server itself or allowed by -cors-origins; clients that send no Origin are not browsers
+func (s *Server) websocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return s.cors != nil && s.cors.allowed(origin)
+}
+
+// handleLiveWebSocket handles /live/ws endpoint, streams live throughput over a WebSocket
+// Each sample is sent as a JSON text message; query options match /live
+func (s *Server) handleLiveWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return
+	}
+	if !s.websocketOriginAllowed(r) {
+		http.Error(w, "WebSocket origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	names, err := s.live.resolveInterfaces(r.URL.Query().Get("interface"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !s.live.acquire() {
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "Too many live connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.live.release()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		slog.Error("Live WebSocket: hijack failed", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	// The hijacked connection is no longer tied to the request context, so cancel on client close instead
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan wsFrame, 4)
+	go func() {
+		defer cancel()
+		for {
+			frame, err := readWebSocketFrame(rw.Reader)
+			if err != nil || frame.opcode == wsOpClose {
+				return
+			}
+			select {
+			case frames <- frame:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	samples := make(chan liveSample)
+	go func() {
+		s.live.stream(ctx, names, func(sample liveSample) error {
+			select {
+			case samples <- sample:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			writeWebSocketFrame(conn, wsOpClose, nil)
+			return
+		case frame := <-frames:
+			if frame.opcode == wsOpPing {
+				if err := writeWebSocketFrame(conn, wsOpPong, frame.payload); err != nil {
+					return
+				}
+			}
+		case sample := <-samples:
+			data, err := json.Marshal(sample)
+			if err != nil {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := writeWebSocketFrame(conn, wsOpText, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// WebSocket opcodes used by the live stream
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// maxWebSocketFrame bounds client frames; clients only send control frames to this endpoint
+const maxWebSocketFrame = 64 * 1024
+
+// wsFrame is a decoded WebSocket frame
+type wsFrame struct {
+	opcode  byte
+	payload []byte
+}
+
+// readWebSocketFrame reads and unmasks one client frame
+func readWebSocketFrame(reader *bufio.Reader) (wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return wsFrame{}, err
+	}
+
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(reader, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(reader, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxWebSocketFrame {
+		return wsFrame{}, errors.New("frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(reader, mask[:]); err != nil {
+			return wsFrame{}, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return wsFrame{}, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return wsFrame{opcode: opcode, payload: payload}, nil
+}
+
+// writeWebSocketFrame writes one unmasked, unfragmented server frame
+func writeWebSocketFrame(w io.Writer, opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	frame = append(frame, payload...)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// headerContainsToken reports whether a comma-separated header contains token (case-insensitive)
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebSocketOriginAllowed(t *testing.T) {
+	policy, err := newCORSPolicy("https://dashboard.example.com", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cors   *corsPolicy
+		origin string
+		want   bool
+	}{
+		{"no origin", nil, "", true},
+		{"same origin", nil, "http://vnstat.local:8080", true},
+		{"same origin over https", nil, "https://vnstat.local:8080", true},
+		{"other site without CORS", nil, "https://evil.example", false},
+		{"allowed origin", policy, "https://dashboard.example.com", true},
+		{"other site", policy, "https://evil.example", false},
+		{"other port", policy, "http://vnstat.local:9090", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{cors: tt.cors}
+			r := httptest.NewRequest("GET", "http://vnstat.local:8080/live/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := s.websocketOriginAllowed(r); got != tt.want {
+				t.Errorf("websocketOriginAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
@@ -6,9 +6,10 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/golang/snappy"
@@ -20,6 +21,64 @@ func main() {
 	port := flag.String("port", "8080", "Listening port")
 	token := flag.String("token", "", "Authentication token (leave empty to disable)")
 	interfaceName := flag.String("interface", "", "Network interface name (leave empty to query all)")
+	monthlyQuota := flag.String("monthly-quota", "", "Monthly traffic quota (rx+tx), e.g. 1TB or 500GiB (leave empty to disable)")
+	excludeInterfaces := flag.String("exclude-interfaces", "", "Comma-separated glob patterns of interfaces hidden everywhere, e.g. docker*,veth*,br-*")
+	var groupSpecs stringListFlag
+	flag.Var(&groupSpecs, "interface-group", "Aggregate interface as name=pattern[,pattern...], prefix a pattern with ! to exclude it (repeatable), e.g. public=eth0,eth1")
+	var aliasSpecs, labelSpecs stringListFlag
+	flag.Var(&aliasSpecs, "interface-alias", "Display name of an interface as interface=alias (repeatable), e.g. ens18=Uplink")
+	flag.Var(&labelSpecs, "interface-labels", "Extra metric labels of an interface as interface:key=value[,key=value...] (repeatable), e.g. ens18:provider=hetzner,role=uplink")
+	externalLabels := flag.String("external-labels", "", "Labels added to every metric series as key=value[,key=value...], e.g. region=eu-central,env=prod")
+	billingDay := flag.Int("billing-day", 1, "Day of month (1-28) the billing cycle starts, used by forecasts and the quota")
+	anomalyThreshold := flag.Float64("anomaly-threshold", 3.5, "Robust z-score above which an hour or day is reported by /anomalies and vnstat_anomaly_active")
+	corsOrigins := flag.String("cors-origins", "*", "Comma-separated origins allowed to read responses cross-origin: * (any), https://host[:port] or https://*.host for subdomains (leave empty to disable CORS)")
+	corsHeaders := flag.String("cors-headers", "Content-Type", "Comma-separated request headers allowed in CORS preflights")
+	corsCredentials := flag.Bool("cors-credentials", false, "Allow credentialed CORS requests from the listed origins (not allowed with *)")
+	corsMaxAge := flag.Duration("cors-max-age", 0, "How long browsers may cache CORS preflight responses, e.g. 10m (0 leaves it to the browser)")
+	rateLimitSpec := flag.String("rate-limit", "10/s:20", "Requests per client IP as count/unit[:burst] with unit s, m or h (off to disable)")
+	var rateLimitPaths stringListFlag
+	flag.Var(&rateLimitPaths, "rate-limit-endpoint", "Per-IP limit of an endpoint as /path=limit, a path ending in / covers everything below it (repeatable), e.g. /json=2/s:5 or /health=off")
+	tokenRateLimit := flag.String("rate-limit-token", "off", "Requests made with the token from all IPs together, as count/unit[:burst] (off to disable)")
+	authMaxFailures := flag.Int("auth-max-failures", 10, "Failed token checks after which a client IP is locked out (0 to disable lockouts)")
+	authFailureWindow := flag.Duration("auth-failure-window", 10*time.Minute, "Window in which failed token checks are counted")
+	authLockout := flag.Duration("auth-lockout", 15*time.Minute, "How long a client IP stays locked out")
+	trustedProxySpec := flag.String("trusted-proxies", "", "Comma-separated IPs or CIDR ranges of reverse proxies whose X-Forwarded-For header identifies the client, e.g. 127.0.0.1,10.0.0.0/8")
+	graphqlMaxDepth := flag.Int("graphql-max-depth", 8, "Maximum field nesting depth of /graphql queries")
+	graphqlMaxComplexity := flag.Int("graphql-max-complexity", 10000, "Maximum complexity of /graphql queries (one per field, list fields multiply by their limit)")
+
+	// Logging configuration
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	accessLog := flag.Bool("access-log", false, "Log every HTTP request (method, path, status, duration, bytes, client, token name), 5xx responses are always logged")
+
+	// Self-observability configuration
+	selfMetricsEnabled := flag.Bool("self-metrics", true, "Expose the exporter's own metrics (HTTP requests, vnstat runs, parse errors, pushes, Go runtime and process)")
+	selfMetricsAddr := flag.String("self-metrics-addr", "", "Serve the exporter's own metrics without authentication on this address, e.g. 127.0.0.1:9101, instead of appending them to /metrics")
+
+	// Readiness configuration
+	readyMaxAge := flag.Duration("ready-max-age", 15*time.Minute, "Maximum age of the newest interface update before /readyz fails (0 disables the check)")
+	readyPushMaxAge := flag.Duration("ready-push-max-age", 15*time.Minute, "Maximum time without a successful push (Grafana, Graphite, MQTT) before /readyz fails (0 disables the check)")
+
+	// Live throughput configuration
+	liveInterval := flag.Duration("live-interval", time.Second, "Sampling interval for the /live throughput stream")
+	liveMaxConnections := flag.Int("live-max-connections", 16, "Maximum concurrent /live connections (0 disables /live)")
+	liveSysfsRoot := flag.String("live-sysfs-root", "/sys/class/net", "sysfs network class directory sampled by /live")
+
+	// Live counter metrics configuration
+	liveMetrics := flag.Bool("live-metrics", false, "Export vnstat_live_* counters from /proc/net/dev on /metrics")
+	liveMetricsInterval := flag.Duration("live-metrics-interval", 15*time.Second, "Background sampling interval for live counter metrics")
+	procRoot := flag.String("proc-root", "/proc", "proc filesystem root used by live counter metrics and the built-in collector")
+
+	// Traffic backend configuration
+	backend := flag.String("backend", "vnstat", "Traffic data backend: vnstat (query the vnstat CLI) or collector (built-in collector, no vnstat needed)")
+	collectorDB := flag.String("collector-db", "/var/lib/vnstat-http-server/collector.json", "Database file of the built-in collector")
+	collectorInterval := flag.Duration("collector-interval", 30*time.Second, "Sampling interval of the built-in collector")
+	collectorSaveInterval := flag.Duration("collector-save-interval", 5*time.Minute, "Interval for saving the built-in collector database")
+
+	// History archive configuration
+	archiveDir := flag.String("archive-dir", "", "Directory of the long-term traffic archive (leave empty to disable)")
+	archiveInterval := flag.Duration("archive-interval", 15*time.Minute, "Interval for snapshotting traffic data into the archive")
+	archiveRetention := flag.String("archive-retention", "fiveminute=30d,hour=365d", "Archive retention per granularity as granularity=age (e.g. 30d, 720h, 0 keeps forever); unlisted granularities are kept forever")
 
 	// Grafana Cloud push configuration
 	grafanaURL := flag.String("grafana-url", "", "Grafana Cloud Prometheus remote write URL (e.g., https://YOUR_PROMETHEUS_INSTANCE.grafana.net/api/prom/push)")
@@ -27,60 +86,302 @@ func main() {
 	grafanaToken := flag.String("grafana-token", "", "Grafana Cloud API token")
 	grafanaInterval := flag.Duration("grafana-interval", 30*time.Second, "Interval for pushing metrics to Grafana Cloud")
 
+	// Graphite / StatsD export configuration
+	graphiteAddr := flag.String("graphite-addr", "", "Graphite or StatsD server address host:port (leave empty to disable)")
+	graphiteProtocol := flag.String("graphite-protocol", "graphite", "Export protocol: graphite (plaintext over TCP) or statsd (gauges over UDP)")
+	graphitePrefix := flag.String("graphite-prefix", "vnstat.{hostname}.{interface}", "Metric prefix template, supports {hostname} and {interface}")
+	graphiteInterval := flag.Duration("graphite-interval", 60*time.Second, "Interval for exporting metrics to Graphite/StatsD")
+
+	// MQTT / Home Assistant configuration
+	mqttBroker := flag.String("mqtt-broker", "", "MQTT broker URL, e.g. tcp://localhost:1883 or ssl://broker:8883 (leave empty to disable)")
+	mqttUser := flag.String("mqtt-user", "", "MQTT username")
+	mqttPassword := flag.String("mqtt-password", "", "MQTT password")
+	mqttClientID := flag.String("mqtt-client-id", "", "MQTT client ID (default: vnstat-http-server-<hostname>)")
+	mqttTopic := flag.String("mqtt-topic", "vnstat/{hostname}/{interface}", "MQTT state topic template, supports {hostname} and {interface}")
+	mqttAvailabilityTopic := flag.String("mqtt-availability-topic", "vnstat/{hostname}/availability", "MQTT availability (last will) topic template, supports {hostname}")
+	mqttDiscoveryPrefix := flag.String("mqtt-discovery-prefix", "homeassistant", "Home Assistant MQTT discovery prefix (leave empty to disable discovery)")
+	mqttCAFile := flag.String("mqtt-ca-file", "", "CA certificate file for MQTT TLS connections")
+	mqttTLSInsecure := flag.Bool("mqtt-tls-insecure", false, "Skip MQTT TLS certificate verification")
+	mqttInterval := flag.Duration("mqtt-interval", 60*time.Second, "Interval for publishing metrics to MQTT")
+
+	// Aggregator mode configuration
+	var upstreamSpecs stringListFlag
+	flag.Var(&upstreamSpecs, "upstream", "Upstream vnstat-http-server as [name=]URL, token via ?token= (repeatable, enables aggregator mode)")
+	upstreamsFile := flag.String("upstreams-file", "", "File listing upstreams, one [name=]URL per line (enables aggregator mode)")
+	aggregateInterval := flag.Duration("aggregate-interval", 60*time.Second, "Interval for polling upstreams in aggregator mode")
+	aggregateStale := flag.Duration("aggregate-stale", 0, "Age after which upstream data is reported stale (default: 3x aggregate-interval)")
+
 	flag.Parse()
 
+	// Set up logging first so every later message is structured and redacted
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel, newRedactor(*token, *grafanaToken, *mqttPassword))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	upstreams, err := loadUpstreams(upstreamSpecs, *upstreamsFile)
+	if err != nil {
+		fatal("Invalid aggregator configuration", "err", err)
+	}
+
+	if *billingDay < 1 || *billingDay > 28 {
+		fatal("Invalid -billing-day: must be between 1 and 28", "billing_day", *billingDay)
+	}
+
+	if *anomalyThreshold <= 0 {
+		fatal("Invalid -anomaly-threshold: must be positive", "anomaly_threshold", *anomalyThreshold)
+	}
+
+	if *collectorInterval <= 0 || *collectorSaveInterval <= 0 {
+		fatal("Invalid collector intervals: -collector-interval and -collector-save-interval must be positive", "collector_interval", *collectorInterval, "collector_save_interval", *collectorSaveInterval)
+	}
+
+	if *liveInterval <= 0 {
+		fatal("Invalid -live-interval: must be positive", "live_interval", *liveInterval)
+	}
+
+	if *liveMetricsInterval <= 0 {
+		fatal("Invalid -live-metrics-interval: must be positive", "live_metrics_interval", *liveMetricsInterval)
+	}
+
+	if *graphiteInterval <= 0 {
+		fatal("Invalid -graphite-interval: must be positive", "graphite_interval", *graphiteInterval)
+	}
+
+	if *mqttInterval <= 0 {
+		fatal("Invalid -mqtt-interval: must be positive", "mqtt_interval", *mqttInterval)
+	}
+
+	if *aggregateInterval <= 0 {
+		fatal("Invalid -aggregate-interval: must be positive", "aggregate_interval", *aggregateInterval)
+	}
+
+	if *archiveInterval <= 0 {
+		fatal("Invalid -archive-interval: must be positive", "archive_interval", *archiveInterval)
+	}
+
+	cors, err := newCORSPolicy(*corsOrigins, *corsHeaders, *corsCredentials, *corsMaxAge)
+	if err != nil {
+		fatal("Invalid CORS configuration", "err", err)
+	}
+
+	limiter, err := newRateLimiter(rateLimiterConfig{
+		Limit:         *rateLimitSpec,
+		PathLimits:    rateLimitPaths,
+		TokenLimit:    *tokenRateLimit,
+		MaxFailures:   *authMaxFailures,
+		FailureWindow: *authFailureWindow,
+		Lockout:       *authLockout,
+	})
+	if err != nil {
+		fatal("Invalid rate limit configuration", "err", err)
+	}
+	trustedProxies, err := parseTrustedProxies(*trustedProxySpec)
+	if err != nil {
+		fatal("Invalid -trusted-proxies", "err", err)
+	}
+	if *token != "" && *authMaxFailures > 0 && len(trustedProxies) == 0 {
+		slog.Warn("Authentication lockouts are enabled without -trusted-proxies: behind a reverse proxy all clients share its address, so one client with a wrong token locks out everyone. Set -trusted-proxies or -auth-max-failures 0", "auth_max_failures", *authMaxFailures)
+	}
+
+	if *graphqlMaxDepth < 1 || *graphqlMaxComplexity < 1 {
+		fatal("Invalid GraphQL limits: -graphql-max-depth and -graphql-max-complexity must be positive")
+	}
+
+	var quotaBytes float64
+	if *monthlyQuota != "" {
+		if quotaBytes, err = parseByteSize(*monthlyQuota); err != nil {
+			fatal("Invalid -monthly-quota", "err", err)
+		}
+	}
+
+	excludePatterns, err := parseGlobList(*excludeInterfaces)
+	if err != nil {
+		fatal("Invalid -exclude-interfaces", "err", err)
+	}
+	var groups []InterfaceGroup
+	for _, spec := range groupSpecs {
+		group, err := parseInterfaceGroup(spec)
+		if err != nil {
+			fatal("Invalid -interface-group", "err", err)
+		}
+		groups = append(groups, group)
+	}
+	if len(groups) > 0 && *interfaceName != "" {
+		slog.Warn("-interface limits data to one interface, interface groups only see that interface", "interface", *interfaceName)
+	}
+
 	// Create VnstatService instance
 	service := NewVnstatService(*interfaceName)
+	labels, err := newLabelConfig(aliasSpecs, labelSpecs, *externalLabels)
+	if err != nil {
+		fatal("Invalid label configuration", "err", err)
+	}
+	if len(aliasSpecs) > 0 || len(labelSpecs) > 0 || len(labels.external) > 0 {
+		service.SetLabelConfig(labels)
+	}
+	if len(excludePatterns) > 0 || len(groups) > 0 {
+		service.SetInterfaceGrouping(NewInterfaceGrouping(excludePatterns, groups))
+		slog.Info("Interfaces", "groups", len(groups), "excluded", excludePatterns)
+	}
 
-	// Check if vnstat is installed before starting
-	if err := service.CheckVnstatInstalled(); err != nil {
-		log.Fatalf("Failed to start: %v\nPlease ensure vnstat is installed", err)
+	switch *backend {
+	case "vnstat":
+	case "collector":
+		collector, err := NewCollector(*procRoot, *collectorDB, excludePatterns)
+		if err != nil {
+			fatal("Failed to start collector", "err", err)
+		}
+		service.UseCollector(collector)
+		go collector.Start(*collectorInterval, *collectorSaveInterval)
+		saveCollectorOnExit(collector)
+		slog.Info("Backend: built-in collector", "source", *procRoot+"/net/dev", "interval", *collectorInterval, "database", *collectorDB)
+	default:
+		fatal("Invalid -backend: must be vnstat or collector", "backend", *backend)
+	}
+
+	// Check if vnstat is installed before starting (optional in aggregator mode, not needed by the collector)
+	if *backend == "vnstat" {
+		if err := service.CheckVnstatInstalled(); err != nil {
+			if len(upstreams) == 0 {
+				fatal("Failed to start: please ensure vnstat is installed or use -backend collector", "err", err)
+			}
+			slog.Warn("vnstat unavailable, local endpoints will return errors (aggregator mode only)", "err", err)
+		}
+	}
+
+	// Enable the long-term archive if configured
+	if *archiveDir != "" {
+		retention, err := parseArchiveRetention(*archiveRetention)
+		if err != nil {
+			fatal("Invalid -archive-retention", "err", err)
+		}
+		archive, err := NewArchive(*archiveDir, retention)
+		if err != nil {
+			fatal("Failed to open archive", "err", err)
+		}
+		service.EnableArchive(archive, *archiveInterval)
+		slog.Info("Archive: enabled", "dir", *archiveDir, "interval", *archiveInterval, "retention", *archiveRetention)
+	}
+
+	// Enable live counter metrics if requested
+	if *liveMetrics {
+		if err := service.EnableNetDevSampler(*procRoot, *liveMetricsInterval); err != nil {
+			fatal("Failed to enable live metrics", "err", err)
+		}
+		slog.Info("Live metrics: enabled", "source", *procRoot+"/net/dev", "interval", *liveMetricsInterval)
 	}
 
 	// Create Server instance
 	server := NewServer(*token, service)
+	server.monthlyQuota = quotaBytes
+	server.billingDay = *billingDay
+	server.anomalyThreshold = *anomalyThreshold
+	server.accessLog = *accessLog
+	server.readinessConfig = readinessConfig{DataMaxAge: *readyMaxAge, PushMaxAge: *readyPushMaxAge}
+	server.exposeSelfMetrics = *selfMetricsEnabled && *selfMetricsAddr == ""
+	server.cors = cors
+	server.limiter = limiter
+	server.trustedProxies = trustedProxies
+	server.graphqlLimits = graphqlLimits{MaxDepth: *graphqlMaxDepth, MaxComplexity: *graphqlMaxComplexity}
+	if server.graphql, err = newTrafficGraphQLSchema(); err != nil {
+		fatal("Invalid GraphQL schema", "err", err)
+	}
+	if *liveMaxConnections > 0 {
+		server.live = NewLiveMonitor(*liveSysfsRoot, *liveInterval, *liveMaxConnections, *interfaceName, excludePatterns)
+	}
+
+	// Enable aggregator mode if upstreams are configured
+	if len(upstreams) > 0 {
+		staleAfter := *aggregateStale
+		if staleAfter <= 0 {
+			staleAfter = 3 * *aggregateInterval
+		}
+		server.aggregator = NewAggregator(upstreams, *aggregateInterval, staleAfter)
+	}
 
-	// Register routes (specific paths must be registered before generic paths)
-	http.HandleFunc("/health", server.handleHealth)
-	http.HandleFunc("/metrics", server.handleMetrics)
-	http.HandleFunc("/json", server.handleJSON)
-	http.HandleFunc("/summary", server.handleSummary)
-	http.HandleFunc("/daily", server.handleDaily)
-	http.HandleFunc("/hourly", server.handleHourly)
-	http.HandleFunc("/weekly", server.handleWeekly)
-	http.HandleFunc("/yearly", server.handleYearly)
-	http.HandleFunc("/top", server.handleTop)
-	http.HandleFunc("/oneline", server.handleOneline)
-	http.HandleFunc("/", server.handleText) // Default monthly view
+	// Every endpoint is served by a dedicated mux behind the shared middleware
+	handler, err := server.routes()
+	if err != nil {
+		fatal("Failed to set up routes", "err", err)
+	}
 
 	// Print startup information
 	addr := fmt.Sprintf(":%s", *port)
-	log.Printf("vnstat-http-server started successfully")
-	log.Printf("Listening on: http://0.0.0.0%s", addr)
+	slog.Info("vnstat-http-server started successfully")
+	slog.Info("Listening", "url", "http://0.0.0.0"+addr)
 	if *token != "" {
-		log.Printf("Token authentication: enabled")
-		log.Printf("Example: http://localhost%s/json?token=%s", addr, *token)
+		slog.Info("Token authentication: enabled, pass the token as ?token= query parameter", "example", "http://localhost"+addr+"/json")
 	} else {
-		log.Printf("Token authentication: disabled (recommended to enable in production)")
-		log.Printf("Example: http://localhost%s/json", addr)
+		slog.Warn("Token authentication: disabled (recommended to enable in production)", "example", "http://localhost"+addr+"/json")
 	}
-	log.Printf("Health check: http://localhost%s/health", addr)
-	log.Printf("Available endpoints: /json, /metrics, /summary, /daily, /hourly, /weekly, /monthly(/), /yearly, /top, /oneline")
+	slog.Info("Health check", "url", "http://localhost"+addr+"/health", "liveness", "/livez", "readiness", "/readyz")
+	slog.Info("Dashboard", "url", "http://localhost"+addr+"/ui")
+	slog.Info("Available endpoints", "endpoints", "/json, /metrics, /summary, /summary.json, /daily, /hourly, /weekly, /, /monthly, /yearly, /top, /oneline, /live, /ui, /chart/{hourly,daily,monthly}.{svg,png}, /export.{csv,tsv}, /anomalies, /graphql, /api/v1/{interfaces,compare,openapi.json}")
 
 	// Start Grafana Cloud push if configured (after server info, before server starts)
 	if *grafanaURL != "" && *grafanaUser != "" && *grafanaToken != "" {
 		go startGrafanaPush(*port, *token, *grafanaURL, *grafanaUser, *grafanaToken, *grafanaInterval, service)
-		log.Printf("Grafana Cloud push: enabled (interval: %v)", *grafanaInterval)
+		slog.Info("Grafana Cloud push: enabled", "interval", *grafanaInterval)
 	} else if *grafanaURL != "" || *grafanaUser != "" || *grafanaToken != "" {
-		log.Printf("Warning: Grafana Cloud push partially configured, disabled. All of -grafana-url, -grafana-user, and -grafana-token must be set.")
+		slog.Warn("Grafana Cloud push partially configured, disabled. All of -grafana-url, -grafana-user, and -grafana-token must be set.")
 	}
 
-	log.Printf("Press Ctrl+C to stop")
+	// Start Graphite/StatsD export if configured
+	if *graphiteAddr != "" {
+		exporter, err := NewGraphiteExporter(*graphiteAddr, *graphiteProtocol, *graphitePrefix, service)
+		if err != nil {
+			fatal("Invalid Graphite export configuration", "err", err)
+		}
+		go exporter.Start(*port, *graphiteInterval)
+		slog.Info("Graphite export: enabled", "protocol", *graphiteProtocol, "addr", *graphiteAddr, "interval", *graphiteInterval)
+	}
+
+	// Start MQTT publishing if configured
+	if *mqttBroker != "" {
+		publisher, err := NewMQTTPublisher(MQTTConfig{
+			Broker:            *mqttBroker,
+			Username:          *mqttUser,
+			Password:          *mqttPassword,
+			ClientID:          *mqttClientID,
+			Topic:             *mqttTopic,
+			AvailabilityTopic: *mqttAvailabilityTopic,
+			DiscoveryPrefix:   *mqttDiscoveryPrefix,
+			CAFile:            *mqttCAFile,
+			TLSInsecure:       *mqttTLSInsecure,
+		}, service)
+		if err != nil {
+			fatal("Invalid MQTT configuration", "err", err)
+		}
+		go publisher.Start(*port, *mqttInterval)
+		slog.Info("MQTT publish: enabled", "broker", *mqttBroker, "interval", *mqttInterval)
+	}
+
+	// Start polling upstreams in aggregator mode
+	if server.aggregator != nil {
+		go server.aggregator.Start(*port)
+		slog.Info("Aggregator mode: enabled, endpoints: /fleet, /fleet/json, /metrics", "upstreams", len(upstreams), "interval", *aggregateInterval)
+	}
+
+	// Serve self-metrics on their own listener if configured
+	if *selfMetricsEnabled && *selfMetricsAddr != "" {
+		selfMux := http.NewServeMux()
+		selfMux.HandleFunc("/metrics", handleSelfMetrics)
+		go func() {
+			if err := http.ListenAndServe(*selfMetricsAddr, selfMux); err != nil {
+				fatal("Self-metrics server failed to start", "addr", *selfMetricsAddr, "err", err)
+			}
+		}()
+		slog.Info("Self-metrics: enabled", "url", "http://"+*selfMetricsAddr+"/metrics")
+	}
+
+	slog.Info("Press Ctrl+C to stop")
 
 	// Start HTTP server
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
-		os.Exit(1)
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		fatal("Server failed to start", "err", err)
 	}
 }
 
@@ -88,12 +389,26 @@ func main() {
 func startGrafanaPush(port, token, grafanaURL, grafanaUser, grafanaToken string, interval time.Duration, service *VnstatService) {
 	client := &http.Client{Timeout: 10 * time.Second}
 
-	// Wait for HTTP server to be ready before first push
+	// Track if first push succeeded (for initial success log)
+	firstPush := true
+
+	startPeriodicTask("Grafana push", port, interval, func() {
+		pushMetrics(client, grafanaURL, grafanaUser, grafanaToken, service, &firstPush)
+	})
+}
+
+// startPeriodicTask waits for the HTTP server to be ready, runs task immediately and then on every interval
+// It is shared by all periodic exporters so they follow the same startup and scheduling behavior
+func startPeriodicTask(name, port string, interval time.Duration, task func()) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	// Wait for HTTP server to be ready before first run
 	time.Sleep(2 * time.Second)
 
 	// Retry logic for initial connection
 	maxRetries := 5
-	healthURL := fmt.Sprintf("http://localhost:%s/health", port)
+	// Liveness only: /readyz also checks the pushes started here
+	healthURL := fmt.Sprintf("http://localhost:%s/livez", port)
 	for i := 0; i < maxRetries; i++ {
 		resp, err := client.Get(healthURL)
 		if err == nil {
@@ -103,39 +418,39 @@ func startGrafanaPush(port, token, grafanaURL, grafanaUser, grafanaToken string,
 		if i < maxRetries-1 {
 			time.Sleep(1 * time.Second)
 		} else {
-			log.Printf("Grafana push: HTTP server not ready after %d retries, will retry on next interval", maxRetries)
+			slog.Warn(name+": HTTP server not ready, will retry on next interval", "retries", maxRetries)
 		}
 	}
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	// Track if first push succeeded (for initial success log)
-	firstPush := true
-
-	// Push immediately after server is ready
-	pushMetrics(client, grafanaURL, grafanaUser, grafanaToken, service, &firstPush)
+	// Run immediately after server is ready
+	task()
 
-	// Push periodically
+	// Run periodically
 	for range ticker.C {
-		pushMetrics(client, grafanaURL, grafanaUser, grafanaToken, service, &firstPush)
+		task()
 	}
 }
 
 // pushMetrics fetches metrics and pushes them to Grafana Cloud in Protobuf format
 // firstPush is used to log the first successful push, then silence subsequent success logs
 func pushMetrics(client *http.Client, grafanaURL, grafanaUser, grafanaToken string, service *VnstatService, firstPush *bool) {
+	start, succeeded := time.Now(), false
+	defer func() { selfMetrics.observePush("grafana", start, succeeded) }()
+
 	// Get JSON data directly from service
 	jsonData, err := service.GetJSON()
 	if err != nil {
-		log.Printf("Grafana push: failed to get JSON data: %v", err)
+		slog.Error("Grafana push: failed to get JSON data", "err", err)
 		return
 	}
 
 	// Parse JSON and convert to Protobuf
 	var vnstatData map[string]interface{}
 	if err := json.Unmarshal(jsonData, &vnstatData); err != nil {
-		log.Printf("Grafana push: failed to parse JSON data: %v", err)
+		slog.Error("Grafana push: failed to parse JSON data", "err", err)
 		return
 	}
 
@@ -143,20 +458,20 @@ func pushMetrics(client *http.Client, grafanaURL, grafanaUser, grafanaToken stri
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "unknown"
-		log.Printf("Grafana push: failed to get hostname, using 'unknown': %v", err)
+		slog.Warn("Grafana push: failed to get hostname, using 'unknown'", "err", err)
 	}
 
 	// Convert to Prometheus Remote Write Protobuf format
-	writeRequest := convertToPrometheusWriteRequest(vnstatData, hostname)
+	writeRequest := convertToPrometheusWriteRequest(vnstatData, hostname, service.labels)
 	if writeRequest == nil {
-		log.Printf("Grafana push: failed to convert metrics to Protobuf format")
+		slog.Error("Grafana push: failed to convert metrics to Protobuf format")
 		return
 	}
 
 	// Marshal to Protobuf (prompb uses gogo/protobuf, has its own Marshal method)
 	protoData, err := writeRequest.Marshal()
 	if err != nil {
-		log.Printf("Grafana push: failed to marshal Protobuf: %v", err)
+		slog.Error("Grafana push: failed to marshal Protobuf", "err", err)
 		return
 	}
 
@@ -166,7 +481,7 @@ func pushMetrics(client *http.Client, grafanaURL, grafanaUser, grafanaToken stri
 	// Push to Grafana Cloud
 	req, err := http.NewRequest("POST", grafanaURL, bytes.NewReader(compressed))
 	if err != nil {
-		log.Printf("Grafana push: failed to create request: %v", err)
+		slog.Error("Grafana push: failed to create request", "err", err)
 		return
 	}
 
@@ -180,25 +495,29 @@ func pushMetrics(client *http.Client, grafanaURL, grafanaUser, grafanaToken stri
 
 	pushResp, err := client.Do(req)
 	if err != nil {
-		log.Printf("Grafana push: failed to push metrics: %v", err)
+		slog.Error("Grafana push: failed to push metrics", "err", err)
 		return
 	}
 	defer pushResp.Body.Close()
 
 	// Log first successful push, then only log failures to avoid log spam
 	if pushResp.StatusCode == http.StatusNoContent || pushResp.StatusCode == http.StatusOK {
+		succeeded = true
 		if *firstPush {
-			log.Printf("Grafana push: metrics pushed successfully (subsequent successful pushes will be silent)")
+			slog.Info("Grafana push: metrics pushed successfully (subsequent successful pushes are logged at debug level)")
 			*firstPush = false
+		} else {
+			slog.Debug("Grafana push: metrics pushed successfully")
 		}
 	} else {
 		body, _ := io.ReadAll(pushResp.Body)
-		log.Printf("Grafana push: failed (status: %d, response: %s)", pushResp.StatusCode, string(body))
+		slog.Error("Grafana push: failed", "status", pushResp.StatusCode, "response", string(body))
 	}
 }
 
 // convertToPrometheusWriteRequest converts vnstat JSON data to Prometheus Remote Write Protobuf format
-func convertToPrometheusWriteRequest(data map[string]interface{}, hostname string) *prompb.WriteRequest {
+// Every series carries the hostname, the configured interface labels and the external labels
+func convertToPrometheusWriteRequest(data map[string]interface{}, hostname string, labels *labelConfig) *prompb.WriteRequest {
 	now := time.Now().UnixMilli()
 	var timeseries []*prompb.TimeSeries
 
@@ -219,12 +538,26 @@ func convertToPrometheusWriteRequest(data map[string]interface{}, hostname strin
 			continue
 		}
 
+		// seriesLabels returns the labels of one series of this interface
+		extra := labels.seriesLabels(interfaceName)
+		// The fixed labels are set last so that extra labels can never replace them
+		seriesLabels := func(direction string) map[string]string {
+			series := make(map[string]string, len(extra)+3)
+			for key, value := range extra {
+				series[key] = value
+			}
+			series["hostname"] = hostname
+			series["interface"] = interfaceName
+			series["direction"] = direction
+			return series
+		}
+
 		// Total traffic
 		if total, ok := traffic["total"].(map[string]interface{}); ok {
 			if rx, ok := total["rx"].(float64); ok {
 				timeseries = append(timeseries, createTimeSeries(
 					"vnstat_traffic_total_bytes",
-					map[string]string{"hostname": hostname, "interface": interfaceName, "direction": "rx"},
+					seriesLabels("rx"),
 					rx,
 					now,
 				))
@@ -232,7 +565,7 @@ func convertToPrometheusWriteRequest(data map[string]interface{}, hostname strin
 			if tx, ok := total["tx"].(float64); ok {
 				timeseries = append(timeseries, createTimeSeries(
 					"vnstat_traffic_total_bytes",
-					map[string]string{"hostname": hostname, "interface": interfaceName, "direction": "tx"},
+					seriesLabels("tx"),
 					tx,
 					now,
 				))
@@ -245,7 +578,7 @@ func convertToPrometheusWriteRequest(data map[string]interface{}, hostname strin
 				if rx, ok := monthData["rx"].(float64); ok {
 					timeseries = append(timeseries, createTimeSeries(
 						"vnstat_traffic_month_bytes",
-						map[string]string{"hostname": hostname, "interface": interfaceName, "direction": "rx"},
+						seriesLabels("rx"),
 						rx,
 						now,
 					))
@@ -253,7 +586,7 @@ func convertToPrometheusWriteRequest(data map[string]interface{}, hostname strin
 				if tx, ok := monthData["tx"].(float64); ok {
 					timeseries = append(timeseries, createTimeSeries(
 						"vnstat_traffic_month_bytes",
-						map[string]string{"hostname": hostname, "interface": interfaceName, "direction": "tx"},
+						seriesLabels("tx"),
 						tx,
 						now,
 					))
@@ -268,7 +601,7 @@ func convertToPrometheusWriteRequest(data map[string]interface{}, hostname strin
 				if rx, ok := dayData["rx"].(float64); ok {
 					timeseries = append(timeseries, createTimeSeries(
 						"vnstat_traffic_today_bytes",
-						map[string]string{"hostname": hostname, "interface": interfaceName, "direction": "rx"},
+						seriesLabels("rx"),
 						rx,
 						now,
 					))
@@ -276,7 +609,7 @@ func convertToPrometheusWriteRequest(data map[string]interface{}, hostname strin
 				if tx, ok := dayData["tx"].(float64); ok {
 					timeseries = append(timeseries, createTimeSeries(
 						"vnstat_traffic_today_bytes",
-						map[string]string{"hostname": hostname, "interface": interfaceName, "direction": "tx"},
+						seriesLabels("tx"),
 						tx,
 						now,
 					))
@@ -309,6 +642,9 @@ func createTimeSeries(metricName string, labels map[string]string, value float64
 		})
 	}
 
+	// Remote write receivers expect the labels of a series sorted by name
+	sort.Slice(promLabels, func(i, j int) bool { return promLabels[i].Name < promLabels[j].Name })
+
 	// Create sample (prompb.Sample is a value type, not pointer)
 	sample := prompb.Sample{
 		Value:     value,
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// VnstatData is the typed form of vnstat --json output (jsonversion 2)
+type VnstatData struct {
+	VnstatVersion string          `json:"vnstatversion"`
+	JSONVersion   string          `json:"jsonversion"`
+	Interfaces    []InterfaceData `json:"interfaces"`
+}
+
+// InterfaceData is one interface in vnstat JSON
+type InterfaceData struct {
+	Name    string      `json:"name"`
+	Alias   string      `json:"alias"`
+	Created EntryStamp  `json:"created"`
+	Updated EntryStamp  `json:"updated"`
+	Traffic TrafficData `json:"traffic"`
+}
+
+// EntryStamp is a point in time as vnstat encodes it (date, optional time, unix timestamp)
+type EntryStamp struct {
+	Date      EntryDate  `json:"date"`
+	Time      *EntryTime `json:"time,omitempty"`
+	Timestamp int64      `json:"timestamp"`
+}
+
+// TrafficData holds the total and per-granularity traffic of an interface
+type TrafficData struct {
+	Total      TrafficTotal   `json:"total"`
+	FiveMinute []TrafficEntry `json:"fiveminute"`
+	Hour       []TrafficEntry `json:"hour"`
+	Day        []TrafficEntry `json:"day"`
+	Month      []TrafficEntry `json:"month"`
+	Year       []TrafficEntry `json:"year"`
+	Top        []TrafficEntry `json:"top"`
+}
+
+// TrafficTotal is the all-time traffic of an interface
+type TrafficTotal struct {
+	Rx uint64 `json:"rx"`
+	Tx uint64 `json:"tx"`
+}
+
+// TrafficEntry is the traffic of one period
+type TrafficEntry struct {
+	ID        int64      `json:"id"`
+	Date      EntryDate  `json:"date"`
+	Time      *EntryTime `json:"time,omitempty"`
+	Timestamp int64      `json:"timestamp"`
+	Rx        uint64     `json:"rx"`
+	Tx        uint64     `json:"tx"`
+}
+
+// EntryDate is a calendar date; month and day are omitted for yearly (and day for monthly) entries
+type EntryDate struct {
+	Year  int `json:"year"`
+	Month int `json:"month,omitempty"`
+	Day   int `json:"day,omitempty"`
+}
+
+// EntryTime is a time of day
+type EntryTime struct {
+	Hour   int `json:"hour"`
+	Minute int `json:"minute"`
+}
+
+// parseVnstatData parses vnstat JSON output into the typed model
+func parseVnstatData(jsonData []byte) (*VnstatData, error) {
+	var data VnstatData
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		selfMetrics.parseError("model")
+		return nil, fmt.Errorf("failed to parse vnstat JSON: %v", err)
+	}
+	return &data, nil
+}
+
+// decodeInterfaces decodes vnstat JSON from r and calls each with every interface as soon as it is decoded,
+// so only one interface is held in memory at a time
+func decodeInterfaces(r io.Reader, each func(*InterfaceData) error) error {
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if key != "interfaces" {
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return err
+		}
+		for decoder.More() {
+			var iface InterfaceData
+			if err := decoder.Decode(&iface); err != nil {
+				return err
+			}
+			if err := each(&iface); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, '}')
+}
+
+// expectDelim reads the next token and checks that it is the delimiter want
+func expectDelim(decoder *json.Decoder, want json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != want {
+		return fmt.Errorf("expected %v, found %v", want, token)
+	}
+	return nil
+}
+
+// Interface returns the interface with the given name, or nil if it does not exist
+func (d *VnstatData) Interface(name string) *InterfaceData {
+	for i := range d.Interfaces {
+		if d.Interfaces[i].Name == name {
+			return &d.Interfaces[i]
+		}
+	}
+	return nil
+}
+
+// Total returns rx + tx of an entry
+func (e TrafficEntry) Total() uint64 {
+	return e.Rx + e.Tx
+}
+
+// Start returns the start of the period in local time
+func (e TrafficEntry) Start() time.Time {
+	if e.Timestamp > 0 {
+		return time.Unix(e.Timestamp, 0)
+	}
+	month, day := e.Date.Month, e.Date.Day
+	if month == 0 {
+		month = 1
+	}
+	if day == 0 {
+		day = 1
+	}
+	hour, minute := 0, 0
+	if e.Time != nil {
+		hour, minute = e.Time.Hour, e.Time.Minute
+	}
+	return time.Date(e.Date.Year, time.Month(month), day, hour, minute, 0, 0, time.Local)
+}
+
+// trafficGranularities lists the entry granularities of vnstat JSON, finest first
+var trafficGranularities = []string{"fiveminute", "hour", "day", "month", "year"}
+
+// Entries returns the entries of a granularity ("fiveminute", "hour", "day", "month" or "year")
+func (t TrafficData) Entries(granularity string) ([]TrafficEntry, bool) {
+	switch granularity {
+	case "fiveminute":
+		return t.FiveMinute, true
+	case "hour":
+		return t.Hour, true
+	case "day":
+		return t.Day, true
+	case "month":
+		return t.Month, true
+	case "year":
+		return t.Year, true
+	}
+	return nil, false
+}
+
+// setEntries replaces the entries of a granularity
+func (t *TrafficData) setEntries(granularity string, entries []TrafficEntry) {
+	switch granularity {
+	case "fiveminute":
+		t.FiveMinute = entries
+	case "hour":
+		t.Hour = entries
+	case "day":
+		t.Day = entries
+	case "month":
+		t.Month = entries
+	case "year":
+		t.Year = entries
+	}
+}
+
+// periodEnd returns the exclusive end of the period of the given granularity starting at start
+func periodEnd(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case "fiveminute":
+		return start.Add(5 * time.Minute)
+	case "hour":
+		return start.Add(time.Hour)
+	case "day":
+		return start.AddDate(0, 0, 1)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(1, 0, 0)
+	}
+}
+
+// LatestMonth returns the most recent monthly entry, or nil if there is none
+func (t TrafficData) LatestMonth() *TrafficEntry {
+	var latest *TrafficEntry
+	for i := range t.Month {
+		entry := &t.Month[i]
+		if latest == nil || entry.Date.Year*100+entry.Date.Month > latest.Date.Year*100+latest.Date.Month {
+			latest = entry
+		}
+	}
+	return latest
+}
+
+// Today returns the last daily entry (vnstat lists the current day last), or nil if there is none
+func (t TrafficData) Today() *TrafficEntry {
+	if len(t.Day) == 0 {
+		return nil
+	}
+	return &t.Day[len(t.Day)-1]
+}
+
+// String formats the date as YYYY-MM-DD, YYYY-MM or YYYY depending on precision
+func (d EntryDate) String() string {
+	switch {
+	case d.Day != 0:
+		return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+	case d.Month != 0:
+		return fmt.Sprintf("%04d-%02d", d.Year, d.Month)
+	default:
+		return fmt.Sprintf("%04d", d.Year)
+	}
+}
+
+// newEntryDate builds an EntryDate with the given precision ("year", "month" or "day")
+func newEntryDate(t time.Time, precision string) EntryDate {
+	date := EntryDate{Year: t.Year()}
+	if precision == "month" || precision == "day" {
+		date.Month = int(t.Month())
+	}
+	if precision == "day" {
+		date.Day = t.Day()
+	}
+	return date
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types (upper nibble of the fixed header)
+const (
+	mqttConnect = 0x10
+	mqttConnack = 0x20
+	mqttPublish = 0x30
+	mqttPingreq = 0xC0
+)
+
+// mqttKeepAlive is the keep alive interval announced to the broker
+const mqttKeepAlive = 60 * time.Second
+
+// mqttMaxIncomingPacket bounds the remaining length of packets read from the broker
+// The client never subscribes, so it only receives CONNACK, PUBACK and PINGRESP, all a few bytes long
+const mqttMaxIncomingPacket = 256
+
+// MQTTConfig holds the MQTT publisher configuration
+type MQTTConfig struct {
+	Broker            string // Broker URL: tcp://host:1883, ssl://host:8883 or mqtts://host:8883
+	Username          string
+	Password          string
+	ClientID          string
+	Topic             string // State topic template, supports {hostname} and {interface}
+	AvailabilityTopic string // Availability (last will) topic template, supports {hostname}
+	DiscoveryPrefix   string // Home Assistant discovery prefix, empty disables discovery
+	CAFile            string // Optional CA certificate for TLS connections
+	TLSInsecure       bool   // Skip TLS certificate verification
+}
+
+// mqttSensor describes one Home Assistant sensor published per interface
+type mqttSensor struct {
+	key  string // Field in the state payload
+	name string // Human readable suffix
+}
+
+// mqttSensors lists the values published for every interface
+var mqttSensors = []mqttSensor{
+	{"today_rx", "Today RX"},
+	{"today_tx", "Today TX"},
+	{"month_rx", "Month RX"},
+	{"month_tx", "Month TX"},
+	{"total_rx", "Total RX"},
+	{"total_tx", "Total TX"},
+}
+
+// mqttIDPattern matches characters not allowed in Home Assistant discovery IDs
+var mqttIDPattern = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// MQTTPublisher periodically publishes traffic counters to an MQTT broker
+type MQTTPublisher struct {
+	config    MQTTConfig
+	service   *VnstatService
+	hostname  string
+	tlsConfig *tls.Config
+	client    *mqttClient
+	announced map[string]bool // Sensors ("interface key") whose discovery config was sent on the current connection
+}
+
+// NewMQTTPublisher creates a new MQTTPublisher instance
+func NewMQTTPublisher(config MQTTConfig, service *VnstatService) (*MQTTPublisher, error) {
+	u, err := url.Parse(config.Broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid broker URL %q (expected tcp://host:port or ssl://host:port)", config.Broker)
+	}
+
+	var tlsConfig *tls.Config
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		tlsConfig = &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: config.TLSInsecure,
+		}
+		if config.CAFile != "" {
+			caData, err := os.ReadFile(config.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caData) {
+				return nil, fmt.Errorf("no valid certificates found in %s", config.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q (expected tcp, ssl or mqtts)", u.Scheme)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+		slog.Warn("MQTT publish: failed to get hostname, using 'unknown'", "err", err)
+	}
+
+	if config.ClientID == "" {
+		config.ClientID = "vnstat-http-server-" + hostname
+	}
+
+	return &MQTTPublisher{
+		config:    config,
+		service:   service,
+		hostname:  hostname,
+		tlsConfig: tlsConfig,
+	}, nil
+}
+
+// Start runs the publisher on the shared periodic scheduler
+func (p *MQTTPublisher) Start(port string, interval time.Duration) {
+	startPeriodicTask("MQTT publish", port, interval, p.publish)
+}
+
+// publish connects to the broker if needed and publishes the current counters
+func (p *MQTTPublisher) publish() {
+	start, succeeded := time.Now(), false
+	defer func() { selfMetrics.observePush("mqtt", start, succeeded) }()
+
+	jsonData, err := p.service.GetJSON()
+	if err != nil {
+		slog.Error("MQTT publish: failed to get JSON data", "err", err)
+		return
+	}
+
+	var vnstatData map[string]interface{}
+	if err := json.Unmarshal(jsonData, &vnstatData); err != nil {
+		slog.Error("MQTT publish: failed to parse JSON data", "err", err)
+		return
+	}
+
+	interfaces, ok := extractInterfaceTraffic(vnstatData)
+	if !ok {
+		slog.Warn("MQTT publish: no interface data available")
+		return
+	}
+
+	if err := p.ensureConnected(); err != nil {
+		slog.Error("MQTT publish: failed to connect", "broker", p.config.Broker, "err", err)
+		return
+	}
+
+	for _, iface := range interfaces {
+		if err := p.publishInterface(iface); err != nil {
+			slog.Error("MQTT publish: failed to publish", "interface", iface.Name, "err", err)
+			p.client.Close()
+			p.client = nil
+			return
+		}
+	}
+	succeeded = true
+}
+
+// ensureConnected (re)connects to the broker and announces availability
+func (p *MQTTPublisher) ensureConnected() error {
+	if p.client != nil && !p.client.Closed() {
+		return nil
+	}
+
+	availabilityTopic := p.availabilityTopic()
+	client, err := dialMQTT(p.config, p.tlsConfig, availabilityTopic)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Publish(availabilityTopic, []byte("online"), true); err != nil {
+		client.Close()
+		return err
+	}
+
+	slog.Info("MQTT publish: connected", "broker", p.config.Broker)
+	p.client = client
+	p.announced = make(map[string]bool)
+	return nil
+}
+
+// publishInterface publishes discovery config (once per connection) and the state of one interface
+func (p *MQTTPublisher) publishInterface(iface interfaceTraffic) error {
+	stateTopic := p.stateTopic(iface.Name)
+
+	state := make(map[string]float64)
+	if iface.HasToday {
+		state["today_rx"] = iface.TodayRx
+		state["today_tx"] = iface.TodayTx
+	}
+	if iface.HasMonth {
+		state["month_rx"] = iface.MonthRx
+		state["month_tx"] = iface.MonthTx
+	}
+	if iface.HasTotal {
+		state["total_rx"] = iface.TotalRx
+		state["total_tx"] = iface.TotalTx
+	}
+
+	if p.config.DiscoveryPrefix != "" {
+		if err := p.publishDiscovery(iface.Name, stateTopic, state); err != nil {
+			return err
+		}
+	}
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return p.client.Publish(stateTopic, payload, true)
+}
+
+// publishDiscovery publishes Home Assistant MQTT discovery config for the sensors of an interface that have
+// a value in state and were not announced on this connection yet; sensors without a value would stay unknown
+func (p *MQTTPublisher) publishDiscovery(interfaceName, stateTopic string, state map[string]float64) error {
+	nodeID := mqttIDPattern.ReplaceAllString("vnstat_"+p.hostname, "_")
+
+	for _, sensor := range mqttSensors {
+		if _, ok := state[sensor.key]; !ok || p.announced[interfaceName+" "+sensor.key] {
+			continue
+		}
+		objectID := mqttIDPattern.ReplaceAllString(interfaceName+"_"+sensor.key, "_")
+		config := map[string]interface{}{
+			"name":                          fmt.Sprintf("%s %s", interfaceName, sensor.name),
+			"unique_id":                     nodeID + "_" + objectID,
+			"object_id":                     nodeID + "_" + objectID,
+			"state_topic":                   stateTopic,
+			"value_template":                fmt.Sprintf("{{ value_json.%s }}", sensor.key),
+			"availability_topic":            p.availabilityTopic(),
+			"unit_of_measurement":           "B",
+			"suggested_unit_of_measurement": "GiB",
+			"device_class":                  "data_size",
+			"state_class":                   "total_increasing",
+			"icon":                          "mdi:network",
+			"device": map[string]interface{}{
+				"identifiers":  []string{nodeID},
+				"name":         "vnstat " + p.hostname,
+				"manufacturer": "vnstat-http-server",
+			},
+		}
+
+		payload, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+
+		topic := fmt.Sprintf("%s/sensor/%s/%s/config", strings.TrimSuffix(p.config.DiscoveryPrefix, "/"), nodeID, objectID)
+		if err := p.client.Publish(topic, payload, true); err != nil {
+			return err
+		}
+		p.announced[interfaceName+" "+sensor.key] = true
+	}
+
+	return nil
+}
+
+// stateTopic expands the state topic template for one interface
+func (p *MQTTPublisher) stateTopic(interfaceName string) string {
+	topic := strings.ReplaceAll(p.config.Topic, "{hostname}", sanitizeMQTTTopicLevel(p.hostname))
+	return strings.ReplaceAll(topic, "{interface}", sanitizeMQTTTopicLevel(interfaceName))
+}
+
+// availabilityTopic expands the availability topic template
+func (p *MQTTPublisher) availabilityTopic() string {
+	return strings.ReplaceAll(p.config.AvailabilityTopic, "{hostname}", sanitizeMQTTTopicLevel(p.hostname))
+}
+
+// sanitizeMQTTTopicLevel replaces characters that have special meaning in MQTT topics
+func sanitizeMQTTTopicLevel(s string) string {
+	replacer := strings.NewReplacer("/", "_", "+", "_", "#", "_")
+	return replacer.Replace(s)
+}
+
+// mqttClient is a minimal MQTT 3.1.1 client supporting QoS 0 publishing
+type mqttClient struct {
+	conn      net.Conn
+	writeMu   sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// dialMQTT connects to the broker, registers the last will on availabilityTopic and starts keep alive handling
+func dialMQTT(config MQTTConfig, tlsConfig *tls.Config, availabilityTopic string) (*mqttClient, error) {
+	u, err := url.Parse(config.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", u.Host, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", u.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return connectMQTT(conn, config, availabilityTopic)
+}
+
+// connectMQTT sends CONNECT on an established connection and waits for the CONNACK; conn is closed on failure
+func connectMQTT(conn net.Conn, config MQTTConfig, availabilityTopic string) (*mqttClient, error) {
+	// Variable header: protocol name, level 4 (3.1.1), connect flags, keep alive
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	body = append(body, 4)
+
+	flags := byte(0x02) // Clean session
+	if availabilityTopic != "" {
+		flags |= 0x04 | 0x20 // Will flag, will retain (QoS 0)
+	}
+	if config.Username != "" {
+		flags |= 0x80
+		if config.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+
+	// Payload: client ID, will, credentials
+	body = appendMQTTString(body, config.ClientID)
+	if availabilityTopic != "" {
+		body = appendMQTTString(body, availabilityTopic)
+		body = appendMQTTString(body, "offline")
+	}
+	if config.Username != "" {
+		body = appendMQTTString(body, config.Username)
+		if config.Password != "" {
+			body = appendMQTTString(body, config.Password)
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(encodeMQTTPacket(mqttConnect, body)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	packetType, ack, err := readMQTTPacket(reader, mqttMaxIncomingPacket)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNACK: %v", err)
+	}
+	if packetType != mqttConnack || len(ack) != 2 {
+		conn.Close()
+		return nil, errors.New("unexpected response to CONNECT")
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("connection refused by broker (%s)", mqttConnackReason(ack[1]))
+	}
+	conn.SetDeadline(time.Time{})
+
+	client := &mqttClient{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	go client.readLoop(reader)
+	go client.keepAlive()
+
+	return client, nil
+}
+
+// Publish sends a QoS 0 PUBLISH packet
+func (c *mqttClient) Publish(topic string, payload []byte, retain bool) error {
+	body := appendMQTTString(nil, topic)
+	body = append(body, payload...)
+
+	packetType := byte(mqttPublish)
+	if retain {
+		packetType |= 0x01
+	}
+	return c.write(encodeMQTTPacket(packetType, body))
+}
+
+// Closed reports whether the connection has been lost or closed
+func (c *mqttClient) Closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close drops the connection without sending DISCONNECT, so the broker publishes the last will (offline)
+// It is only called on errors: a DISCONNECT would discard the will and leave availability retained as online
+func (c *mqttClient) Close() {
+	c.shutdown()
+}
+
+// shutdown closes the connection and signals background goroutines to stop
+func (c *mqttClient) shutdown() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// write sends one packet, serializing concurrent writers
+func (c *mqttClient) write(packet []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(packet); err != nil {
+		c.shutdown()
+		return err
+	}
+	return nil
+}
+
+// readLoop consumes incoming packets (PINGRESP etc.) until the connection fails
+func (c *mqttClient) readLoop(reader *bufio.Reader) {
+	defer c.shutdown()
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(mqttKeepAlive * 3 / 2))
+		if _, _, err := readMQTTPacket(reader, mqttMaxIncomingPacket); err != nil {
+			if !c.Closed() {
+				slog.Warn("MQTT publish: connection lost", "err", err)
+			}
+			return
+		}
+	}
+}
+
+// keepAlive sends PINGREQ so the broker does not drop an idle connection
+func (c *mqttClient) keepAlive() {
+	ticker := time.NewTicker(mqttKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write(encodeMQTTPacket(mqttPingreq, nil)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// encodeMQTTPacket builds a packet from its fixed header type/flags and body
+func encodeMQTTPacket(packetType byte, body []byte) []byte {
+	packet := []byte{packetType}
+
+	// Remaining length uses a variable length encoding of 7 bits per byte
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+
+	return append(packet, body...)
+}
+
+// readMQTTPacket reads one packet and returns its type and body
+// Packets with a remaining length above maxLength are rejected before their body is allocated
+func readMQTTPacket(reader *bufio.Reader, maxLength int) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := 0
+	for multiplier := 1; ; multiplier *= 128 {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if multiplier == 128*128*128 { // At most four length bytes
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	if length > maxLength {
+		return 0, nil, fmt.Errorf("packet of %d bytes exceeds the limit of %d", length, maxLength)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xF0, body, nil
+}
+
+// appendMQTTString appends a length-prefixed UTF-8 string
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// mqttConnackReason describes a CONNACK return code
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("return code %d", code)
+	}
+}
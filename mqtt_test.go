@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mqttTestPacket is a packet as received by the fake broker, header flags included
+type mqttTestPacket struct {
+	header byte
+	body   []byte
+}
+
+// publish splits a PUBLISH body into topic and payload
+func (p mqttTestPacket) publish(t *testing.T) (topic string, payload []byte) {
+	t.Helper()
+	if p.header&0xF0 != mqttPublish || len(p.body) < 2 {
+		t.Fatalf("packet %#x is not a PUBLISH", p.header)
+	}
+	n := int(p.body[0])<<8 | int(p.body[1])
+	return string(p.body[2 : 2+n]), p.body[2+n:]
+}
+
+// fakeMQTTBroker serves the broker end of a net.Pipe: it answers the CONNECT with connack
+// and sends every packet it reads, the CONNECT first, to the returned channel
+func fakeMQTTBroker(t *testing.T, connack []byte) (net.Conn, <-chan mqttTestPacket) {
+	t.Helper()
+	clientConn, brokerConn := net.Pipe()
+	packets := make(chan mqttTestPacket, 64)
+	go func() {
+		defer close(packets)
+		defer brokerConn.Close()
+		reader := bufio.NewReader(brokerConn)
+		for first := true; ; first = false {
+			header, err := reader.Peek(1)
+			if err != nil {
+				return
+			}
+			flags := header[0]
+			_, body, err := readMQTTPacket(reader, 1<<20)
+			if err != nil {
+				return
+			}
+			packets <- mqttTestPacket{header: flags, body: body}
+			if first {
+				if _, err := brokerConn.Write(connack); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	t.Cleanup(func() { clientConn.Close() })
+	return clientConn, packets
+}
+
+// nextPacket waits for the next packet the fake broker received
+func nextPacket(t *testing.T, packets <-chan mqttTestPacket) mqttTestPacket {
+	t.Helper()
+	select {
+	case packet, ok := <-packets:
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		return packet
+	case <-time.After(5 * time.Second):
+		t.Fatal("no packet from the client")
+	}
+	return mqttTestPacket{}
+}
+
+// mqttString is the length-prefixed encoding of s, written out independently of appendMQTTString
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+func TestMQTTConnectEncoding(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       MQTTConfig
+		availability string
+		flags        byte
+		payload      [][]byte
+	}{
+		{
+			name:    "clean session only",
+			config:  MQTTConfig{ClientID: "c1"},
+			flags:   0x02,
+			payload: [][]byte{mqttString("c1")},
+		},
+		{
+			name:         "will",
+			config:       MQTTConfig{ClientID: "c1"},
+			availability: "vnstat/web1/status",
+			flags:        0x02 | 0x04 | 0x20, // Clean session, will, will retain at QoS 0
+			payload:      [][]byte{mqttString("c1"), mqttString("vnstat/web1/status"), mqttString("offline")},
+		},
+		{
+			name:    "username without password",
+			config:  MQTTConfig{ClientID: "c1", Username: "user"},
+			flags:   0x02 | 0x80,
+			payload: [][]byte{mqttString("c1"), mqttString("user")},
+		},
+		{
+			name:         "will and credentials",
+			config:       MQTTConfig{ClientID: "c1", Username: "user", Password: "pass"},
+			availability: "status",
+			flags:        0x02 | 0x04 | 0x20 | 0x80 | 0x40,
+			payload:      [][]byte{mqttString("c1"), mqttString("status"), mqttString("offline"), mqttString("user"), mqttString("pass")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, packets := fakeMQTTBroker(t, []byte{mqttConnack, 2, 0, 0})
+			client, err := connectMQTT(conn, tt.config, tt.availability)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			connect := nextPacket(t, packets)
+			if connect.header != mqttConnect {
+				t.Errorf("header = %#x, want CONNECT %#x", connect.header, mqttConnect)
+			}
+			// Protocol name, level 4, flags, keep alive of 60 seconds
+			want := append(mqttString("MQTT"), 4, tt.flags, 0, 60)
+			want = append(want, bytes.Join(tt.payload, nil)...)
+			if !bytes.Equal(connect.body, want) {
+				t.Errorf("CONNECT body =\n%v\nwant\n%v", connect.body, want)
+			}
+		})
+	}
+}
+
+func TestMQTTConnack(t *testing.T) {
+	tests := []struct {
+		name    string
+		connack []byte
+		err     string
+	}{
+		{"accepted", []byte{mqttConnack, 2, 0, 0}, ""},
+		{"session present", []byte{mqttConnack, 2, 1, 0}, ""},
+		{"protocol version", []byte{mqttConnack, 2, 0, 1}, "unacceptable protocol version"},
+		{"identifier", []byte{mqttConnack, 2, 0, 2}, "identifier rejected"},
+		{"unavailable", []byte{mqttConnack, 2, 0, 3}, "server unavailable"},
+		{"credentials", []byte{mqttConnack, 2, 0, 4}, "bad username or password"},
+		{"not authorized", []byte{mqttConnack, 2, 0, 5}, "not authorized"},
+		{"unknown code", []byte{mqttConnack, 2, 0, 9}, "return code 9"},
+		{"wrong packet", []byte{0xD0, 0}, "unexpected response"},
+		{"wrong length", []byte{mqttConnack, 3, 0, 0, 0}, "unexpected response"},
+		{"oversized packet", []byte{mqttConnack, 0xAC, 0x02}, "exceeds the limit"}, // Claims 300 bytes
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _ := fakeMQTTBroker(t, tt.connack)
+			client, err := connectMQTT(conn, MQTTConfig{ClientID: "c1"}, "")
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("error = %v, want none", err)
+				}
+				client.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMQTTRemainingLength(t *testing.T) {
+	tests := []struct {
+		size   int
+		length []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xFF, 0x7F}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+	}
+	for _, tt := range tests {
+		body := bytes.Repeat([]byte{'x'}, tt.size)
+		packet := encodeMQTTPacket(mqttPublish, body)
+		if !bytes.Equal(packet[1:1+len(tt.length)], tt.length) {
+			t.Errorf("size %d: remaining length %v, want %v", tt.size, packet[1:1+len(tt.length)], tt.length)
+		}
+
+		packetType, decoded, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)), tt.size)
+		if err != nil || packetType != mqttPublish || !bytes.Equal(decoded, body) {
+			t.Errorf("size %d: round trip = %#x, %d bytes, %v", tt.size, packetType, len(decoded), err)
+		}
+		if tt.size > 0 {
+			if _, _, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)), tt.size-1); err == nil {
+				t.Errorf("size %d: accepted with a limit of %d", tt.size, tt.size-1)
+			}
+		}
+	}
+
+	// A fifth length byte is malformed; the largest four-byte length is rejected before allocating
+	if _, _, err := readMQTTPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xFF, 0xFF, 0xFF, 0xFF, 0x01})), 1<<30); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("five length bytes: error = %v, want malformed", err)
+	}
+	if _, _, err := readMQTTPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xFF, 0xFF, 0xFF, 0x7F})), mqttMaxIncomingPacket); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("268435455 bytes: error = %v, want the limit", err)
+	}
+}
+
+func TestMQTTDiscovery(t *testing.T) {
+	conn, packets := fakeMQTTBroker(t, []byte{mqttConnack, 2, 0, 0})
+	client, err := connectMQTT(conn, MQTTConfig{ClientID: "c1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	nextPacket(t, packets) // CONNECT
+
+	publisher := &MQTTPublisher{
+		config: MQTTConfig{
+			Topic:             "vnstat/{hostname}/{interface}",
+			AvailabilityTopic: "vnstat/{hostname}/status",
+			DiscoveryPrefix:   "homeassistant/",
+		},
+		hostname:  "web.1",
+		client:    client,
+		announced: make(map[string]bool),
+	}
+
+	// Only the sensors with a value are announced, before the state
+	if err := publisher.publishInterface(interfaceTraffic{Name: "eth0.5", HasToday: true, TodayRx: 1000, TodayTx: 2000}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"today_rx", "today_tx"} {
+		packet := nextPacket(t, packets)
+		if packet.header&0x01 == 0 {
+			t.Errorf("discovery config of %s is not retained", key)
+		}
+		topic, payload := packet.publish(t)
+		if want := "homeassistant/sensor/vnstat_web_1/eth0_5_" + key + "/config"; topic != want {
+			t.Errorf("topic = %q, want %q", topic, want)
+		}
+		var config struct {
+			Name              string `json:"name"`
+			UniqueID          string `json:"unique_id"`
+			StateTopic        string `json:"state_topic"`
+			ValueTemplate     string `json:"value_template"`
+			AvailabilityTopic string `json:"availability_topic"`
+			Unit              string `json:"unit_of_measurement"`
+			DeviceClass       string `json:"device_class"`
+			StateClass        string `json:"state_class"`
+			Device            struct {
+				Identifiers []string `json:"identifiers"`
+				Name        string   `json:"name"`
+			} `json:"device"`
+		}
+		if err := json.Unmarshal(payload, &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.UniqueID != "vnstat_web_1_eth0_5_"+key || config.StateTopic != "vnstat/web.1/eth0.5" ||
+			config.ValueTemplate != "{{ value_json."+key+" }}" || config.AvailabilityTopic != "vnstat/web.1/status" ||
+			config.Unit != "B" || config.DeviceClass != "data_size" || config.StateClass != "total_increasing" ||
+			len(config.Device.Identifiers) != 1 || config.Device.Identifiers[0] != "vnstat_web_1" || config.Device.Name != "vnstat web.1" {
+			t.Errorf("discovery config of %s = %s", key, payload)
+		}
+	}
+	state := nextPacket(t, packets)
+	if topic, payload := state.publish(t); topic != "vnstat/web.1/eth0.5" || string(payload) != `{"today_rx":1000,"today_tx":2000}` {
+		t.Errorf("state = %s %s", topic, payload)
+	}
+
+	// Sensors announced on this connection are not announced again, new ones are
+	if err := publisher.publishInterface(interfaceTraffic{Name: "eth0.5", HasToday: true, HasMonth: true, MonthRx: 5, MonthTx: 6}); err != nil {
+		t.Fatal(err)
+	}
+	var topics []string
+	for i := 0; i < 3; i++ {
+		topic, _ := nextPacket(t, packets).publish(t)
+		topics = append(topics, topic)
+	}
+	want := []string{
+		"homeassistant/sensor/vnstat_web_1/eth0_5_month_rx/config",
+		"homeassistant/sensor/vnstat_web_1/eth0_5_month_tx/config",
+		"vnstat/web.1/eth0.5",
+	}
+	if strings.Join(topics, " ") != strings.Join(want, " ") {
+		t.Errorf("topics = %v, want %v", topics, want)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// netDevCounters holds the /proc/net/dev counters of one interface
+type netDevCounters struct {
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	RxDrops   uint64
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+	TxDrops   uint64
+}
+
+// add accumulates the delta between two raw readings, treating a decrease as a counter reset
+func (c *netDevCounters) add(previous, current netDevCounters) {
+	c.RxBytes += counterDelta(previous.RxBytes, current.RxBytes)
+	c.RxPackets += counterDelta(previous.RxPackets, current.RxPackets)
+	c.RxErrors += counterDelta(previous.RxErrors, current.RxErrors)
+	c.RxDrops += counterDelta(previous.RxDrops, current.RxDrops)
+	c.TxBytes += counterDelta(previous.TxBytes, current.TxBytes)
+	c.TxPackets += counterDelta(previous.TxPackets, current.TxPackets)
+	c.TxErrors += counterDelta(previous.TxErrors, current.TxErrors)
+	c.TxDrops += counterDelta(previous.TxDrops, current.TxDrops)
+}
+
+// counterDelta returns how much a kernel counter grew; after a reset the new value is the growth
+func counterDelta(previous, current uint64) uint64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// NetDevSampler reads /proc/net/dev and keeps per-interface counters that never go backwards,
+// even when the kernel counters reset (e.g. the interface is recreated)
+type NetDevSampler struct {
+	path          string   // Path to net/dev under the configured proc root
+	interfaceName string   // Only sample this interface (empty for all except lo)
+	exclude       []string // Glob patterns of interfaces never sampled
+
+	mu     sync.Mutex
+	last   map[string]netDevCounters // Last raw kernel reading
+	totals map[string]netDevCounters // Monotonic totals exported as counters
+}
+
+// NewNetDevSampler creates a new NetDevSampler reading <procRoot>/net/dev
+func NewNetDevSampler(procRoot, interfaceName string, exclude []string) *NetDevSampler {
+	return &NetDevSampler{
+		path:          filepath.Join(procRoot, "net", "dev"),
+		interfaceName: interfaceName,
+		exclude:       exclude,
+		last:          make(map[string]netDevCounters),
+		totals:        make(map[string]netDevCounters),
+	}
+}
+
+// Start samples in the background so resets between scrapes are not missed
+func (s *NetDevSampler) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.Sample(); err != nil {
+			slog.Error("Net dev sampler: sampling failed", "err", err)
+		}
+	}
+}
+
+// Sample reads the current kernel counters and folds them into the monotonic totals
+func (s *NetDevSampler) Sample() error {
+	// Hold the lock while reading so concurrent samples are applied in order
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", s.path, err)
+	}
+	defer f.Close()
+
+	current, err := parseNetDev(f)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", s.path, err)
+	}
+
+	for name, counters := range current {
+		if s.interfaceName != "" && name != s.interfaceName {
+			continue
+		}
+		if s.interfaceName == "" && name == "lo" {
+			continue
+		}
+		if matchesAny(s.exclude, name) {
+			continue
+		}
+
+		total := s.totals[name]
+		if previous, ok := s.last[name]; ok {
+			total.add(previous, counters)
+		} else {
+			// First reading starts from the kernel values
+			total = counters
+		}
+		s.totals[name] = total
+		s.last[name] = counters
+	}
+
+	return nil
+}
+
+// Snapshot returns a copy of the monotonic totals
+func (s *NetDevSampler) Snapshot() map[string]netDevCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]netDevCounters, len(s.totals))
+	for name, counters := range s.totals {
+		result[name] = counters
+	}
+	return result
+}
+
+// parseNetDev parses the /proc/net/dev table
+func parseNetDev(r io.Reader) (map[string]netDevCounters, error) {
+	result := make(map[string]netDevCounters)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			// Header lines
+			continue
+		}
+
+		name := strings.TrimSpace(line[:colon])
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("unexpected field count for %s: %d", name, len(fields))
+		}
+
+		values := make([]uint64, 16)
+		for i := range values {
+			v, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid counter for %s: %v", name, err)
+			}
+			values[i] = v
+		}
+
+		// Receive: bytes packets errs drop fifo frame compressed multicast
+		// Transmit: bytes packets errs drop fifo colls carrier compressed
+		result[name] = netDevCounters{
+			RxBytes:   values[0],
+			RxPackets: values[1],
+			RxErrors:  values[2],
+			RxDrops:   values[3],
+			TxBytes:   values[8],
+			TxPackets: values[9],
+			TxErrors:  values[10],
+			TxDrops:   values[11],
+		}
+	}
+
+	return result, scanner.Err()
+}
+
+// generateNetDevMetrics renders the monotonic counters in Prometheus format
+func generateNetDevMetrics(counters map[string]netDevCounters, labels *labelConfig) string {
+	var metrics strings.Builder
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	series := []struct {
+		name  string
+		help  string
+		value func(netDevCounters) uint64
+	}{
+		{"vnstat_live_rx_bytes_total", "Received bytes from kernel interface counters", func(c netDevCounters) uint64 { return c.RxBytes }},
+		{"vnstat_live_tx_bytes_total", "Transmitted bytes from kernel interface counters", func(c netDevCounters) uint64 { return c.TxBytes }},
+		{"vnstat_live_rx_packets_total", "Received packets from kernel interface counters", func(c netDevCounters) uint64 { return c.RxPackets }},
+		{"vnstat_live_tx_packets_total", "Transmitted packets from kernel interface counters", func(c netDevCounters) uint64 { return c.TxPackets }},
+		{"vnstat_live_rx_errors_total", "Receive errors from kernel interface counters", func(c netDevCounters) uint64 { return c.RxErrors }},
+		{"vnstat_live_tx_errors_total", "Transmit errors from kernel interface counters", func(c netDevCounters) uint64 { return c.TxErrors }},
+		{"vnstat_live_rx_drops_total", "Dropped received packets from kernel interface counters", func(c netDevCounters) uint64 { return c.RxDrops }},
+		{"vnstat_live_tx_drops_total", "Dropped transmitted packets from kernel interface counters", func(c netDevCounters) uint64 { return c.TxDrops }},
+	}
+
+	for _, s := range series {
+		metrics.WriteString(fmt.Sprintf("# HELP %s %s\n", s.name, s.help))
+		metrics.WriteString(fmt.Sprintf("# TYPE %s counter\n", s.name))
+		for _, name := range names {
+			metrics.WriteString(fmt.Sprintf("%s{%s} %d\n", s.name, labels.interfaceLabels(name), s.value(counters[name])))
+		}
+	}
+
+	return metrics.String()
+}
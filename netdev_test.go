@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// netDevHeader is the two header lines of /proc/net/dev
+const netDevHeader = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+`
+
+// writeNetDev writes net/dev below a -proc-root fixture directory
+func writeNetDev(t *testing.T, procRoot, rows string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(procRoot, "net"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "net", "dev"), []byte(netDevHeader+rows), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseNetDev(t *testing.T) {
+	counters, err := parseNetDev(strings.NewReader(netDevHeader +
+		"    lo:     500       5    0    0    0     0          0         0      500       5    0    0    0     0       0          0\n" +
+		"  eth0: 1000 10 1 2 0 0 0 7 2000 20 3 4 0 0 0 0\n" +
+		"eth1:18446744073709551615 1 0 0 0 0 0 0 9 1 0 0 0 0 0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counters) != 3 {
+		t.Fatalf("got %d interfaces, want 3 (headers skipped)", len(counters))
+	}
+	want := netDevCounters{RxBytes: 1000, RxPackets: 10, RxErrors: 1, RxDrops: 2, TxBytes: 2000, TxPackets: 20, TxErrors: 3, TxDrops: 4}
+	if counters["eth0"] != want {
+		t.Errorf("eth0 = %+v, want %+v", counters["eth0"], want)
+	}
+	// Old kernels print large counters without a space after the colon
+	if counters["eth1"].RxBytes != 18446744073709551615 || counters["eth1"].TxBytes != 9 {
+		t.Errorf("eth1 = %+v", counters["eth1"])
+	}
+
+	for name, rows := range map[string]string{
+		"too few fields": "  eth0: 1000 10 1 2 0 0 0 0 2000 20 3 4 0 0 0\n",
+		"not a number":   "  eth0: 1000 10 1 2 0 0 0 0 2000 twenty 3 4 0 0 0 0\n",
+		"negative":       "  eth0: -1 10 1 2 0 0 0 0 2000 20 3 4 0 0 0 0\n",
+	} {
+		if _, err := parseNetDev(strings.NewReader(netDevHeader + rows)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestNetDevSamplerCounterReset(t *testing.T) {
+	procRoot := t.TempDir()
+	sampler := NewNetDevSampler(procRoot, "", nil)
+
+	steps := []struct {
+		rxBytes uint64
+		rxTotal uint64
+	}{
+		{1000, 1000}, // The first reading starts from the kernel value
+		{1500, 1500},
+		{200, 1700}, // Reset (interface recreated): the total continues from 1500
+		{300, 1800},
+	}
+	for _, step := range steps {
+		writeNetDev(t, procRoot, "  eth0: "+strconv.FormatUint(step.rxBytes, 10)+" 1 0 0 0 0 0 0 50 1 0 0 0 0 0 0\n")
+		if err := sampler.Sample(); err != nil {
+			t.Fatal(err)
+		}
+		if total := sampler.Snapshot()["eth0"].RxBytes; total != step.rxTotal {
+			t.Errorf("after kernel value %d: total = %d, want %d", step.rxBytes, total, step.rxTotal)
+		}
+	}
+	if tx := sampler.Snapshot()["eth0"].TxBytes; tx != 50 {
+		t.Errorf("unchanged tx total = %d, want 50", tx)
+	}
+}
+
+func TestNetDevSamplerInterfaces(t *testing.T) {
+	procRoot := t.TempDir()
+	writeNetDev(t, procRoot, ""+
+		"    lo: 1 1 0 0 0 0 0 0 1 1 0 0 0 0 0 0\n"+
+		"  eth0: 1 1 0 0 0 0 0 0 1 1 0 0 0 0 0 0\n"+
+		"docker0: 1 1 0 0 0 0 0 0 1 1 0 0 0 0 0 0\n"+
+		"vethab12: 1 1 0 0 0 0 0 0 1 1 0 0 0 0 0 0\n"+
+		"   wg0: 1 1 0 0 0 0 0 0 1 1 0 0 0 0 0 0\n")
+
+	tests := []struct {
+		name          string
+		interfaceName string
+		exclude       []string
+		want          string
+	}{
+		{"all except lo", "", nil, "docker0 eth0 vethab12 wg0"},
+		{"excluded patterns", "", []string{"docker*", "veth*"}, "eth0 wg0"},
+		{"single interface", "wg0", nil, "wg0"},
+		{"single interface lo", "lo", nil, "lo"},
+		{"single interface excluded", "docker0", []string{"docker*"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler := NewNetDevSampler(procRoot, tt.interfaceName, tt.exclude)
+			if err := sampler.Sample(); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(sortedKeys(sampler.Snapshot()), " "); got != tt.want {
+				t.Errorf("sampled %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if err := NewNetDevSampler(filepath.Join(procRoot, "missing"), "", nil).Sample(); err == nil {
+		t.Error("missing net/dev accepted")
+	}
+}
+
+func TestGenerateNetDevMetrics(t *testing.T) {
+	labels, err := newLabelConfig(nil, []string{"eth0:site=ams"}, "env=prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters := map[string]netDevCounters{
+		"wg0":  {RxBytes: 5, TxDrops: 6},
+		"eth0": {RxBytes: 1000, TxBytes: 2000, RxPackets: 10, TxPackets: 20, RxErrors: 1, TxErrors: 3, RxDrops: 2, TxDrops: 4},
+	}
+	metrics := generateNetDevMetrics(counters, labels)
+
+	wantPrefix := "# HELP vnstat_live_rx_bytes_total Received bytes from kernel interface counters\n" +
+		"# TYPE vnstat_live_rx_bytes_total counter\n" +
+		"vnstat_live_rx_bytes_total{interface=\"eth0\",env=\"prod\",site=\"ams\"} 1000\n" +
+		"vnstat_live_rx_bytes_total{interface=\"wg0\",env=\"prod\"} 5\n" +
+		"# HELP vnstat_live_tx_bytes_total Transmitted bytes from kernel interface counters\n"
+	if !strings.HasPrefix(metrics, wantPrefix) {
+		t.Errorf("metrics start with\n%s\nwant\n%s", metrics[:min(len(metrics), len(wantPrefix))], wantPrefix)
+	}
+	for _, line := range []string{
+		`vnstat_live_tx_bytes_total{interface="eth0",env="prod",site="ams"} 2000`,
+		`vnstat_live_rx_packets_total{interface="eth0",env="prod",site="ams"} 10`,
+		`vnstat_live_tx_packets_total{interface="eth0",env="prod",site="ams"} 20`,
+		`vnstat_live_rx_errors_total{interface="eth0",env="prod",site="ams"} 1`,
+		`vnstat_live_tx_errors_total{interface="eth0",env="prod",site="ams"} 3`,
+		`vnstat_live_rx_drops_total{interface="eth0",env="prod",site="ams"} 2`,
+		`vnstat_live_tx_drops_total{interface="eth0",env="prod",site="ams"} 4`,
+		`vnstat_live_tx_drops_total{interface="wg0",env="prod"} 6`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("missing %s", line)
+		}
+	}
+	// 8 families, each with HELP, TYPE and one sample per interface
+	if lines := strings.Count(metrics, "\n"); lines != 8*4 {
+		t.Errorf("got %d lines, want %d", lines, 8*4)
+	}
+
+	if plain := generateNetDevMetrics(map[string]netDevCounters{"eth0": {RxBytes: 1}}, nil); !strings.Contains(plain, "vnstat_live_rx_bytes_total{interface=\"eth0\"} 1\n") {
+		t.Errorf("without label config:\n%s", plain)
+	}
+}
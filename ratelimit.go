@@ -0,0 +1,433 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimit is a token bucket: Rate requests per second on average, up to Burst at once
+// The zero value means unlimited
+type rateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// parseRateLimit parses a limit such as 10/s, 600/m:50 or 1/h; off or 0 disables it
+// Without :burst the bucket holds one unit's worth of requests (10 for 10/s)
+func parseRateLimit(spec string) (rateLimit, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "0" || spec == "off" {
+		return rateLimit{}, nil
+	}
+
+	spec, burstSpec, hasBurst := strings.Cut(spec, ":")
+	countSpec, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return rateLimit{}, fmt.Errorf("invalid rate limit %q (expected count/unit[:burst], e.g. 10/s or 600/m:50)", spec)
+	}
+	count, err := strconv.ParseFloat(countSpec, 64)
+	if err != nil || count <= 0 || math.IsInf(count, 0) {
+		return rateLimit{}, fmt.Errorf("invalid rate limit count %q (must be a positive number)", countSpec)
+	}
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return rateLimit{}, fmt.Errorf("invalid rate limit unit %q (must be s, m or h)", unit)
+	}
+
+	limit := rateLimit{Rate: count / per.Seconds(), Burst: int(math.Max(1, math.Ceil(count)))}
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burstSpec); err != nil || limit.Burst < 1 {
+			return rateLimit{}, fmt.Errorf("invalid rate limit burst %q (must be a positive integer)", burstSpec)
+		}
+	}
+	return limit, nil
+}
+
+// unlimited reports whether the limit is disabled
+func (l rateLimit) unlimited() bool {
+	return l.Rate <= 0
+}
+
+// tokenBucket holds the requests a client may still make under one limit
+type tokenBucket struct {
+	limit   rateLimit
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens earned since the last update, up to the burst
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate)
+	b.updated = now
+}
+
+// take consumes a token, it returns how long to wait if the bucket is empty
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// rateLimiterMaxEntries caps the buckets and the failure records each, so clients rotating addresses
+// cannot grow them without bound between sweeps
+const rateLimiterMaxEntries = 100000
+
+// authFailures counts the failed authentications of a client within the failure window
+type authFailures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// rateLimiter limits requests per client and per token, and locks out clients that keep failing
+// authentication. Clients are keyed by clientKey. A nil rateLimiter allows everything
+type rateLimiter struct {
+	mu sync.Mutex
+
+	defaultLimit rateLimit            // Per-IP limit of endpoints without their own
+	pathLimits   map[string]rateLimit // Per-IP limits by endpoint path, or path prefix ending in /
+	tokenLimit   rateLimit            // Limit of all requests made with the token, whatever their IP
+
+	maxFailures   int           // Failed authentications that trigger a lockout, 0 disables lockouts
+	failureWindow time.Duration // Window the failures are counted in
+	lockout       time.Duration // How long a client stays locked out
+
+	buckets   map[string]*tokenBucket
+	failures  map[string]*authFailures
+	lastSweep time.Time
+}
+
+// rateLimiterConfig holds the rate limiting and lockout settings of the -rate-limit* and -auth-* flags
+type rateLimiterConfig struct {
+	Limit         string   // Default per-IP limit
+	PathLimits    []string // path=limit overrides
+	TokenLimit    string
+	MaxFailures   int
+	FailureWindow time.Duration
+	Lockout       time.Duration
+}
+
+// newRateLimiter parses the configuration, it returns nil if both rate limiting and lockouts are disabled
+func newRateLimiter(config rateLimiterConfig) (*rateLimiter, error) {
+	l := &rateLimiter{
+		pathLimits:    make(map[string]rateLimit),
+		maxFailures:   config.MaxFailures,
+		failureWindow: config.FailureWindow,
+		lockout:       config.Lockout,
+		buckets:       make(map[string]*tokenBucket),
+		failures:      make(map[string]*authFailures),
+	}
+
+	var err error
+	if l.defaultLimit, err = parseRateLimit(config.Limit); err != nil {
+		return nil, err
+	}
+	if l.tokenLimit, err = parseRateLimit(config.TokenLimit); err != nil {
+		return nil, fmt.Errorf("token limit: %v", err)
+	}
+	for _, spec := range config.PathLimits {
+		path, limitSpec, ok := strings.Cut(spec, "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid endpoint limit %q (expected /path=limit, e.g. /json=2/s:5)", spec)
+		}
+		if l.pathLimits[path], err = parseRateLimit(limitSpec); err != nil {
+			return nil, fmt.Errorf("endpoint %s: %v", path, err)
+		}
+	}
+
+	if l.maxFailures < 0 {
+		return nil, fmt.Errorf("max authentication failures must not be negative")
+	}
+	if l.maxFailures > 0 && (l.failureWindow <= 0 || l.lockout <= 0) {
+		return nil, fmt.Errorf("failure window and lockout must be positive when lockouts are enabled")
+	}
+
+	if l.defaultLimit.unlimited() && l.tokenLimit.unlimited() && len(l.pathLimits) == 0 && l.maxFailures == 0 {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// endpointLimit returns the per-IP limit of a route pattern and the name of its bucket
+// An exact path wins over the longest matching prefix ending in /, endpoints without either share the default
+func (l *rateLimiter) endpointLimit(pattern string) (string, rateLimit) {
+	// "GET /api/v1/interfaces" and "/ui/{$}" are configured as /api/v1/interfaces and /ui/
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
+	pattern = strings.TrimSuffix(pattern, "{$}")
+
+	if limit, ok := l.pathLimits[pattern]; ok {
+		return pattern, limit
+	}
+	name, limit := "", l.defaultLimit
+	for prefix, prefixLimit := range l.pathLimits {
+		if strings.HasSuffix(prefix, "/") && strings.HasPrefix(pattern, prefix) && len(prefix) > len(name) {
+			name, limit = prefix, prefixLimit
+		}
+	}
+	return name, limit
+}
+
+// allow takes a token from each bucket of the request, it returns how long to wait if one is empty
+func (l *rateLimiter) allow(bucket string, limit rateLimit, ip string, withToken bool) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	var wait time.Duration
+	if !limit.unlimited() {
+		wait = l.take(bucket+" "+clientKey(ip), limit, now)
+	}
+	if withToken && !l.tokenLimit.unlimited() {
+		wait = max(wait, l.take("token", l.tokenLimit, now))
+	}
+	return wait
+}
+
+// take consumes a token from the named bucket, creating it full
+func (l *rateLimiter) take(key string, limit rateLimit, now time.Time) time.Duration {
+	b, ok := l.buckets[key]
+	if !ok {
+		l.makeRoom(now)
+		b = &tokenBucket{limit: limit, tokens: float64(limit.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	return b.take(now)
+}
+
+// lockedOut returns how long the client is still locked out, 0 if it is not
+func (l *rateLimiter) lockedOut(ip string) time.Duration {
+	if l == nil || l.maxFailures == 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if f, ok := l.failures[clientKey(ip)]; ok {
+		if wait := time.Until(f.lockedUntil); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// authFailed records a failed authentication and locks the client out once it reaches the maximum
+func (l *rateLimiter) authFailed(ip string) {
+	if l == nil || l.maxFailures == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	key := clientKey(ip)
+	f, ok := l.failures[key]
+	if !ok {
+		l.makeRoom(now)
+	}
+	if !ok || now.Sub(f.first) > l.failureWindow {
+		f = &authFailures{first: now}
+		l.failures[key] = f
+	}
+	f.count++
+	if f.count >= l.maxFailures {
+		f.lockedUntil = now.Add(l.lockout)
+		slog.Warn("Locking out client after failed authentication attempts", "client", key, "failures", f.count, "lockout", l.lockout)
+		f.count, f.first = 0, now
+	}
+}
+
+// authSucceeded forgets the failures of a client
+func (l *rateLimiter) authSucceeded(ip string) {
+	if l == nil || l.maxFailures == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := clientKey(ip)
+	if f, ok := l.failures[key]; ok && time.Now().After(f.lockedUntil) {
+		delete(l.failures, key)
+	}
+}
+
+// sweep drops full buckets and expired failure records once a minute so idle clients use no memory
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.refill(now); b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	for ip, f := range l.failures {
+		if now.Sub(f.first) > l.failureWindow && now.After(f.lockedUntil) {
+			delete(l.failures, ip)
+		}
+	}
+}
+
+// makeRoom is called before adding an entry: when the buckets or failure records are full it sweeps
+// right away, then drops arbitrary entries down to 90% so the next sweeps are not forced on every request
+func (l *rateLimiter) makeRoom(now time.Time) {
+	if len(l.buckets) < rateLimiterMaxEntries && len(l.failures) < rateLimiterMaxEntries {
+		return
+	}
+	l.lastSweep = time.Time{}
+	l.sweep(now)
+	trimEntries(l.buckets, rateLimiterMaxEntries*9/10)
+	trimEntries(l.failures, rateLimiterMaxEntries*9/10)
+}
+
+// trimEntries deletes entries in map order, which is unspecified, until at most size are left
+func trimEntries[V any](entries map[string]V, size int) {
+	for key := range entries {
+		if len(entries) <= size {
+			return
+		}
+		delete(entries, key)
+	}
+}
+
+// clientKey is the identity a client is limited and locked out by: its IPv4 address, or the /64 network
+// of its IPv6 address, since a single host usually gets a whole /64 and could rotate through it
+func clientKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap().WithZone("")
+	if addr.Is4() {
+		return addr.String()
+	}
+	return netip.PrefixFrom(addr, 64).Masked().String()
+}
+
+// rateLimit rejects requests of clients over the limit of the endpoint with 429 and Retry-After
+func (s *Server) rateLimit(pattern string, errors errorWriter) middleware {
+	if s.limiter == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	bucket, limit := s.limiter.endpointLimit(pattern)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			withToken := s.token != "" && s.checkToken(r)
+			if wait := s.limiter.allow(bucket, limit, s.trustedProxies.clientIP(r), withToken); wait > 0 {
+				tooManyRequests(w, wait, errors, "Rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tooManyRequests writes a 429 response telling the client when to retry
+func tooManyRequests(w http.ResponseWriter, wait time.Duration, errors errorWriter, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	errors(w, http.StatusTooManyRequests, fmt.Sprintf("%s, retry in %ds", message, seconds))
+}
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For header is believed
+type trustedProxies []netip.Prefix
+
+// parseTrustedProxies parses a comma-separated list of IPs and CIDR ranges
+func parseTrustedProxies(spec string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %v", entry, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", entry, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// contains reports whether the IP belongs to a trusted proxy
+func (p trustedProxies) contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP of the client that made the request
+// Behind trusted proxies it is the last X-Forwarded-For address that is not a trusted proxy itself,
+// entries further left could have been sent by the client
+func (p trustedProxies) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !p.contains(ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				forwarded = append(forwarded, entry)
+			}
+		}
+	}
+	if len(forwarded) == 0 {
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+			forwarded = []string{realIP}
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(forwarded[i]); err != nil {
+			return ip // Garbage in the chain, fall back to the proxy rather than trust it
+		}
+		ip = forwarded[i]
+		if !p.contains(ip) {
+			break
+		}
+	}
+	return ip
+}
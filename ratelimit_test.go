@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClientKey(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.7":              "203.0.113.7",
+		"::ffff:203.0.113.7":       "203.0.113.7",
+		"2001:db8:1:2:3:4:5:6":     "2001:db8:1:2::/64",
+		"2001:db8:1:2:ffff::1":     "2001:db8:1:2::/64",
+		"fe80::1%eth0":             "fe80::/64",
+		"not an address":           "not an address",
+		"2001:db8:1:3:3:4:5:6":     "2001:db8:1:3::/64",
+		"2001:0db8:0001:0002::abc": "2001:db8:1:2::/64",
+	}
+	for ip, want := range tests {
+		if got := clientKey(ip); got != want {
+			t.Errorf("clientKey(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestRateLimiterLockoutByNetwork(t *testing.T) {
+	limiter, err := newRateLimiter(rateLimiterConfig{Limit: "off", TokenLimit: "off", MaxFailures: 3, FailureWindow: time.Minute, Lockout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotating addresses within a /64 counts as one client
+	for i := 1; i <= 3; i++ {
+		limiter.authFailed(fmt.Sprintf("2001:db8:1:2::%x", i))
+	}
+	if limiter.lockedOut("2001:db8:1:2::ffff") <= 0 {
+		t.Error("other address of the locked out /64 is not locked out")
+	}
+	if limiter.lockedOut("2001:db8:1:3::1") > 0 {
+		t.Error("neighbouring /64 is locked out")
+	}
+}
+
+func TestRateLimiterMaxEntries(t *testing.T) {
+	limiter, err := newRateLimiter(rateLimiterConfig{Limit: "1/h", TokenLimit: "off"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < rateLimiterMaxEntries+10; i++ {
+		limiter.allow("", limiter.defaultLimit, fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255), false)
+	}
+	if n := len(limiter.buckets); n > rateLimiterMaxEntries {
+		t.Errorf("%d buckets kept, want at most %d", n, rateLimiterMaxEntries)
+	}
+}
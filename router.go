@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// middleware wraps a handler with behavior shared by several endpoints
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h with middlewares, the first one listed runs first
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// errorWriter writes a middleware error (wrong method, missing token) in the format of an endpoint
+type errorWriter func(w http.ResponseWriter, status int, message string)
+
+// plainErrors writes errors as plain text, the format of the original endpoints
+func plainErrors(w http.ResponseWriter, status int, message string) {
+	if status == http.StatusUnauthorized {
+		message = "Unauthorized: " + message
+	}
+	http.Error(w, message, status)
+}
+
+// endpoint is one route of the server and the shared behavior applied to it
+type endpoint struct {
+	Pattern string
+	Handler http.HandlerFunc
+	Methods []string    // Allowed methods besides OPTIONS, GET if empty
+	Public  bool        // Served without token authentication
+	Errors  errorWriter // Format of method and authentication errors, plain text if nil
+}
+
+// endpoints lists the routes outside /api/v1 (registered by registerAPIRoutes)
+func (s *Server) endpoints() []endpoint {
+	endpoints := []endpoint{
+		{Pattern: "/health", Handler: s.handleHealth, Public: true},
+		{Pattern: "/livez", Handler: s.handleLivez, Public: true},
+		{Pattern: "/readyz", Handler: s.handleReadyz, Public: true},
+		{Pattern: "/metrics", Handler: s.handleMetrics},
+		{Pattern: "/json", Handler: s.handleJSON},
+		{Pattern: "/summary", Handler: s.handleSummary},
+		{Pattern: "/summary.json", Handler: s.handleSummaryJSON},
+		{Pattern: "/daily", Handler: s.handleDaily},
+		{Pattern: "/hourly", Handler: s.handleHourly},
+		{Pattern: "/weekly", Handler: s.handleWeekly},
+		{Pattern: "/monthly", Handler: s.handleText},
+		{Pattern: "/yearly", Handler: s.handleYearly},
+		{Pattern: "/top", Handler: s.handleTop},
+		{Pattern: "/oneline", Handler: s.handleOneline},
+		{Pattern: "/ui", Handler: s.handleUI, Public: true}, // The page carries no data, its requests send the token
+		{Pattern: "/ui/{$}", Handler: s.handleUI, Public: true},
+		{Pattern: "/ui/config.json", Handler: s.handleUIConfig},
+		{Pattern: "/chart/", Handler: s.handleChart},
+		{Pattern: "/export.csv", Handler: s.handleExport},
+		{Pattern: "/export.tsv", Handler: s.handleExport},
+		{Pattern: "/anomalies", Handler: s.handleAnomalies},
+		{Pattern: "/graphql", Handler: s.handleGraphQL, Methods: []string{"GET", "POST"}, Errors: graphqlErrors},
+		{Pattern: "/graphql/schema.graphql", Handler: s.handleGraphQLSchema},
+		{Pattern: "/{$}", Handler: s.handleText}, // Default monthly view, only for the root itself
+	}
+	if s.live != nil {
+		endpoints = append(endpoints,
+			endpoint{Pattern: "/live", Handler: s.handleLive},
+			endpoint{Pattern: "/live/ws", Handler: s.handleLiveWebSocket},
+		)
+	}
+	if s.aggregator != nil {
+		endpoints = append(endpoints,
+			endpoint{Pattern: "/fleet", Handler: s.handleFleet},
+			endpoint{Pattern: "/fleet/json", Handler: s.handleFleetJSON},
+		)
+	}
+	return endpoints
+}
+
+// routes builds the server's handler: a dedicated mux with every endpoint behind its middleware,
+// wrapped in request metrics, request logging and panic recovery
+func (s *Server) routes() (http.Handler, error) {
+	mux := http.NewServeMux()
+	for _, e := range s.endpoints() {
+		mux.Handle(e.Pattern, s.endpointHandler(e))
+	}
+
+	// Versioned REST API, routes are checked against the embedded OpenAPI document
+	if err := s.registerAPIRoutes(mux); err != nil {
+		return nil, fmt.Errorf("invalid API routes: %v", err)
+	}
+
+	return chain(mux, observeRequests, s.logRequests, recoverPanics), nil
+}
+
+// endpointHandler applies the CORS, method, rate limit and token checks of an endpoint to its handler
+func (s *Server) endpointHandler(e endpoint) http.Handler {
+	methods := e.Methods
+	if len(methods) == 0 {
+		methods = []string{"GET"}
+	}
+	errors := e.Errors
+	if errors == nil {
+		errors = plainErrors
+	}
+
+	middlewares := []middleware{withRoute(e.Pattern), s.withCORS(methods), allowMethods(methods, errors), s.rateLimit(e.Pattern, errors)}
+	if !e.Public {
+		middlewares = append(middlewares, s.requireToken(errors))
+	}
+	return chain(e.Handler, middlewares...)
+}
+
+// withCORS adds the headers of the CORS policy for the allowed methods to every response
+func (s *Server) withCORS(methods []string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.cors.apply(w, r, methods)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowMethods answers OPTIONS preflight requests and rejects methods other than the allowed ones
+func allowMethods(methods []string, errors errorWriter) middleware {
+	allow := strings.Join(append(append([]string(nil), methods...), "OPTIONS"), ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Handle OPTIONS preflight request
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			if !containsString(methods, r.Method) {
+				w.Header().Set("Allow", allow)
+				errors(w, http.StatusMethodNotAllowed, "Method not allowed")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireToken rejects requests without the configured token
+// Clients locked out after repeated failures get 429 even with the right token, so guessing teaches nothing
+func (s *Server) requireToken(errors errorWriter) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := s.trustedProxies.clientIP(r)
+			if wait := s.limiter.lockedOut(ip); wait > 0 {
+				tooManyRequests(w, wait, errors, "Too many failed authentication attempts")
+				return
+			}
+			if !s.checkToken(r) {
+				s.limiter.authFailed(ip)
+				errors(w, http.StatusUnauthorized, "Invalid or missing token")
+				return
+			}
+			s.limiter.authSucceeded(ip)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// recoverPanics turns a panicking handler into a 500 response instead of a dropped connection
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newStatusRecorder(w)
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err) // Deliberate abort, let net/http handle it
+			}
+			slog.Error("Panic serving request", "method", r.Method, "path", r.URL.Path, "panic", fmt.Sprint(err), "stack", string(debug.Stack()))
+			if !rec.wroteHeader {
+				http.Error(rec, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// statusRecorder remembers the status and body size written through a ResponseWriter
+// It keeps http.Flusher and http.Hijacker working for /live and /live/ws
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	route       string // Pattern of the endpoint that served the request, set by withRoute
+	wroteHeader bool
+}
+
+// newStatusRecorder wraps w, reusing it if it already is a statusRecorder
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	if rec, ok := w.(*statusRecorder); ok {
+		return rec
+	}
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush forwards to the underlying writer for streaming responses
+func (r *statusRecorder) Flush() {
+	r.wroteHeader = true
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer for WebSocket upgrades
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
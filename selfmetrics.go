@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds in seconds of the duration histograms, the Prometheus client defaults
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	buckets []uint64 // Observations <= durationBuckets[i]
+	count   uint64
+	sum     float64
+}
+
+// observe adds one observation in seconds
+func (h *histogram) observe(seconds float64) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(durationBuckets))
+	}
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// exporterMetrics describes the exporter itself: requests it serves, vnstat runs, parse errors, caches and pushes
+// Series are keyed by their rendered label set, e.g. route="/json",method="GET",code="200"
+type exporterMetrics struct {
+	mu sync.Mutex
+
+	start time.Time
+
+	httpRequests map[string]uint64
+	httpDuration map[string]*histogram
+
+	execs           map[string]uint64
+	execErrors      map[string]uint64
+	execDuration    map[string]*histogram
+	parseErrors     map[string]uint64
+	cacheRequests   map[string]uint64
+	pushAttempts    map[string]uint64
+	pushFailures    map[string]uint64
+	pushDuration    map[string]*histogram
+	pushLastSuccess map[string]time.Time
+}
+
+// selfMetrics collects the exporter metrics of the process, shared by the server, the backend and the exporters
+var selfMetrics = newExporterMetrics()
+
+// newExporterMetrics creates an empty set of exporter metrics
+func newExporterMetrics() *exporterMetrics {
+	return &exporterMetrics{
+		start:           time.Now(),
+		httpRequests:    make(map[string]uint64),
+		httpDuration:    make(map[string]*histogram),
+		execs:           make(map[string]uint64),
+		execErrors:      make(map[string]uint64),
+		execDuration:    make(map[string]*histogram),
+		parseErrors:     make(map[string]uint64),
+		cacheRequests:   make(map[string]uint64),
+		pushAttempts:    make(map[string]uint64),
+		pushFailures:    make(map[string]uint64),
+		pushDuration:    make(map[string]*histogram),
+		pushLastSuccess: make(map[string]time.Time),
+	}
+}
+
+// observeHistogram adds an observation to the histogram of a series, creating it
+func observeHistogram(histograms map[string]*histogram, labels string, seconds float64) {
+	h, ok := histograms[labels]
+	if !ok {
+		h = &histogram{}
+		histograms[labels] = h
+	}
+	h.observe(seconds)
+}
+
+// observeRequest records a served HTTP request; route is the pattern of the endpoint, "none" for unknown paths
+// Methods other than GET, POST, OPTIONS and HEAD are recorded as "other" so clients cannot create unbounded series
+func (m *exporterMetrics) observeRequest(route, method string, status int, duration time.Duration) {
+	switch method {
+	case "GET", "POST", "OPTIONS", "HEAD":
+	default:
+		method = "other"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	routeLabel := fmt.Sprintf("route=\"%s\"", escapeLabelValue(route))
+	m.httpRequests[fmt.Sprintf("%s,method=\"%s\",code=\"%d\"", routeLabel, escapeLabelValue(method), status)]++
+	observeHistogram(m.httpDuration, routeLabel, duration.Seconds())
+}
+
+// observeExec records a vnstat run; subcommand names what was asked, e.g. json or version
+func (m *exporterMetrics) observeExec(subcommand string, start time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := fmt.Sprintf("subcommand=\"%s\"", escapeLabelValue(subcommand))
+	m.execs[labels]++
+	if err != nil {
+		m.execErrors[labels]++
+	}
+	observeHistogram(m.execDuration, labels, time.Since(start).Seconds())
+}
+
+// parseError records JSON that could not be parsed; source is where it came from, e.g. vnstat or upstream
+func (m *exporterMetrics) parseError(source string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parseErrors[fmt.Sprintf("source=\"%s\"", escapeLabelValue(source))]++
+}
+
+// cacheLookup records a lookup in an in-memory cache (archive or readiness) and whether it was served from the cache
+func (m *exporterMetrics) cacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cacheRequests[fmt.Sprintf("cache=\"%s\",result=\"%s\"", escapeLabelValue(cache), result)]++
+}
+
+// observePush records one push cycle of an exporter (grafana, graphite or mqtt)
+func (m *exporterMetrics) observePush(target string, start time.Time, succeeded bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := fmt.Sprintf("target=\"%s\"", escapeLabelValue(target))
+	m.pushAttempts[labels]++
+	if succeeded {
+		m.pushLastSuccess[labels] = time.Now()
+	} else {
+		m.pushFailures[labels]++
+	}
+	observeHistogram(m.pushDuration, labels, time.Since(start).Seconds())
+}
+
+// stalePushes counts the push targets that have run and names those without a successful push within maxAge
+// A target that never succeeded is measured from the start of the process
+func (m *exporterMetrics) stalePushes(now time.Time, maxAge time.Duration) (targets int, stale []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, labels := range sortedKeys(m.pushAttempts) {
+		last, ok := m.pushLastSuccess[labels]
+		if !ok {
+			last = m.start
+		}
+		if now.Sub(last) > maxAge {
+			stale = append(stale, strings.TrimSuffix(strings.TrimPrefix(labels, "target=\""), "\""))
+		}
+	}
+	return len(m.pushAttempts), stale
+}
+
+// generatePrometheusMetrics renders the exporter, Go runtime and process metrics
+func (m *exporterMetrics) generatePrometheusMetrics() string {
+	var metrics strings.Builder
+
+	m.mu.Lock()
+	writeCounters(&metrics, "vnstat_exporter_http_requests_total", "HTTP requests served by route, method and status code", m.httpRequests)
+	writeHistograms(&metrics, "vnstat_exporter_http_request_duration_seconds", "Time to serve HTTP requests by route", m.httpDuration)
+	writeCounters(&metrics, "vnstat_exporter_vnstat_exec_total", "vnstat command runs by subcommand", m.execs)
+	writeCounters(&metrics, "vnstat_exporter_vnstat_exec_errors_total", "Failed vnstat command runs by subcommand", m.execErrors)
+	writeHistograms(&metrics, "vnstat_exporter_vnstat_exec_duration_seconds", "Duration of vnstat command runs by subcommand", m.execDuration)
+	writeCounters(&metrics, "vnstat_exporter_json_parse_errors_total", "JSON documents that could not be parsed by source", m.parseErrors)
+	writeCounters(&metrics, "vnstat_exporter_cache_requests_total", "Lookups in the in-memory caches by cache and result (hit or miss)", m.cacheRequests)
+	writeCounters(&metrics, "vnstat_exporter_push_attempts_total", "Push cycles of the exporters by target", m.pushAttempts)
+	writeCounters(&metrics, "vnstat_exporter_push_failures_total", "Failed push cycles of the exporters by target", m.pushFailures)
+	writeHistograms(&metrics, "vnstat_exporter_push_duration_seconds", "Duration of push cycles by target", m.pushDuration)
+	lastSuccess := make(map[string]float64, len(m.pushLastSuccess))
+	for labels, t := range m.pushLastSuccess {
+		lastSuccess[labels] = float64(t.UnixMilli()) / 1000
+	}
+	writeGauges(&metrics, "vnstat_exporter_push_last_success_timestamp_seconds", "Unix time of the last successful push by target", lastSuccess)
+	start := m.start
+	m.mu.Unlock()
+
+	writeRuntimeMetrics(&metrics, start)
+	return metrics.String()
+}
+
+// sortedKeys returns the label sets of a metric in a stable order
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeCounters renders a counter family, only its help and type while it has no series
+func writeCounters(metrics *strings.Builder, name, help string, series map[string]uint64) {
+	metrics.WriteString(fmt.Sprintf("# HELP %s %s\n", name, help))
+	metrics.WriteString(fmt.Sprintf("# TYPE %s counter\n", name))
+	for _, labels := range sortedKeys(series) {
+		metrics.WriteString(fmt.Sprintf("%s{%s} %d\n", name, labels, series[labels]))
+	}
+}
+
+// writeGauges renders a gauge family
+func writeGauges(metrics *strings.Builder, name, help string, series map[string]float64) {
+	metrics.WriteString(fmt.Sprintf("# HELP %s %s\n", name, help))
+	metrics.WriteString(fmt.Sprintf("# TYPE %s gauge\n", name))
+	for _, labels := range sortedKeys(series) {
+		metrics.WriteString(fmt.Sprintf("%s{%s} %s\n", name, labels, formatMetricValue(series[labels])))
+	}
+}
+
+// writeHistograms renders a histogram family with its cumulative buckets, sum and count
+func writeHistograms(metrics *strings.Builder, name, help string, series map[string]*histogram) {
+	metrics.WriteString(fmt.Sprintf("# HELP %s %s\n", name, help))
+	metrics.WriteString(fmt.Sprintf("# TYPE %s histogram\n", name))
+	for _, labels := range sortedKeys(series) {
+		h := series[labels]
+		for i, bound := range durationBuckets {
+			metrics.WriteString(fmt.Sprintf("%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatMetricValue(bound), h.buckets[i]))
+		}
+		metrics.WriteString(fmt.Sprintf("%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count))
+		metrics.WriteString(fmt.Sprintf("%s_sum{%s} %s\n", name, labels, formatMetricValue(h.sum)))
+		metrics.WriteString(fmt.Sprintf("%s_count{%s} %d\n", name, labels, h.count))
+	}
+}
+
+// writeSample renders a metric family with one unlabeled sample
+func writeSample(metrics *strings.Builder, name, kind, help string, value float64) {
+	metrics.WriteString(fmt.Sprintf("# HELP %s %s\n", name, help))
+	metrics.WriteString(fmt.Sprintf("# TYPE %s %s\n", name, kind))
+	metrics.WriteString(fmt.Sprintf("%s %s\n", name, formatMetricValue(value)))
+}
+
+// formatMetricValue renders a sample value in plain decimal notation
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// writeRuntimeMetrics renders the go_* and process_* metrics of the standard Prometheus client
+func writeRuntimeMetrics(metrics *strings.Builder, start time.Time) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	metrics.WriteString("# HELP go_info Information about the Go environment\n")
+	metrics.WriteString("# TYPE go_info gauge\n")
+	metrics.WriteString(fmt.Sprintf("go_info{version=\"%s\"} 1\n", escapeLabelValue(runtime.Version())))
+	writeSample(metrics, "go_goroutines", "gauge", "Number of goroutines that currently exist", float64(runtime.NumGoroutine()))
+	writeSample(metrics, "go_threads", "gauge", "Number of OS threads created", float64(threads))
+	writeSample(metrics, "go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use", float64(mem.Alloc))
+	writeSample(metrics, "go_memstats_heap_inuse_bytes", "gauge", "Number of heap bytes that are in use", float64(mem.HeapInuse))
+	writeSample(metrics, "go_memstats_sys_bytes", "gauge", "Number of bytes obtained from the system", float64(mem.Sys))
+	writeSample(metrics, "go_gc_cycles_total", "counter", "Number of completed GC cycles", float64(mem.NumGC))
+	writeSample(metrics, "go_gc_pause_seconds_total", "counter", "Total time the world was stopped for GC", float64(mem.PauseTotalNs)/1e9)
+
+	writeSample(metrics, "process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds", float64(start.Unix()))
+	if cpu, rss, ok := readProcessStat(); ok {
+		writeSample(metrics, "process_cpu_seconds_total", "counter", "Total user and system CPU time spent in seconds", cpu)
+		writeSample(metrics, "process_resident_memory_bytes", "gauge", "Resident memory size in bytes", rss)
+	}
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		writeSample(metrics, "process_open_fds", "gauge", "Number of open file descriptors", float64(len(fds)))
+	}
+}
+
+// readProcessStat reads the CPU time and resident memory of the process from /proc/self/stat (Linux only)
+func readProcessStat() (cpuSeconds, rssBytes float64, ok bool) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, 0, false
+	}
+	// The command name is in parentheses and may contain spaces, the fields follow the last ")"
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return 0, 0, false
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	// After the name: state is field 3 of proc(5), utime 14, stime 15 and rss 24
+	if len(fields) < 22 {
+		return 0, 0, false
+	}
+	utime, err1 := strconv.ParseFloat(fields[11], 64)
+	stime, err2 := strconv.ParseFloat(fields[12], 64)
+	rss, err3 := strconv.ParseFloat(fields[21], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, 0, false
+	}
+	const clockTicks = 100 // USER_HZ, fixed at 100 on Linux
+	return (utime + stime) / clockTicks, rss * float64(os.Getpagesize()), true
+}
+
+// handleSelfMetrics serves only the exporter metrics, on the separate -self-metrics-addr listener
+func handleSelfMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(selfMetrics.generatePrometheusMetrics()))
+}
+
+// observeRequests records every request in the HTTP metrics, labeled with the route its endpoint set
+func observeRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		route := rec.route
+		if route == "" {
+			route = "none"
+		}
+		selfMetrics.observeRequest(route, r.Method, rec.status, time.Since(start))
+	})
+}
+
+// withRoute tells the outer request logging and metrics which endpoint pattern served the request
+func withRoute(pattern string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := newStatusRecorder(w)
+			rec.route = pattern
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
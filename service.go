@@ -4,12 +4,19 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
+	"time"
 )
 
 // VnstatService wraps vnstat command execution
 type VnstatService struct {
-	interfaceName string // Network interface name to query
+	interfaceName string             // Network interface name to query
+	netDev        *NetDevSampler     // Optional kernel counter sampler for live metrics
+	collector     *Collector         // Built-in collector used instead of vnstat when set
+	archive       *Archive           // Optional long-term archive merged into returned data
+	grouping      *InterfaceGrouping // Optional interface exclusion and aggregate groups
+	labels        *labelConfig       // Optional interface aliases and metric labels
 }
 
 // NewVnstatService creates a new VnstatService instance
@@ -19,8 +26,34 @@ func NewVnstatService(interfaceName string) *VnstatService {
 	}
 }
 
-// GetJSON executes vnstat --json command and returns JSON data
+// GetJSON returns the JSON data of the active backend, merged with archived history when the archive is enabled
+// and with excluded interfaces removed, interface groups added and aliases set when configured
 func (s *VnstatService) GetJSON() ([]byte, error) {
+	jsonData, err := s.fetchJSON()
+	if err != nil || (s.archive == nil && s.grouping == nil && s.labels == nil) {
+		return jsonData, err
+	}
+
+	data, err := parseVnstatData(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	if s.archive != nil {
+		s.archive.Merge(data)
+	}
+	if s.grouping != nil {
+		s.grouping.Apply(data)
+	}
+	s.labels.Apply(data)
+	return json.Marshal(data)
+}
+
+// fetchJSON executes vnstat --json command (or queries the built-in collector) and returns JSON data
+func (s *VnstatService) fetchJSON() ([]byte, error) {
+	if s.collector != nil {
+		return s.collector.JSON(s.interfaceName)
+	}
+
 	args := []string{"--json"}
 	if s.interfaceName != "" {
 		args = append(args, "-i", s.interfaceName)
@@ -31,7 +64,10 @@ func (s *VnstatService) GetJSON() ([]byte, error) {
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	err := cmd.Run()
+	selfMetrics.observeExec("json", start, err)
+	if err != nil {
 		// Check if command is not found
 		if _, ok := err.(*exec.Error); ok {
 			return nil, fmt.Errorf("vnstat is not installed or not in PATH: %v", err)
@@ -43,79 +79,209 @@ func (s *VnstatService) GetJSON() ([]byte, error) {
 	// Validate that the returned data is valid JSON
 	var jsonData interface{}
 	if err := json.Unmarshal(stdout.Bytes(), &jsonData); err != nil {
+		selfMetrics.parseError("vnstat")
 		return nil, fmt.Errorf("vnstat returned invalid JSON data: %v", err)
 	}
 
 	return stdout.Bytes(), nil
 }
 
-// executeCommand is a generic method to execute vnstat commands
-func (s *VnstatService) executeCommand(args []string) ([]byte, error) {
+// vnstatJSONModes maps granularities to the vnstat --json mode that outputs only that granularity
+var vnstatJSONModes = map[string]string{"fiveminute": "f", "hour": "h", "day": "d", "month": "m", "year": "y"}
+
+// StreamEntries calls each with the entries of one granularity per interface, one interface at a time:
+// vnstat output is decoded interface by interface, archived entries are merged per interface,
+// excluded interfaces are skipped and interface groups follow the real interfaces
+func (s *VnstatService) StreamEntries(granularity string, each func(name string, entries []TrafficEntry) error) error {
+	groups := s.grouping.newGroupEntries()
+	err := s.streamInterfaces(granularity, func(iface *InterfaceData) error {
+		if s.grouping.Excluded(iface.Name) {
+			return nil
+		}
+		entries, _ := iface.Traffic.Entries(granularity)
+		if s.archive != nil {
+			entries = mergeArchived(entries, s.archive.Entries(iface.Name, granularity))
+		}
+		groups.add(iface.Name, entries)
+		return each(iface.Name, entries)
+	})
+	if err != nil {
+		return err
+	}
+	return groups.each(each)
+}
+
+// streamInterfaces calls each with every interface of the active backend as it is read;
+// vnstat is asked for the given granularity only and its output is decoded one interface at a time
+func (s *VnstatService) streamInterfaces(granularity string, each func(*InterfaceData) error) error {
+	if s.collector != nil {
+		for _, name := range s.collector.InterfaceNames(s.interfaceName) {
+			data := s.collector.Data(name)
+			for i := range data.Interfaces {
+				if err := each(&data.Interfaces[i]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	args := []string{"--json", vnstatJSONModes[granularity], "0"}
 	if s.interfaceName != "" {
 		args = append(args, "-i", s.interfaceName)
 	}
 
 	cmd := exec.Command("vnstat", args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
+	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
 
-	if err := cmd.Run(); err != nil {
-		// Check if command is not found
-		if _, ok := err.(*exec.Error); ok {
-			return nil, fmt.Errorf("vnstat is not installed or not in PATH: %v", err)
-		}
-		// Command execution failed, return error message
-		return nil, fmt.Errorf("vnstat execution failed: %s, error: %v", stderr.String(), err)
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		selfMetrics.observeExec("json", start, err)
+		return fmt.Errorf("vnstat is not installed or not in PATH: %v", err)
 	}
 
-	return stdout.Bytes(), nil
+	var eachErr error
+	decodeErr := decodeInterfaces(stdout, func(iface *InterfaceData) error {
+		eachErr = each(iface)
+		return eachErr
+	})
+	if eachErr != nil {
+		// The consumer gave up (e.g. the client went away): stop vnstat instead of reading the rest
+		cmd.Process.Kill()
+	} else if decodeErr != nil {
+		// Let vnstat finish so a failed run is reported with its own error rather than as invalid JSON
+		io.Copy(io.Discard, stdout)
+	}
+	waitErr := cmd.Wait()
+
+	if eachErr != nil {
+		selfMetrics.observeExec("json", start, nil) // Stopped by the consumer, not a vnstat failure
+		return eachErr
+	}
+	selfMetrics.observeExec("json", start, waitErr)
+	if waitErr != nil {
+		return fmt.Errorf("vnstat execution failed: %s, error: %v", stderr.String(), waitErr)
+	}
+	if decodeErr != nil {
+		selfMetrics.parseError("vnstat")
+		return fmt.Errorf("vnstat returned invalid JSON data: %v", decodeErr)
+	}
+	return nil
+}
+
+// renderView renders a text view natively from the JSON data of the active backend
+func (s *VnstatService) renderView(view string, opts textOptions) ([]byte, error) {
+	jsonData, err := s.GetJSON()
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseVnstatData(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	return renderTextView(data, view, opts, time.Now())
+}
+
+// GetText returns the monthly text view
+func (s *VnstatService) GetText(opts textOptions) ([]byte, error) {
+	return s.renderView("monthly", opts)
+}
+
+// GetSummary returns the default summary text view
+func (s *VnstatService) GetSummary(opts textOptions) ([]byte, error) {
+	return s.renderView("summary", opts)
 }
 
-// GetText executes vnstat -m command and returns text data (monthly view)
-func (s *VnstatService) GetText() ([]byte, error) {
-	return s.executeCommand([]string{"-m"})
+// GetDaily returns the daily text view
+func (s *VnstatService) GetDaily(opts textOptions) ([]byte, error) {
+	return s.renderView("daily", opts)
 }
 
-// GetSummary executes vnstat command and returns default summary view
-func (s *VnstatService) GetSummary() ([]byte, error) {
-	return s.executeCommand([]string{})
+// GetHourly returns the hourly text view
+func (s *VnstatService) GetHourly(opts textOptions) ([]byte, error) {
+	return s.renderView("hourly", opts)
 }
 
-// GetDaily executes vnstat -d command and returns daily view
-func (s *VnstatService) GetDaily() ([]byte, error) {
-	return s.executeCommand([]string{"-d"})
+// GetWeekly returns the weekly text view
+func (s *VnstatService) GetWeekly(opts textOptions) ([]byte, error) {
+	return s.renderView("weekly", opts)
 }
 
-// GetHourly executes vnstat -h command and returns hourly view
-func (s *VnstatService) GetHourly() ([]byte, error) {
-	return s.executeCommand([]string{"-h"})
+// GetYearly returns the yearly text view
+func (s *VnstatService) GetYearly(opts textOptions) ([]byte, error) {
+	return s.renderView("yearly", opts)
+}
+
+// GetTop returns the top days text view
+func (s *VnstatService) GetTop(opts textOptions) ([]byte, error) {
+	return s.renderView("top", opts)
+}
+
+// GetOneline returns the one-line text output
+func (s *VnstatService) GetOneline(opts textOptions) ([]byte, error) {
+	return s.renderView("oneline", opts)
+}
+
+// EnableNetDevSampler starts sampling <procRoot>/net/dev every interval for live counter metrics
+func (s *VnstatService) EnableNetDevSampler(procRoot string, interval time.Duration) error {
+	var exclude []string
+	if s.grouping != nil {
+		exclude = s.grouping.exclude
+	}
+	sampler := NewNetDevSampler(procRoot, s.interfaceName, exclude)
+	if err := sampler.Sample(); err != nil {
+		return err
+	}
+	s.netDev = sampler
+	go sampler.Start(interval)
+	return nil
+}
+
+// GetNetDevCounters samples /proc/net/dev and returns monotonic per-interface counters
+// Returns nil if the sampler is not enabled
+func (s *VnstatService) GetNetDevCounters() (map[string]netDevCounters, error) {
+	if s.netDev == nil {
+		return nil, nil
+	}
+	if err := s.netDev.Sample(); err != nil {
+		return nil, err
+	}
+	return s.netDev.Snapshot(), nil
 }
 
-// GetWeekly executes vnstat -w command and returns weekly view
-func (s *VnstatService) GetWeekly() ([]byte, error) {
-	return s.executeCommand([]string{"-w"})
+// SetInterfaceGrouping hides excluded interfaces and adds interface groups to the returned data
+func (s *VnstatService) SetInterfaceGrouping(grouping *InterfaceGrouping) {
+	s.grouping = grouping
 }
 
-// GetYearly executes vnstat -y command and returns yearly view
-func (s *VnstatService) GetYearly() ([]byte, error) {
-	return s.executeCommand([]string{"-y"})
+// SetLabelConfig sets interface aliases on the returned data and labels used for metrics
+func (s *VnstatService) SetLabelConfig(labels *labelConfig) {
+	s.labels = labels
 }
 
-// GetTop executes vnstat -t command and returns top traffic interfaces
-func (s *VnstatService) GetTop() ([]byte, error) {
-	return s.executeCommand([]string{"-t"})
+// UseCollector switches the service to the built-in collector backend
+func (s *VnstatService) UseCollector(collector *Collector) {
+	s.collector = collector
 }
 
-// GetOneline executes vnstat --oneline command and returns one-line output
-func (s *VnstatService) GetOneline() ([]byte, error) {
-	return s.executeCommand([]string{"--oneline"})
+// EnableArchive snapshots backend data into archive every interval and merges it into GetJSON
+func (s *VnstatService) EnableArchive(archive *Archive, interval time.Duration) {
+	s.archive = archive
+	go archive.Start(interval, s.fetchJSON)
 }
 
 // CheckVnstatInstalled checks if vnstat is installed
 func (s *VnstatService) CheckVnstatInstalled() error {
 	cmd := exec.Command("vnstat", "--version")
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	err := cmd.Run()
+	selfMetrics.observeExec("version", start, err)
+	if err != nil {
 		return fmt.Errorf("vnstat is not installed or not in PATH")
 	}
 	return nil
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// trafficSummary is the /summary.json response
+type trafficSummary struct {
+	Units      string             `json:"units"`
+	Rate       string             `json:"rate"`
+	Generated  int64              `json:"generated"`
+	Interfaces []interfaceSummary `json:"interfaces"`
+}
+
+// interfaceSummary is the all-time, current month and today traffic of one interface
+type interfaceSummary struct {
+	Name        string            `json:"name"`
+	Alias       string            `json:"alias,omitempty"`
+	DisplayName string            `json:"display_name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Total       periodSummary     `json:"total"`
+	Month       *periodSummary    `json:"month,omitempty"`
+	Today       *periodSummary    `json:"today,omitempty"`
+
+	Forecast *forecastSummary `json:"forecast,omitempty"`
+}
+
+// periodSummary holds raw byte counts next to their formatted strings
+// Rate is the average over the elapsed part of the period, in the requested rate unit per second
+type periodSummary struct {
+	Period         string  `json:"period,omitempty"`
+	Rx             uint64  `json:"rx"`
+	Tx             uint64  `json:"tx"`
+	Total          uint64  `json:"total"`
+	RxFormatted    string  `json:"rx_formatted"`
+	TxFormatted    string  `json:"tx_formatted"`
+	TotalFormatted string  `json:"total_formatted"`
+	Rate           float64 `json:"rate"`
+	RateFormatted  string  `json:"rate_formatted"`
+}
+
+// newPeriodSummary formats the traffic of a period that started at start and ends at end
+func newPeriodSummary(period string, rx, tx uint64, start, end, now time.Time, units unitOptions) periodSummary {
+	if end.After(now) {
+		end = now
+	}
+	bytesPerSecond := 0.0
+	if seconds := end.Sub(start).Seconds(); seconds > 0 {
+		bytesPerSecond = float64(rx+tx) / seconds
+	}
+
+	return periodSummary{
+		Period:         period,
+		Rx:             rx,
+		Tx:             tx,
+		Total:          rx + tx,
+		RxFormatted:    units.Volume(float64(rx)),
+		TxFormatted:    units.Volume(float64(tx)),
+		TotalFormatted: units.Volume(float64(rx + tx)),
+		Rate:           units.RateValue(bytesPerSecond),
+		RateFormatted:  units.RateString(bytesPerSecond),
+	}
+}
+
+// buildTrafficSummary summarizes every interface with the given formatting options
+func buildTrafficSummary(data *VnstatData, units unitOptions, cfg forecastConfig, labels *labelConfig, now time.Time) trafficSummary {
+	summary := trafficSummary{
+		Units:      units.Units,
+		Rate:       units.Rate,
+		Generated:  now.Unix(),
+		Interfaces: []interfaceSummary{},
+	}
+
+	for _, iface := range data.Interfaces {
+		created := now // Unknown creation time yields no total rate
+		if iface.Created.Timestamp > 0 {
+			created = time.Unix(iface.Created.Timestamp, 0)
+		}
+		item := interfaceSummary{
+			Name:        iface.Name,
+			Alias:       iface.Alias,
+			DisplayName: interfaceDisplayName(&iface),
+			Total:       newPeriodSummary("", iface.Traffic.Total.Rx, iface.Traffic.Total.Tx, created, now, now, units),
+		}
+
+		if month := iface.Traffic.LatestMonth(); month != nil {
+			start := month.Start()
+			period := newPeriodSummary(month.Date.String(), month.Rx, month.Tx, start, start.AddDate(0, 1, 0), now, units)
+			item.Month = &period
+		}
+		if today := iface.Traffic.Today(); today != nil {
+			start := today.Start()
+			period := newPeriodSummary(today.Date.String(), today.Rx, today.Tx, start, start.AddDate(0, 0, 1), now, units)
+			item.Today = &period
+		}
+
+		if extra := labels.seriesLabels(iface.Name); len(extra) > 0 {
+			item.Labels = extra
+		}
+
+		if forecast := forecastTraffic(iface.Traffic, cfg, now); forecast != nil {
+			item.Forecast = forecast.summary(units, now)
+		}
+
+		summary.Interfaces = append(summary.Interfaces, item)
+	}
+
+	return summary
+}
+
+// handleSummaryJSON handles /summary.json endpoint, returns per-interface totals with raw and formatted values
+// Query options: units (iec|si|bytes), rate (bits|bytes)
+func (s *Server) handleSummaryJSON(w http.ResponseWriter, r *http.Request) {
+	units, err := parseUnitOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jsonData, err := s.service.GetJSON()
+	if err != nil {
+		slog.Error("Failed to get JSON data for summary", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	data, err := parseVnstatData(jsonData)
+	if err != nil {
+		slog.Error("Failed to parse JSON data", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(buildTrafficSummary(data, units, *s.forecastConfig(), s.service.labels, time.Now()))
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// textViews maps view names to native text renderers
+var textViews = map[string]func(*textRenderer, *strings.Builder, *InterfaceData){
+	"summary": renderSummaryView,
+	"daily":   renderDailyView,
+	"hourly":  renderHourlyView,
+	"weekly":  renderWeeklyView,
+	"monthly": renderMonthlyView,
+	"yearly":  renderYearlyView,
+	"top":     renderTopView,
+	"oneline": renderOnelineView,
+}
+
+// textColumns are the selectable table columns in default order
+var textColumns = []string{"rx", "tx", "total", "rate"}
+
+// textOptions controls native text rendering
+type textOptions struct {
+	unitOptions
+	Columns []string // Table columns to show, in order
+	Rows    int      // Maximum rows per table (0 uses the view default)
+	ASCII   bool     // Draw tables with ASCII characters only
+
+	Forecast *forecastConfig // Show the billing cycle forecast below monthly tables when set
+}
+
+// defaultTextOptions returns the options used when no query parameters are given
+func defaultTextOptions() textOptions {
+	return textOptions{
+		unitOptions: defaultUnitOptions(),
+		Columns:     textColumns,
+	}
+}
+
+// parseTextOptions reads text rendering options from query parameters
+// Query options: units (iec|si|bytes), rate (bits|bytes), columns (comma-separated rx,tx,total,rate), rows (1-1000), ascii (1|true)
+func parseTextOptions(query url.Values) (textOptions, error) {
+	opts := defaultTextOptions()
+
+	units, err := parseUnitOptions(query)
+	if err != nil {
+		return opts, err
+	}
+	opts.unitOptions = units
+
+	if columns := query.Get("columns"); columns != "" {
+		opts.Columns = nil
+		for _, column := range strings.Split(columns, ",") {
+			column = strings.TrimSpace(column)
+			if !containsString(textColumns, column) {
+				return opts, fmt.Errorf("invalid column: %q (must be one of %s)", column, strings.Join(textColumns, ", "))
+			}
+			if !containsString(opts.Columns, column) {
+				opts.Columns = append(opts.Columns, column)
+			}
+		}
+	}
+
+	rows, err := queryInt(query.Get("rows"), 0, 1, 1000)
+	if err != nil {
+		return opts, fmt.Errorf("invalid rows: %v", err)
+	}
+	opts.Rows = rows
+
+	switch strings.ToLower(query.Get("ascii")) {
+	case "", "0", "false":
+	case "1", "true":
+		opts.ASCII = true
+	default:
+		return opts, fmt.Errorf("invalid ascii: %q (must be true or false)", query.Get("ascii"))
+	}
+
+	return opts, nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// textRenderer renders text views with fixed options and reference time
+type textRenderer struct {
+	opts textOptions
+	now  time.Time
+}
+
+// textRow is one line of a traffic table
+type textRow struct {
+	label   string
+	rx, tx  uint64
+	seconds float64 // Period length used for the average rate (0 hides the rate)
+}
+
+// renderTextView renders a vnstat-style text view from parsed JSON data
+func renderTextView(data *VnstatData, view string, opts textOptions, now time.Time) ([]byte, error) {
+	render, ok := textViews[view]
+	if !ok {
+		return nil, fmt.Errorf("unsupported text view: %s", view)
+	}
+	if len(data.Interfaces) == 0 {
+		return nil, fmt.Errorf("no interfaces in database")
+	}
+
+	r := &textRenderer{opts: opts, now: now}
+	var b strings.Builder
+	for i := range data.Interfaces {
+		if i > 0 && view != "oneline" {
+			b.WriteString("\n")
+		}
+		render(r, &b, &data.Interfaces[i])
+	}
+	return []byte(b.String()), nil
+}
+
+// volume formats a byte count in the configured units
+func (r *textRenderer) volume(bytes uint64) string {
+	return r.opts.Volume(float64(bytes))
+}
+
+// rate formats the average rate of bytes transferred over seconds
+func (r *textRenderer) rate(bytes uint64, seconds float64) string {
+	perSecond := 0.0
+	if seconds > 0 {
+		perSecond = float64(bytes) / seconds
+	}
+	return r.opts.RateString(perSecond)
+}
+
+// rowLimit returns the number of rows to show for a view with the given default
+func (r *textRenderer) rowLimit(defaultRows int) int {
+	if r.opts.Rows > 0 {
+		return r.opts.Rows
+	}
+	return defaultRows
+}
+
+// table writes a table with the configured columns, sized to fit its content
+func (r *textRenderer) table(b *strings.Builder, title, column string, rows []textRow) {
+	vertical, horizontal, cross := "│", "─", "┼"
+	if r.opts.ASCII {
+		vertical, horizontal, cross = "|", "-", "+"
+	}
+
+	headers := map[string]string{"rx": "rx", "tx": "tx", "total": "total", "rate": "avg. rate"}
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		for _, name := range r.opts.Columns {
+			var cell string
+			switch name {
+			case "rx":
+				cell = r.volume(row.rx)
+			case "tx":
+				cell = r.volume(row.tx)
+			case "total":
+				cell = r.volume(row.rx + row.tx)
+			case "rate":
+				if row.seconds > 0 {
+					cell = r.rate(row.rx+row.tx, row.seconds)
+				}
+			}
+			cells[i] = append(cells[i], cell)
+		}
+	}
+
+	labelWidth := utf8.RuneCountInString(column)
+	for _, row := range rows {
+		labelWidth = max(labelWidth, utf8.RuneCountInString(row.label))
+	}
+	widths := make([]int, len(r.opts.Columns))
+	for j, name := range r.opts.Columns {
+		widths[j] = utf8.RuneCountInString(headers[name])
+		for i := range cells {
+			widths[j] = max(widths[j], utf8.RuneCountInString(cells[i][j]))
+		}
+	}
+
+	line := func(label string, values []string) {
+		b.WriteString("     " + padRight(label, labelWidth+2))
+		for j, value := range values {
+			if j > 0 {
+				b.WriteString(" " + vertical)
+			}
+			b.WriteString(" " + padLeft(value, widths[j]))
+		}
+		b.WriteString("\n")
+	}
+	separator := "     " + strings.Repeat(horizontal, labelWidth+2)
+	for j, width := range widths {
+		if j > 0 {
+			separator += horizontal + cross
+		}
+		separator += strings.Repeat(horizontal, width+1)
+	}
+	separator += "\n"
+
+	fmt.Fprintf(b, " %s\n\n", title)
+	headerValues := make([]string, len(r.opts.Columns))
+	for j, name := range r.opts.Columns {
+		headerValues[j] = headers[name]
+	}
+	line(column, headerValues)
+	b.WriteString(separator)
+	if len(rows) == 0 {
+		b.WriteString("     no data available\n")
+	}
+	for i, row := range rows {
+		line(row.label, cells[i])
+	}
+	b.WriteString(separator)
+}
+
+// padRight pads s with spaces to width runes
+func padRight(s string, width int) string {
+	return s + strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s)))
+}
+
+// padLeft right-aligns s to width runes
+func padLeft(s string, width int) string {
+	return strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s))) + s
+}
+
+// entryRows converts entries to table rows; the current period's rate uses the elapsed time
+func (r *textRenderer) entryRows(entries []TrafficEntry, label func(time.Time) string, period func(time.Time) time.Time) []textRow {
+	rows := make([]textRow, 0, len(entries))
+	for _, entry := range entries {
+		start := entry.Start()
+		rows = append(rows, textRow{
+			label:   label(start),
+			rx:      entry.Rx,
+			tx:      entry.Tx,
+			seconds: r.elapsed(start, period(start)),
+		})
+	}
+	return rows
+}
+
+// elapsed returns the seconds between start and end, capped at the reference time
+func (r *textRenderer) elapsed(start, end time.Time) float64 {
+	if end.After(r.now) {
+		end = r.now
+	}
+	return end.Sub(start).Seconds()
+}
+
+// lastEntries returns at most n trailing entries
+func lastEntries(entries []TrafficEntry, n int) []TrafficEntry {
+	if len(entries) > n {
+		return entries[len(entries)-n:]
+	}
+	return entries
+}
+
+func addHour(t time.Time) time.Time  { return t.Add(time.Hour) }
+func addDay(t time.Time) time.Time   { return t.AddDate(0, 0, 1) }
+func addMonth(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+func addYear(t time.Time) time.Time  { return t.AddDate(1, 0, 0) }
+
+func dayLabel(t time.Time) string   { return t.Format("2006-01-02") }
+func hourLabel(t time.Time) string  { return t.Format("2006-01-02 15:00") }
+func monthLabel(t time.Time) string { return t.Format("2006-01") }
+func yearLabel(t time.Time) string  { return t.Format("2006") }
+
+// renderSummaryView renders the default view: recent months, recent days and the all-time total
+func renderSummaryView(r *textRenderer, b *strings.Builder, iface *InterfaceData) {
+	total := iface.Traffic.Total
+	fmt.Fprintf(b, " %s since %s\n\n", interfaceDisplayName(iface), iface.Created.Date.String())
+	fmt.Fprintf(b, "          rx:  %s      tx:  %s      total:  %s\n\n", r.volume(total.Rx), r.volume(total.Tx), r.volume(total.Rx+total.Tx))
+
+	r.table(b, "monthly", "month", r.entryRows(lastEntries(iface.Traffic.Month, r.rowLimit(2)), monthLabel, addMonth))
+	r.renderForecastLines(b, iface.Traffic)
+	b.WriteString("\n")
+	r.table(b, "daily", "day", r.entryRows(lastEntries(iface.Traffic.Day, r.rowLimit(2)), dayLabel, addDay))
+}
+
+// renderDailyView renders the last 30 days
+func renderDailyView(r *textRenderer, b *strings.Builder, iface *InterfaceData) {
+	rows := r.entryRows(lastEntries(iface.Traffic.Day, r.rowLimit(30)), dayLabel, addDay)
+	r.table(b, interfaceDisplayName(iface)+"  /  daily", "day", rows)
+}
+
+// renderHourlyView renders the last 24 hours
+func renderHourlyView(r *textRenderer, b *strings.Builder, iface *InterfaceData) {
+	rows := r.entryRows(lastEntries(iface.Traffic.Hour, r.rowLimit(24)), hourLabel, addHour)
+	r.table(b, interfaceDisplayName(iface)+"  /  hourly", "hour", rows)
+}
+
+// renderMonthlyView renders the last 12 months
+func renderMonthlyView(r *textRenderer, b *strings.Builder, iface *InterfaceData) {
+	rows := r.entryRows(lastEntries(iface.Traffic.Month, r.rowLimit(12)), monthLabel, addMonth)
+	r.table(b, interfaceDisplayName(iface)+"  /  monthly", "month", rows)
+	r.renderForecastLines(b, iface.Traffic)
+}
+
+// renderYearlyView renders all years
+func renderYearlyView(r *textRenderer, b *strings.Builder, iface *InterfaceData) {
+	rows := r.entryRows(lastEntries(iface.Traffic.Year, r.rowLimit(len(iface.Traffic.Year))), yearLabel, addYear)
+	r.table(b, interfaceDisplayName(iface)+"  /  yearly", "year", rows)
+}
+
+// renderTopView renders the top days ranked by total traffic
+func renderTopView(r *textRenderer, b *strings.Builder, iface *InterfaceData) {
+	top := append([]TrafficEntry(nil), iface.Traffic.Top...)
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Total() > top[j].Total() })
+	if limit := r.rowLimit(10); len(top) > limit {
+		top = top[:limit]
+	}
+
+	rows := r.entryRows(top, dayLabel, addDay)
+	for i := range rows {
+		rows[i].label = fmt.Sprintf("%2d  %s", i+1, rows[i].label)
+	}
+	r.table(b, fmt.Sprintf("%s  /  top %d", interfaceDisplayName(iface), len(rows)), "    day", rows)
+}
+
+// renderWeeklyView renders the last 7 days, the previous week and the current week (weeks start on Monday)
+func renderWeeklyView(r *textRenderer, b *strings.Builder, iface *InterfaceData) {
+	today := time.Date(r.now.Year(), r.now.Month(), r.now.Day(), 0, 0, 0, 0, r.now.Location())
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+
+	periods := []struct {
+		label      string
+		start, end time.Time
+	}{
+		{"last 7 days", today.AddDate(0, 0, -6), today.AddDate(0, 0, 1)},
+		{"last week", weekStart.AddDate(0, 0, -7), weekStart},
+		{"current week", weekStart, weekStart.AddDate(0, 0, 7)},
+	}
+
+	rows := make([]textRow, 0, len(periods))
+	for _, period := range periods {
+		row := textRow{label: period.label, seconds: r.elapsed(period.start, period.end)}
+		for _, entry := range iface.Traffic.Day {
+			start := entry.Start()
+			if !start.Before(period.start) && start.Before(period.end) {
+				row.rx += entry.Rx
+				row.tx += entry.Tx
+			}
+		}
+		rows = append(rows, row)
+	}
+	r.table(b, interfaceDisplayName(iface)+"  /  weekly", "", rows)
+}
+
+// renderOnelineView renders vnstat's semicolon-separated oneline format (version 1)
+// 1;iface;today;rx;tx;total;rate;month;rx;tx;total;rate;all rx;all tx;all total
+func renderOnelineView(r *textRenderer, b *strings.Builder, iface *InterfaceData) {
+	fields := []string{"1", iface.Name}
+
+	appendPeriod := func(entry *TrafficEntry, label func(time.Time) string, next func(time.Time) time.Time) {
+		if entry == nil {
+			fields = append(fields, label(r.now), r.volume(0), r.volume(0), r.volume(0), r.rate(0, 0))
+			return
+		}
+		start := entry.Start()
+		fields = append(fields, label(start), r.volume(entry.Rx), r.volume(entry.Tx), r.volume(entry.Total()),
+			r.rate(entry.Total(), r.elapsed(start, next(start))))
+	}
+	appendPeriod(iface.Traffic.Today(), dayLabel, addDay)
+	appendPeriod(iface.Traffic.LatestMonth(), monthLabel, addMonth)
+
+	total := iface.Traffic.Total
+	fields = append(fields, r.volume(total.Rx), r.volume(total.Tx), r.volume(total.Rx+total.Tx))
+	b.WriteString(strings.Join(fields, ";") + "\n")
+}
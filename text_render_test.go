@@ -0,0 +1,265 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// localUTC makes local time UTC for the rest of the test, so period boundaries do not depend on the time zone of the machine
+func localUTC(t *testing.T) {
+	t.Helper()
+	local := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = local })
+}
+
+// textTestData returns testVnstatJSON with its days as the top list; entry labels are rendered in UTC
+func textTestData(t *testing.T) *VnstatData {
+	t.Helper()
+	localUTC(t)
+
+	data, err := parseVnstatData([]byte(testVnstatJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Interfaces[0].Traffic.Top = data.Interfaces[0].Traffic.Day
+	return data
+}
+
+func TestParseTextOptions(t *testing.T) {
+	tests := []struct {
+		query   string
+		columns []string
+		rows    int
+		ascii   bool
+		err     string
+	}{
+		{"", textColumns, 0, false, ""},
+		{"columns=total, rx,total&rows=5&ascii=1", []string{"total", "rx"}, 5, true, ""},
+		{"ascii=TRUE", textColumns, 0, true, ""},
+		{"ascii=false&rows=1000", textColumns, 1000, false, ""},
+		{"columns=rx,errors", nil, 0, false, "invalid column"},
+		{"rows=0", nil, 0, false, "invalid rows"},
+		{"rows=1001", nil, 0, false, "invalid rows"},
+		{"ascii=yes", nil, 0, false, "invalid ascii"},
+		{"units=kb", nil, 0, false, "invalid units"},
+	}
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts, err := parseTextOptions(query)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: error = %v, want %q", tt.query, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if !slices.Equal(opts.Columns, tt.columns) || opts.Rows != tt.rows || opts.ASCII != tt.ascii {
+			t.Errorf("%q: columns %v, rows %d, ascii %v", tt.query, opts.Columns, opts.Rows, opts.ASCII)
+		}
+	}
+}
+
+func TestRenderTextView(t *testing.T) {
+	data := textTestData(t)
+	now := time.Date(2026, 10, 19, 14, 40, 0, 0, time.UTC) // A Monday
+
+	tests := []struct {
+		view  string
+		query string
+		want  string
+	}{
+		{"summary", "", `
+ eth0 since 2025-01-03
+
+          rx:  7.45 GiB      tx:  1.86 GiB      total:  9.31 GiB
+
+ monthly
+
+     month           rx │       tx │    total │ avg. rate
+     ───────────────────┼──────────┼──────────┼──────────
+     2026-09   85.8 MiB │ 28.6 MiB │  114 MiB │ 370 bit/s
+     2026-10   47.7 MiB │ 19.1 MiB │ 66.8 MiB │ 348 bit/s
+     ───────────────────┼──────────┼──────────┼──────────
+
+ daily
+
+     day                rx │      tx │    total │ avg. rate
+     ──────────────────────┼─────────┼──────────┼──────────
+     2026-10-18   2.86 MiB │ 977 KiB │ 3.81 MiB │ 370 bit/s
+     2026-10-19   1.91 MiB │ 879 KiB │ 2.77 MiB │ 439 bit/s
+     ──────────────────────┼─────────┼──────────┼──────────
+`},
+		{"daily", "", `
+ eth0  /  daily
+
+     day                rx │      tx │    total │ avg. rate
+     ──────────────────────┼─────────┼──────────┼──────────
+     2026-10-18   2.86 MiB │ 977 KiB │ 3.81 MiB │ 370 bit/s
+     2026-10-19   1.91 MiB │ 879 KiB │ 2.77 MiB │ 439 bit/s
+     ──────────────────────┼─────────┼──────────┼──────────
+`},
+		{"hourly", "", `
+ eth0  /  hourly
+
+     hour                     rx │       tx │   total │ avg. rate
+     ────────────────────────────┼──────────┼─────────┼──────────
+     2026-10-19 14:00   97.7 KiB │ 48.8 KiB │ 146 KiB │ 500 bit/s
+     ────────────────────────────┼──────────┼─────────┼──────────
+`},
+		{"weekly", "", `
+ eth0  /  weekly
+
+                          rx │       tx │    total │ avg. rate
+     ────────────────────────┼──────────┼──────────┼──────────
+     last 7 days    4.77 MiB │ 1.81 MiB │ 6.58 MiB │  97 bit/s
+     last week      2.86 MiB │  977 KiB │ 3.81 MiB │  53 bit/s
+     current week   1.91 MiB │  879 KiB │ 2.77 MiB │ 439 bit/s
+     ────────────────────────┼──────────┼──────────┼──────────
+`},
+		{"monthly", "", `
+ eth0  /  monthly
+
+     month           rx │       tx │    total │ avg. rate
+     ───────────────────┼──────────┼──────────┼──────────
+     2026-09   85.8 MiB │ 28.6 MiB │  114 MiB │ 370 bit/s
+     2026-10   47.7 MiB │ 19.1 MiB │ 66.8 MiB │ 348 bit/s
+     ───────────────────┼──────────┼──────────┼──────────
+`},
+		{"yearly", "", `
+ eth0  /  yearly
+
+     year        rx │       tx │   total │ avg. rate
+     ───────────────┼──────────┼─────────┼──────────
+     2026   134 MiB │ 47.7 MiB │ 181 MiB │  60 bit/s
+     ───────────────┼──────────┼─────────┼──────────
+`},
+		{"top", "", `
+ eth0  /  top 2
+
+         day                rx │      tx │    total │ avg. rate
+     ──────────────────────────┼─────────┼──────────┼──────────
+      1  2026-10-18   2.86 MiB │ 977 KiB │ 3.81 MiB │ 370 bit/s
+      2  2026-10-19   1.91 MiB │ 879 KiB │ 2.77 MiB │ 439 bit/s
+     ──────────────────────────┼─────────┼──────────┼──────────
+`},
+		{"oneline", "", `
+1;eth0;2026-10-19;1.91 MiB;879 KiB;2.77 MiB;439 bit/s;2026-10;47.7 MiB;19.1 MiB;66.8 MiB;348 bit/s;7.45 GiB;1.86 GiB;9.31 GiB
+`},
+		{"daily", "ascii=1", `
+ eth0  /  daily
+
+     day                rx |      tx |    total | avg. rate
+     ----------------------+---------+----------+----------
+     2026-10-18   2.86 MiB | 977 KiB | 3.81 MiB | 370 bit/s
+     2026-10-19   1.91 MiB | 879 KiB | 2.77 MiB | 439 bit/s
+     ----------------------+---------+----------+----------
+`},
+		// Rows keeps the latest periods, but the busiest days of the top list
+		{"monthly", "rows=1", `
+ eth0  /  monthly
+
+     month           rx │       tx │    total │ avg. rate
+     ───────────────────┼──────────┼──────────┼──────────
+     2026-10   47.7 MiB │ 19.1 MiB │ 66.8 MiB │ 348 bit/s
+     ───────────────────┼──────────┼──────────┼──────────
+`},
+		{"top", "rows=1", `
+ eth0  /  top 1
+
+         day                rx │      tx │    total │ avg. rate
+     ──────────────────────────┼─────────┼──────────┼──────────
+      1  2026-10-18   2.86 MiB │ 977 KiB │ 3.81 MiB │ 370 bit/s
+     ──────────────────────────┼─────────┼──────────┼──────────
+`},
+		{"yearly", "columns=total,rx", `
+ eth0  /  yearly
+
+     year     total │      rx
+     ───────────────┼────────
+     2026   181 MiB │ 134 MiB
+     ───────────────┼────────
+`},
+		{"summary", "ascii=1&rows=1&columns=rate,tx", `
+ eth0 since 2025-01-03
+
+          rx:  7.45 GiB      tx:  1.86 GiB      total:  9.31 GiB
+
+ monthly
+
+     month     avg. rate |       tx
+     --------------------+---------
+     2026-10   348 bit/s | 19.1 MiB
+     --------------------+---------
+
+ daily
+
+     day          avg. rate |      tx
+     -----------------------+--------
+     2026-10-19   439 bit/s | 879 KiB
+     -----------------------+--------
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.view+" "+tt.query, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts, err := parseTextOptions(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderTextView(data, tt.view, opts, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.TrimPrefix(tt.want, "\n"); string(got) != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRenderTextViewInterfaces(t *testing.T) {
+	data := textTestData(t)
+	now := time.Date(2026, 10, 19, 14, 40, 0, 0, time.UTC)
+	opts := defaultTextOptions()
+
+	// Tables of several interfaces are separated by a blank line, oneline output is not
+	second := data.Interfaces[0]
+	second.Name, second.Alias = "wg0", "Büro"
+	second.Traffic.Hour = nil
+	data.Interfaces = append(data.Interfaces, second)
+
+	got, err := renderTextView(data, "hourly", opts, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := " Büro (wg0)  /  hourly\n\n" +
+		"     hour   rx │ tx │ total │ avg. rate\n" +
+		"     ──────────┼────┼───────┼──────────\n" +
+		"     no data available\n" +
+		"     ──────────┼────┼───────┼──────────\n"; !strings.HasSuffix(string(got), "──────────\n\n"+want) {
+		t.Errorf("got\n%s\nwant the eth0 table, a blank line and\n%s", got, want)
+	}
+	if got, err := renderTextView(data, "oneline", opts, now); err != nil || strings.Count(string(got), "\n") != 2 || strings.Contains(string(got), "\n\n") {
+		t.Errorf("oneline = %q, %v", got, err)
+	}
+
+	if _, err := renderTextView(&VnstatData{}, "daily", opts, now); err == nil || !strings.Contains(err.Error(), "no interfaces") {
+		t.Errorf("empty interface list: error = %v", err)
+	}
+	if _, err := renderTextView(data, "weekdays", opts, now); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("unknown view: error = %v", err)
+	}
+}
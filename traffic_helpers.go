@@ -1,5 +1,12 @@
 package main
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
 func extractLatestMonthData(months []interface{}) map[string]interface{} {
 	var latestMonthData map[string]interface{}
 	latestMonthKey := -1
@@ -39,3 +46,114 @@ func extractLatestMonthData(months []interface{}) map[string]interface{} {
 
 	return lastMonthData
 }
+
+// interfaceTraffic holds the headline counters of one interface
+type interfaceTraffic struct {
+	Name     string
+	TotalRx  float64
+	TotalTx  float64
+	MonthRx  float64
+	MonthTx  float64
+	TodayRx  float64
+	TodayTx  float64
+	HasTotal bool
+	HasMonth bool
+	HasToday bool
+}
+
+// extractInterfaceTraffic collects total, current month and today's counters for every interface in vnstat JSON data
+func extractInterfaceTraffic(data map[string]interface{}) ([]interfaceTraffic, bool) {
+	interfaces, ok := data["interfaces"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	var result []interfaceTraffic
+	for _, iface := range interfaces {
+		ifaceMap, ok := iface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		traffic, ok := ifaceMap["traffic"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		entry := interfaceTraffic{Name: fmt.Sprintf("%v", ifaceMap["name"])}
+
+		// Total traffic
+		if total, ok := traffic["total"].(map[string]interface{}); ok {
+			entry.TotalRx, entry.TotalTx, entry.HasTotal = extractRxTx(total)
+		}
+
+		// Monthly traffic
+		if month, ok := traffic["month"].([]interface{}); ok && len(month) > 0 {
+			if monthData := extractLatestMonthData(month); monthData != nil {
+				entry.MonthRx, entry.MonthTx, entry.HasMonth = extractRxTx(monthData)
+			}
+		}
+
+		// Today's traffic (from day array, last element is today)
+		if day, ok := traffic["day"].([]interface{}); ok && len(day) > 0 {
+			if dayData, ok := day[len(day)-1].(map[string]interface{}); ok {
+				entry.TodayRx, entry.TodayTx, entry.HasToday = extractRxTx(dayData)
+			}
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, true
+}
+
+// extractRxTx reads the rx and tx byte counters of a vnstat traffic entry
+func extractRxTx(entry map[string]interface{}) (float64, float64, bool) {
+	rx, rxOk := entry["rx"].(float64)
+	tx, txOk := entry["tx"].(float64)
+	return rx, tx, rxOk && txOk
+}
+
+// byteSizeUnits maps size suffixes to multipliers: SI for KB/MB/GB/TB, IEC for KiB/MiB/GiB/TiB
+var byteSizeUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"K":   1e3,
+	"KB":  1e3,
+	"M":   1e6,
+	"MB":  1e6,
+	"G":   1e9,
+	"GB":  1e9,
+	"T":   1e12,
+	"TB":  1e12,
+	"P":   1e15,
+	"PB":  1e15,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+	"PIB": 1 << 50,
+}
+
+// parseByteSize parses a size such as "500GB", "1.5TiB" or "1024" into bytes
+func parseByteSize(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	multiplier, ok := byteSizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q (use B, KB, MB, GB, TB, KiB, MiB, GiB or TiB)", s)
+	}
+
+	return value * multiplier, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// dashboardHTML is the single-page dashboard served at /ui, embedded so it works offline
+//
+//go:embed ui/index.html
+var dashboardHTML []byte
+
+// handleUI handles /ui endpoint, returns the embedded web dashboard
+// The page itself carries no data; it calls /json and /ui/config.json with the token from its URL
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dashboardHTML)
+}
+
+// handleUIConfig handles /ui/config.json endpoint, returns dashboard settings such as the monthly quota
+// and the current billing cycle (dates in server local time, end exclusive) the quota applies to
+func (s *Server) handleUIConfig(w http.ResponseWriter, r *http.Request) {
+	cycleStart, cycleEnd := s.forecastConfig().billingCycle(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"monthly_quota_bytes": s.monthlyQuota,
+		"billing_day":         max(s.billingDay, 1),
+		"cycle_start":         cycleStart.Format("2006-01-02"),
+		"cycle_end":           cycleEnd.Format("2006-01-02"),
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUIConfig(t *testing.T) {
+	s := newTestServer(t)
+	s.monthlyQuota = 1e12
+	s.billingDay = 5
+	handler, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(t, handler, "GET", "/ui/config.json?token=secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var config struct {
+		Quota      float64 `json:"monthly_quota_bytes"`
+		BillingDay int     `json:"billing_day"`
+		CycleStart string  `json:"cycle_start"`
+		CycleEnd   string  `json:"cycle_end"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	start, end := forecastConfig{BillingDay: 5}.billingCycle(time.Now())
+	if config.Quota != 1e12 || config.BillingDay != 5 || config.CycleStart != start.Format("2006-01-02") || config.CycleEnd != end.Format("2006-01-02") {
+		t.Errorf("config = %+v, want the quota and the cycle %v - %v", config, start, end)
+	}
+}
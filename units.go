@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// unitOptions selects how traffic volumes and rates are formatted
+// Every human-readable byte or rate string in the server goes through these helpers
+type unitOptions struct {
+	Units string // "iec" (KiB, MiB, ...), "si" (kB, MB, ...) or "bytes" (plain byte counts)
+	Rate  string // "bits" (bit/s) or "bytes" (B/s in the selected units)
+}
+
+// defaultUnitOptions returns IEC volumes and bit rates
+func defaultUnitOptions() unitOptions {
+	return unitOptions{Units: "iec", Rate: "bits"}
+}
+
+// parseUnitOptions reads the units (iec|si|bytes) and rate (bits|bytes) query parameters
+func parseUnitOptions(query url.Values) (unitOptions, error) {
+	opts := defaultUnitOptions()
+
+	if units := query.Get("units"); units != "" {
+		if units != "iec" && units != "si" && units != "bytes" {
+			return opts, fmt.Errorf("invalid units: %q (must be iec, si or bytes)", units)
+		}
+		opts.Units = units
+	}
+
+	if rate := query.Get("rate"); rate != "" {
+		if rate != "bits" && rate != "bytes" {
+			return opts, fmt.Errorf("invalid rate: %q (must be bits or bytes)", rate)
+		}
+		opts.Rate = rate
+	}
+
+	return opts, nil
+}
+
+// Volume formats a byte count in the selected units
+func (o unitOptions) Volume(bytes float64) string {
+	switch o.Units {
+	case "si":
+		return formatBytesSI(bytes)
+	case "bytes":
+		return fmt.Sprintf("%.0f B", bytes)
+	default:
+		return formatBytes(bytes)
+	}
+}
+
+// RateValue converts bytes per second to the selected rate unit (bits or bytes per second)
+func (o unitOptions) RateValue(bytesPerSecond float64) float64 {
+	if o.Rate == "bytes" {
+		return bytesPerSecond
+	}
+	return bytesPerSecond * 8
+}
+
+// RateString formats bytes per second in the selected rate unit
+func (o unitOptions) RateString(bytesPerSecond float64) string {
+	if o.Rate == "bytes" {
+		return o.Volume(bytesPerSecond) + "/s"
+	}
+	return formatBitRate(bytesPerSecond * 8)
+}
+
+// scaleUnit divides value by base until it fits the largest suitable unit
+func scaleUnit(value, base float64, units []string) (float64, string) {
+	i := 0
+	for value >= base && i < len(units)-1 {
+		value /= base
+		i++
+	}
+	return value, units[i]
+}
+
+// formatScaled formats a scaled value with three significant digits (whole numbers for the base unit)
+func formatScaled(value float64, unit string, baseUnit bool) string {
+	switch {
+	case baseUnit || value >= 100:
+		return fmt.Sprintf("%.0f %s", value, unit)
+	case value >= 10:
+		return fmt.Sprintf("%.1f %s", value, unit)
+	default:
+		return fmt.Sprintf("%.2f %s", value, unit)
+	}
+}
+
+// formatBytes formats a byte count with binary (IEC) units, e.g. "1.25 GiB"
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	value, unit := scaleUnit(bytes, 1024, units)
+	return formatScaled(value, unit, unit == units[0])
+}
+
+// formatBytesSI formats a byte count with decimal (SI) units, e.g. "1.50 GB"
+func formatBytesSI(bytes float64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB", "PB"}
+	value, unit := scaleUnit(bytes, 1000, units)
+	return formatScaled(value, unit, unit == units[0])
+}
+
+// formatBitRate formats bits per second with decimal units, e.g. "12.50 Mbit/s"
+func formatBitRate(bits float64) string {
+	units := []string{"bit/s", "kbit/s", "Mbit/s", "Gbit/s", "Tbit/s"}
+	value, unit := scaleUnit(bits, 1000, units)
+	if unit == units[0] {
+		return fmt.Sprintf("%.0f %s", value, unit)
+	}
+	return fmt.Sprintf("%.2f %s", value, unit)
+}